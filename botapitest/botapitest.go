@@ -0,0 +1,514 @@
+// Package botapitest implements a fake VK Teams Bot API server for integration tests.
+//
+// The server keeps a queue of events for long polling requests, records sent messages,
+// edits and answers to callback queries, and returns configured chat members and admins.
+package botapitest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	botgolang "github.com/mail-ru-im/bot-golang"
+)
+
+const (
+	// BotID is the user ID of the fake bot.
+	BotID = "1000"
+	// BotNick is the nick of the fake bot.
+	BotNick = "gobot_test_bot"
+)
+
+// ErrTimeout is returned when the expected state is not reached in time.
+var ErrTimeout = errors.New("timeout")
+
+// Button is an inline keyboard button of a sent message.
+type Button struct {
+	Text         string `json:"text"`
+	URL          string `json:"url,omitempty"`
+	CallbackData string `json:"callbackData,omitempty"`
+}
+
+// Message is a message sent by the bot, it contains the current state after edits.
+type Message struct {
+	ID        string
+	ChatID    string
+	Text      string
+	ParseMode string
+	Keyboard  [][]Button
+	Edits     int
+	Deleted   bool
+}
+
+// CallbackAnswer is an answer of the bot to a callback query.
+type CallbackAnswer struct {
+	QueryID   string
+	Text      string
+	URL       string
+	ShowAlert bool
+}
+
+// Request is a recorded API request, its parameters don't contain the token.
+type Request struct {
+	Method string
+	Params url.Values
+}
+
+// Server is a stateful fake of the bot API.
+type Server struct {
+	*httptest.Server
+	mu        sync.Mutex
+	changed   chan struct{} // it's closed and replaced after every state change
+	done      chan struct{}
+	closeOnce sync.Once
+	lastID    int64 // last message or query ID
+	polls     int   // number of long polling requests
+	events    []botgolang.Event
+	messages  []*Message
+	answers   []CallbackAnswer
+	requests  []Request
+	members   map[string][]botgolang.ChatMember
+}
+
+// NewServer starts and returns a new fake server, the caller should call Close when finished.
+// Message IDs are unique between runs, because processed messages are saved to the database.
+func NewServer() *Server {
+	s := &Server{
+		changed: make(chan struct{}),
+		done:    make(chan struct{}),
+		lastID:  time.Now().UnixNano(),
+		members: make(map[string][]botgolang.ChatMember),
+	}
+
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// Close stops waiting long polling requests and shuts down the server.
+func (s *Server) Close() {
+	s.closeOnce.Do(func() {
+		close(s.done)
+	})
+	s.Server.Close()
+}
+
+// notify wakes up waiting requests and helpers, a caller must hold the lock.
+func (s *Server) notify() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// nextID returns a new unique ID of a message or a query, a caller must hold the lock.
+func (s *Server) nextID() string {
+	s.lastID++
+	return strconv.FormatInt(s.lastID, 10)
+}
+
+// wait waits until the ready function returns true, it's called under the lock.
+func (s *Server) wait(ctx context.Context, timeout time.Duration, ready func() bool) bool {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		s.mu.Lock()
+		ok, changed := ready(), s.changed
+		s.mu.Unlock()
+
+		if ok {
+			return true
+		}
+
+		select {
+		case <-changed:
+		case <-timer.C:
+			return false
+		case <-ctx.Done():
+			return false
+		case <-s.done:
+			return false
+		}
+	}
+}
+
+// SetMembers sets the chat members, previous ones are replaced.
+func (s *Server) SetMembers(chatID string, userIDs ...string) {
+	members := make([]botgolang.ChatMember, len(userIDs))
+	for i, userID := range userIDs {
+		members[i] = botgolang.ChatMember{User: botgolang.User{ID: userID}}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.members[chatID] = members
+}
+
+// SetAdmins marks the users as the chat admins, they are added to the members if needed.
+func (s *Server) SetAdmins(chatID string, userIDs ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	members := s.members[chatID]
+	for _, userID := range userIDs {
+		found := false
+
+		for i := range members {
+			if members[i].ID == userID {
+				members[i].Admin, found = true, true
+			}
+		}
+
+		if !found {
+			members = append(members, botgolang.ChatMember{User: botgolang.User{ID: userID}, Admin: true})
+		}
+	}
+
+	s.members[chatID] = members
+}
+
+// AddEvent adds the event to the queue and returns its ID, the event ID is set by the server.
+// The bot client skips events which are added before its first long polling request, see WaitPolling.
+func (s *Server) AddEvent(event botgolang.Event) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	event.EventID = len(s.events) + 1
+	s.events = append(s.events, event)
+	s.notify()
+
+	return event.EventID
+}
+
+// payload returns an event payload of the user's message in the chat.
+func payload(chatID, userID, msgID, text string) botgolang.BaseEventPayload {
+	chatType := botgolang.Group
+	if chatID == userID {
+		chatType = botgolang.Private
+	}
+
+	return botgolang.BaseEventPayload{
+		MsgID:     msgID,
+		Chat:      botgolang.Chat{ID: chatID, Type: chatType},
+		From:      botgolang.Contact{User: botgolang.User{ID: userID}, FirstName: userID},
+		Text:      text,
+		Timestamp: int(time.Now().Unix()),
+	}
+}
+
+// NewMessage adds an event of the user's new message in the chat and returns the message ID.
+func (s *Server) NewMessage(chatID, userID, text string) string {
+	s.mu.Lock()
+	msgID := s.nextID()
+	s.mu.Unlock()
+
+	s.AddEvent(botgolang.Event{
+		Type:    botgolang.NEW_MESSAGE,
+		Payload: botgolang.EventPayload{BaseEventPayload: payload(chatID, userID, msgID, text)},
+	})
+
+	return msgID
+}
+
+// EditMessage adds an event of the user's edited message in the chat.
+func (s *Server) EditMessage(chatID, userID, msgID, text string) {
+	s.AddEvent(botgolang.Event{
+		Type:    botgolang.EDITED_MESSAGE,
+		Payload: botgolang.EventPayload{BaseEventPayload: payload(chatID, userID, msgID, text)},
+	})
+}
+
+// CallbackQuery adds an event of the user's click on the button with callback data
+// of the bot message and returns the query ID.
+func (s *Server) CallbackQuery(chatID, userID, msgID, data string) string {
+	s.mu.Lock()
+	queryID := s.nextID()
+	s.mu.Unlock()
+
+	message := payload(chatID, BotID, msgID, "")
+	message.From.FirstName = BotNick
+
+	s.AddEvent(botgolang.Event{
+		Type: botgolang.CALLBACK_QUERY,
+		Payload: botgolang.EventPayload{
+			BaseEventPayload: payload(chatID, userID, "", ""),
+			QueryID:          queryID,
+			CallbackMsg:      message,
+			CallbackData:     data,
+		},
+	})
+
+	return queryID
+}
+
+// Messages returns messages sent to the chat including deleted ones.
+func (s *Server) Messages(chatID string) []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.chatMessages(chatID)
+}
+
+// chatMessages returns copies of the chat messages, a caller must hold the lock.
+func (s *Server) chatMessages(chatID string) []Message {
+	var messages []Message
+
+	for _, m := range s.messages {
+		if m.ChatID == chatID {
+			messages = append(messages, *m)
+		}
+	}
+
+	return messages
+}
+
+// Answers returns answers to callback queries.
+func (s *Server) Answers() []CallbackAnswer {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]CallbackAnswer(nil), s.answers...)
+}
+
+// Requests returns all API requests except events polling in the order they were received.
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+// WaitPolling waits for a long polling request of events, so the bot doesn't skip added events.
+func (s *Server) WaitPolling(timeout time.Duration) error {
+	if !s.wait(context.Background(), timeout, func() bool { return s.polls > 0 }) {
+		return fmt.Errorf("no events polling: %w", ErrTimeout)
+	}
+	return nil
+}
+
+// WaitMessages waits until the bot sends at least n messages to the chat and returns them.
+func (s *Server) WaitMessages(chatID string, n int, timeout time.Duration) ([]Message, error) {
+	var messages []Message
+
+	ready := func() bool {
+		messages = s.chatMessages(chatID)
+		return len(messages) >= n
+	}
+
+	if !s.wait(context.Background(), timeout, ready) {
+		return messages, fmt.Errorf("got %d messages of %d for chat %q: %w", len(messages), n, chatID, ErrTimeout)
+	}
+
+	return messages, nil
+}
+
+// handle serves API requests.
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	params.Del("token")
+
+	if r.URL.Path != "/events/get" {
+		s.mu.Lock()
+		s.requests = append(s.requests, Request{Method: r.URL.Path, Params: params})
+		s.mu.Unlock()
+	}
+
+	var (
+		response map[string]any
+		err      error
+	)
+
+	switch r.URL.Path {
+	case "/self/get":
+		response = map[string]any{"userId": BotID, "nick": BotNick, "firstName": BotNick}
+	case "/events/get":
+		response, err = s.getEvents(r.Context(), params)
+	case "/messages/sendText":
+		response, err = s.sendText(params)
+	case "/messages/editText":
+		response, err = s.editText(params)
+	case "/messages/deleteMessages":
+		response, err = s.deleteMessages(params)
+	case "/messages/answerCallbackQuery":
+		response, err = s.answerCallbackQuery(params)
+	case "/chats/getMembers":
+		response = map[string]any{"members": s.chatMembers(params.Get("chatId"), false)}
+	case "/chats/getAdmins":
+		response = map[string]any{"admins": s.chatMembers(params.Get("chatId"), true)}
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	data := map[string]any{"ok": true}
+	if err != nil {
+		data = map[string]any{"ok": false, "description": err.Error()}
+	} else {
+		maps.Copy(data, response)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// getEvents returns events after the last event ID, it waits for new ones up to the poll time.
+func (s *Server) getEvents(ctx context.Context, params url.Values) (map[string]any, error) {
+	lastEventID, err := strconv.Atoi(params.Get("lastEventId"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid lastEventId: %w", err)
+	}
+
+	pollTime, err := strconv.Atoi(params.Get("pollTime"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid pollTime: %w", err)
+	}
+
+	if pollTime > 0 {
+		s.mu.Lock()
+		s.polls++
+		s.notify()
+		s.mu.Unlock()
+	}
+
+	var events []botgolang.Event
+	ready := func() bool {
+		if lastEventID < len(s.events) {
+			events = append([]botgolang.Event(nil), s.events[lastEventID:]...)
+		}
+		return len(events) > 0
+	}
+
+	s.wait(ctx, time.Duration(pollTime)*time.Second, ready)
+	return map[string]any{"events": events}, nil
+}
+
+// keyboard parses inline keyboard markup of the message.
+func keyboard(params url.Values) ([][]Button, error) {
+	var buttons [][]Button
+
+	if value := params.Get("inlineKeyboardMarkup"); value != "" {
+		if err := json.Unmarshal([]byte(value), &buttons); err != nil {
+			return nil, fmt.Errorf("invalid inlineKeyboardMarkup: %w", err)
+		}
+	}
+
+	return buttons, nil
+}
+
+// sendText saves a new message.
+func (s *Server) sendText(params url.Values) (map[string]any, error) {
+	buttons, err := keyboard(params)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	message := &Message{
+		ID:        s.nextID(),
+		ChatID:    params.Get("chatId"),
+		Text:      params.Get("text"),
+		ParseMode: params.Get("parseMode"),
+		Keyboard:  buttons,
+	}
+
+	s.messages = append(s.messages, message)
+	s.notify()
+
+	return map[string]any{"msgId": message.ID}, nil
+}
+
+// message returns a sent message by its chat and message IDs, a caller must hold the lock.
+func (s *Server) message(params url.Values) (*Message, error) {
+	chatID, msgID := params.Get("chatId"), params.Get("msgId")
+
+	for _, m := range s.messages {
+		if m.ChatID == chatID && m.ID == msgID && !m.Deleted {
+			return m, nil
+		}
+	}
+
+	return nil, fmt.Errorf("message %q not found in chat %q", msgID, chatID)
+}
+
+// editText updates a sent message.
+func (s *Server) editText(params url.Values) (map[string]any, error) {
+	buttons, err := keyboard(params)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	message, err := s.message(params)
+	if err != nil {
+		return nil, err
+	}
+
+	message.Text = params.Get("text")
+	message.ParseMode = params.Get("parseMode")
+	message.Keyboard = buttons
+	message.Edits++
+	s.notify()
+
+	return nil, nil
+}
+
+// deleteMessages marks a sent message as deleted.
+func (s *Server) deleteMessages(params url.Values) (map[string]any, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	message, err := s.message(params)
+	if err != nil {
+		return nil, err
+	}
+
+	message.Deleted = true
+	s.notify()
+
+	return nil, nil
+}
+
+// answerCallbackQuery saves an answer to a callback query.
+func (s *Server) answerCallbackQuery(params url.Values) (map[string]any, error) {
+	showAlert, err := strconv.ParseBool(params.Get("showAlert"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid showAlert: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.answers = append(s.answers, CallbackAnswer{
+		QueryID:   params.Get("queryId"),
+		Text:      params.Get("text"),
+		URL:       params.Get("url"),
+		ShowAlert: showAlert,
+	})
+	s.notify()
+
+	return nil, nil
+}
+
+// chatMembers returns members or only admins of the chat.
+func (s *Server) chatMembers(chatID string, onlyAdmins bool) []botgolang.ChatMember {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	members := make([]botgolang.ChatMember, 0, len(s.members[chatID]))
+	for _, m := range s.members[chatID] {
+		if !onlyAdmins || m.Admin || m.Creator {
+			members = append(members, m)
+		}
+	}
+
+	return members
+}
@@ -0,0 +1,159 @@
+package botapitest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	botgolang "github.com/mail-ru-im/bot-golang"
+)
+
+const testChatID = "test@chat.agent"
+
+func newBot(t *testing.T, s *Server) *botgolang.Bot {
+	bot, err := botgolang.NewBot("token", botgolang.BotApiURL(s.URL), botgolang.BotHTTPClient(*s.Client()))
+	if err != nil {
+		t.Fatalf("NewBot: %v", err)
+	}
+
+	return bot
+}
+
+func TestServer_Events(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	bot := newBot(t, s)
+	if bot.Info.ID != BotID || bot.Info.Nick != BotNick {
+		t.Errorf("failed bot info %+v", bot.Info)
+	}
+
+	// skipped by the client
+	s.NewMessage(testChatID, "user1@my.team", "old")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := bot.GetUpdatesChannel(ctx)
+
+	if err := s.WaitPolling(time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	msgID := s.NewMessage(testChatID, "user1@my.team", "/start")
+	s.EditMessage(testChatID, "user1@my.team", msgID, "/stop")
+	queryID := s.CallbackQuery(testChatID, "user2@my.team", "42", "button")
+
+	event := <-events
+	if p := event.Payload; event.Type != botgolang.NEW_MESSAGE || p.MsgID != msgID || p.Text != "/start" ||
+		p.Chat.ID != testChatID || p.Chat.Type != botgolang.Group || p.From.ID != "user1@my.team" {
+		t.Errorf("failed new message event %+v", event)
+	}
+
+	event = <-events
+	if p := event.Payload; event.Type != botgolang.EDITED_MESSAGE || p.MsgID != msgID || p.Text != "/stop" {
+		t.Errorf("failed edited message event %+v", event)
+	}
+
+	event = <-events
+	if p := event.Payload; event.Type != botgolang.CALLBACK_QUERY || p.QueryID != queryID ||
+		p.CallbackData != "button" || p.CallbackMsg.MsgID != "42" || p.From.ID != "user2@my.team" {
+		t.Errorf("failed callback query event %+v", event)
+	}
+
+	if err := bot.NewButtonResponse(queryID, "", "done", true).Send(); err != nil {
+		t.Fatal(err)
+	}
+
+	answers := s.Answers()
+	if len(answers) != 1 || answers[0] != (CallbackAnswer{QueryID: queryID, Text: "done", ShowAlert: true}) {
+		t.Errorf("failed answers %+v", answers)
+	}
+}
+
+func TestServer_Messages(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	bot := newBot(t, s)
+	message := bot.NewTextMessage(testChatID, "hello")
+
+	keyboard := botgolang.NewKeyboard()
+	keyboard.AddRow(botgolang.NewURLButton("call", "https://example.com"))
+	message.AttachInlineKeyboard(keyboard)
+
+	if err := message.Send(); err != nil {
+		t.Fatal(err)
+	}
+
+	messages, err := s.WaitMessages(testChatID, 1, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := messages[0]
+	if m.ID != message.ID || m.Text != "hello" || len(m.Keyboard) != 1 || m.Keyboard[0][0].URL != "https://example.com" {
+		t.Errorf("failed message %+v", m)
+	}
+
+	message.Text = "<b>hi</b>"
+	message.InlineKeyboard = nil
+	message.AppendParseMode(botgolang.ParseModeHTML)
+
+	if err = message.Edit(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = message.Delete(); err != nil {
+		t.Fatal(err)
+	}
+
+	m = s.Messages(testChatID)[0]
+	if m.Text != "<b>hi</b>" || m.ParseMode != "HTML" || m.Keyboard != nil || m.Edits != 1 || !m.Deleted {
+		t.Errorf("failed message %+v", m)
+	}
+
+	if err = message.Edit(); err == nil {
+		t.Error("expected error of deleted message editing")
+	}
+
+	if _, err = s.WaitMessages(testChatID, 2, 10*time.Millisecond); !errors.Is(err, ErrTimeout) {
+		t.Errorf("failed error: %v", err)
+	}
+
+	requests := s.Requests()
+	if n := len(requests); n != 5 || requests[1].Method != "/messages/sendText" || requests[1].Params.Has("token") {
+		t.Errorf("failed requests %+v", requests)
+	}
+}
+
+func TestServer_Members(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	bot := newBot(t, s)
+	s.SetMembers(testChatID, "user1@my.team", "user2@my.team", BotID)
+	s.SetAdmins(testChatID, "user2@my.team", "user3@my.team")
+
+	members, err := bot.GetChatMembers(testChatID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(members) != 4 || members[0].Admin || !members[1].Admin || members[3].ID != "user3@my.team" {
+		t.Errorf("failed members %+v", members)
+	}
+
+	admins, err := bot.GetChatAdmins(testChatID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(admins) != 2 || admins[0].ID != "user2@my.team" || admins[1].ID != "user3@my.team" {
+		t.Errorf("failed admins %+v", admins)
+	}
+
+	if members, err = bot.GetChatMembers("unknown@chat.agent"); err != nil || len(members) != 0 {
+		t.Errorf("failed unknown chat members %+v: %v", members, err)
+	}
+}
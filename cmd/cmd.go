@@ -1,59 +1,84 @@
 package cmd
 
 import (
-	"bytes"
 	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
 	"fmt"
-	"math/rand/v2"
 	"net/url"
 	"regexp"
 	"sort"
 	"strconv"
 	"strings"
 	"time"
-
-	botgolang "github.com/mail-ru-im/bot-golang"
-	"github.com/z0rr0/aoapi"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/z0rr0/gobot/config"
 	"github.com/z0rr0/gobot/db"
+	"github.com/z0rr0/gobot/llm"
+	"github.com/z0rr0/gobot/markup"
+	"github.com/z0rr0/gobot/order"
+	"github.com/z0rr0/gobot/transport"
 )
 
 var (
-	// botIDRegexp is a regexp to detect UserID as a bot identifier.
-	botIDRegexp = regexp.MustCompile(`^\d+$`)
 	// botIDRegexp is a regexp to find all UserIDs in arguments.
 	userIDRegexp = regexp.MustCompile(`@\[([0-9A-Za-z@.]+)]`)
 	authorRegexp = regexp.MustCompile(`^([0-9A-Za-z@.]+)`)
+	// vacationRegexp is a regexp of vacation duration in days or weeks.
+	vacationRegexp = regexp.MustCompile(`^(\d+)([dw])$`)
 )
 
 // Event is implementation of Connector interface.
 type Event struct {
 	Cfg       *config.Config
-	ChatEvent *botgolang.Event
+	ChatEvent *transport.Event
 	Chat      *db.Chat
 	OnlyChat  bool
 	Arguments string
-	// only for testing
-	debug  bool
-	buffer *bytes.Buffer
+	// Outcome is a result of the command which is saved for the message,
+	// before handling it contains the previous outcome if the message was edited.
+	Outcome string
 }
 
-func (e *Event) writeLog(msg string) error {
-	if !e.debug {
-		return nil
-	}
-	if e.buffer == nil {
-		e.buffer = bytes.NewBufferString(msg)
-		return nil
+// IsChat returns true if event is chat event.
+func (e *Event) IsChat() bool {
+	return e.ChatEvent.ChatID != e.ChatEvent.From.ID
+}
+
+// Outcomes of toggle commands.
+const (
+	outcomeOn  = "on"
+	outcomeOff = "off"
+)
+
+// toggle returns a new state of a toggle command and saves it as the outcome.
+// The state is switched, but an edited message repeats its previous outcome,
+// so re-runs of the same message don't flip the state again.
+func (e *Event) toggle(current bool) bool {
+	state := !current
+
+	switch e.Outcome {
+	case outcomeOn:
+		state = true
+	case outcomeOff:
+		state = false
 	}
-	_, err := e.buffer.WriteString(msg)
-	return err
+
+	e.setOutcome(state)
+	return state
 }
 
-// IsChat returns true if event is chat event.
-func (e *Event) IsChat() bool {
-	return e.ChatEvent.Payload.Chat.ID != e.ChatEvent.Payload.From.ID
+// setOutcome saves the state of a toggle command as the outcome.
+func (e *Event) setOutcome(state bool) {
+	if state {
+		e.Outcome = outcomeOn
+	} else {
+		e.Outcome = outcomeOff
+	}
 }
 
 // Unavailable returns true if event is unavailable.
@@ -61,29 +86,47 @@ func (e *Event) Unavailable() bool {
 	return e.OnlyChat && !e.IsChat()
 }
 
+// Location returns the chat's timezone location or the default one from the configuration.
+func (e *Event) Location() *time.Location {
+	return e.Chat.Location(e.Cfg.Timezone)
+}
+
+// Now returns current time in the chat's timezone.
+func (e *Event) Now() time.Time {
+	return time.Now().In(e.Location())
+}
+
 // SendMessage sends message to chat.
 func (e *Event) SendMessage(msg string) error {
-	if err := e.writeLog(msg); err != nil {
-		return err
-	}
-	message := e.Cfg.Bt.NewTextMessage(e.Chat.ID, msg)
-	return e.Cfg.Bt.SendMessage(message)
+	return e.Cfg.Messenger.Send(&transport.Message{ChatID: e.Chat.ID, Text: msg})
 }
 
-// SendURLMessage sends message to chat with URL link.
-func (e *Event) SendURLMessage(msg, txt, url string) error {
-	if err := e.writeLog(msg); err != nil {
-		return err
+// SendLongMessage sends text to chat split into several messages if it's too long,
+// the text is formatted by the AI markup mode.
+func (e *Event) SendLongMessage(text string) error {
+	return e.sendParts(markup.Prepare(text, e.Cfg.AI.Markup, markup.MaxLength))
+}
+
+// sendParts sends prepared parts of AI answer as separate messages.
+func (e *Event) sendParts(parts []string) error {
+	for _, msg := range parts {
+		if err := e.Cfg.Messenger.Send(e.newMarkupMessage(msg)); err != nil {
+			return err
+		}
 	}
 
-	message := e.Cfg.Bt.NewTextMessage(e.Chat.ID, msg)
-	btn := botgolang.NewURLButton(txt, url)
+	return nil
+}
 
-	keyboard := botgolang.NewKeyboard()
-	keyboard.AddRow(btn)
+// newMarkupMessage returns a new message with the parse mode of AI markup.
+func (e *Event) newMarkupMessage(text string) *transport.Message {
+	return &transport.Message{ChatID: e.Chat.ID, Text: text, Markup: e.Cfg.AI.Markup}
+}
 
-	message.AttachInlineKeyboard(keyboard)
-	return e.Cfg.Bt.SendMessage(message)
+// SendURLMessage sends message to chat with URL link.
+func (e *Event) SendURLMessage(msg, txt, url string) error {
+	message := &transport.Message{ChatID: e.Chat.ID, Text: msg, Buttons: []transport.Button{{Text: txt, URL: url}}}
+	return e.Cfg.Messenger.Send(message)
 }
 
 // ArgsUserIDs returns all UserIDs from arguments.
@@ -131,48 +174,64 @@ func Stop(ctx context.Context, e *Event) error {
 	return e.SendMessage("stopped")
 }
 
-// Go returns a list of chat members in random order.
-func Go(_ context.Context, e *Event) error {
-	members, err := e.Cfg.Bt.GetChatMembers(e.Chat.ID)
+// Go returns a list of chat members in the chat's order, random by default.
+// The result is saved to the history, it's used by fair and rotate orders.
+func Go(ctx context.Context, e *Event) error {
+	members, err := e.Cfg.Messenger.Members(e.Chat.ID)
 	if err != nil {
 		return fmt.Errorf("can't get chat members: %v", err)
 	}
 
-	names := make([]string, 0, len(members)-1)
-	noDaysUsers := e.Chat.WeekDays[time.Now().In(e.Cfg.Timezone).Weekday()]
+	if len(members) == 0 {
+		return e.SendMessage("no members")
+	}
+
+	users := make([]string, 0, len(members))
+	noDaysUsers := e.Chat.WeekDays[e.Now().Weekday()]
 
 	for _, m := range members {
-		if _, ok := e.Chat.ExcludeUsers[m.User.ID]; ok {
+		if _, ok := e.Chat.ExcludeUsers[m.ID]; ok {
 			continue
 		}
 
-		if _, ok := e.Chat.SkipUsers[m.User.ID]; ok {
+		if _, ok := e.Chat.SkipUsers[m.ID]; ok {
 			continue
 		}
 
-		if _, ok := noDaysUsers[m.User.ID]; ok {
+		if _, ok := noDaysUsers[m.ID]; ok {
 			continue
 		}
 
-		if !botIDRegexp.MatchString(m.User.ID) {
-			names = append(names, fmt.Sprintf("@[%s]", m.User.ID))
+		if !m.Bot {
+			users = append(users, m.ID)
 		}
 	}
 
-	count := len(names)
-	if count == 0 {
+	if len(users) == 0 {
 		return e.SendMessage("no users :(")
 	}
 
-	r := rand.New(e.Cfg.RandSource) // #nosec G404 - it isn't security sensitive, use real or pseudo-random
-	r.Shuffle(len(names), func(i, j int) {
-		names[i], names[j] = names[j], names[i]
-	})
+	mode, err := order.Parse(e.Chat.Order)
+	if err != nil {
+		mode = order.Random // unknown saved value
+	}
+
+	var history [][]string
+	if n := mode.History(); n > 0 {
+		if history, err = db.RecentOrders(ctx, e.Cfg.DB, e.Chat.ID, n); err != nil {
+			return fmt.Errorf("can't get history: %v", err)
+		}
+	}
+
+	users = mode.Sort(users, history, e.Cfg.RandSource)
+	if err = db.SaveOrder(ctx, e.Cfg.DB, e.Chat.ID, e.ChatEvent.From.ID, users); err != nil {
+		return fmt.Errorf("can't save history: %v", err)
+	}
 
 	var b strings.Builder
 
-	for i, name := range names {
-		b.WriteString(fmt.Sprintf("%d. %s\n", i+1, name))
+	for i, user := range users {
+		b.WriteString(fmt.Sprintf("%d. @[%s]\n", i+1, user))
 	}
 
 	msg := strings.TrimSuffix(b.String(), "\n")
@@ -219,8 +278,7 @@ func (e *Event) setExclude(ctx context.Context) error {
 		return e.SendMessage("no user IDs in arguments")
 	}
 
-	e.Chat.AddExclude(users)
-	if err := e.Chat.Update(ctx, e.Cfg.DB); err != nil {
+	if err := e.Chat.SaveExclude(ctx, e.Cfg.DB, users); err != nil {
 		return fmt.Errorf("can't handle exclude command: %v", err)
 	}
 	return e.SendMessage("success")
@@ -250,8 +308,7 @@ func Include(ctx context.Context, e *Event) error {
 	if len(users) == 0 {
 		return e.SendMessage("no user IDs in arguments")
 	}
-	e.Chat.DelExclude(users)
-	if err := e.Chat.Update(ctx, e.Cfg.DB); err != nil {
+	if err := e.Chat.DeleteExclude(ctx, e.Cfg.DB, users); err != nil {
 		return fmt.Errorf("can't handle include command: %v", err)
 	}
 	return e.SendMessage("success")
@@ -308,11 +365,53 @@ func ResetLink(ctx context.Context, e *Event) error {
 	return e.SendMessage("success")
 }
 
+// parseReturnDate returns the beginning of the return day from vacation.
+// The value can be a date "YYYY-MM-DD" or a number of days "Nd" or weeks "Nw" since now.
+func parseReturnDate(value string, now time.Time) (time.Time, error) {
+	const maxDays = 366
+	var days int
+
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+
+	if m := vacationRegexp.FindStringSubmatch(value); len(m) == 3 {
+		n, err := strconv.Atoi(m[1])
+		if err != nil {
+			return time.Time{}, fmt.Errorf("incorrect number %q", m[1])
+		}
+
+		days = n
+		if m[2] == "w" {
+			days = n * 7
+		}
+	} else {
+		date, err := time.ParseInLocation(time.DateOnly, value, now.Location())
+		if err != nil {
+			return time.Time{}, fmt.Errorf("incorrect date or duration %q, use YYYY-MM-DD, Nd or Nw", value)
+		}
+
+		// days difference, it can be not integer hours number due to DST
+		days = int(date.Sub(today).Round(24*time.Hour) / (24 * time.Hour))
+	}
+
+	if days < 1 {
+		return time.Time{}, fmt.Errorf("return date must be in the future")
+	}
+
+	if days > maxDays {
+		return time.Time{}, fmt.Errorf("vacation is too long (max %d days)", maxDays)
+	}
+
+	return today.AddDate(0, 0, days), nil
+}
+
 // Vacation adds or removes users from ignored list.
+// If a return date or duration is set, the user is excluded until that day.
 func Vacation(ctx context.Context, e *Event) error {
 	var (
 		msg        string
-		authorUser = e.ChatEvent.Payload.From.User.ID
+		err        error
+		authorUser = e.ChatEvent.From.ID
+		argument   = strings.TrimSpace(e.Arguments)
 	)
 	if !authorRegexp.MatchString(authorUser) {
 		return e.SendMessage("no valid author user")
@@ -321,112 +420,645 @@ func Vacation(ctx context.Context, e *Event) error {
 	// only one user map, the author
 	userMap := map[string]struct{}{authorUser: {}}
 
-	if _, ok := e.Chat.ExcludeUsers[authorUser]; ok {
-		// user is already in exclude list, so delete him from it
-		e.Chat.DelExclude(userMap)
+	if argument != "" {
+		until, errDate := parseReturnDate(argument, e.Now())
+		if errDate != nil {
+			return e.SendMessage(errDate.Error())
+		}
+
+		err = e.Chat.SaveVacation(ctx, e.Cfg.DB, authorUser, until)
+		msg = fmt.Sprintf("you are on vacation until %s, good luck", until.Format(time.DateOnly))
+		e.setOutcome(true)
+	} else if _, ok := e.Chat.ExcludeUsers[authorUser]; !e.toggle(ok) {
+		// user was in exclude list, so delete him from it
+		err = e.Chat.DeleteExclude(ctx, e.Cfg.DB, userMap)
 		msg = "you are back from vacation, welcome"
 	} else {
-		// user is not in exclude list, so add him to it
-		e.Chat.AddExclude(userMap)
+		// user was not in exclude list, so add him to it
+		err = e.Chat.SaveExclude(ctx, e.Cfg.DB, userMap)
 		msg = "you are on vacation, good luck"
 	}
 
-	if err := e.Chat.Update(ctx, e.Cfg.DB); err != nil {
+	if err != nil {
 		return fmt.Errorf("can't handle command: %v", err)
 	}
 
 	return e.SendMessage(fmt.Sprintf("@[%s] %s", authorUser, msg))
 }
 
+// Names of legacy AI providers with own commands.
+const (
+	providerGPT      = "gpt"
+	providerYandex   = "ygpt"
+	providerDeepSeek = "ds"
+)
+
 // GPT generates text using ChatGPT.
 func GPT(ctx context.Context, e *Event) error {
-	if e.Cfg.G.Client == nil {
-		return e.SendMessage("gpt is not configured")
+	return ask(ctx, e, providerGPT, e.Arguments)
+}
+
+// YandexGPT generates text using Yandex GPT.
+func YandexGPT(ctx context.Context, e *Event) error {
+	return ask(ctx, e, providerYandex, e.Arguments)
+}
+
+// DeepSeek generates text using DeepSeek API.
+func DeepSeek(ctx context.Context, e *Event) error {
+	return ask(ctx, e, providerDeepSeek, e.Arguments)
+}
+
+// ask continues the chat's conversation with AI provider or clears it by "reset" argument.
+// Previous messages are sent as a context, the oldest ones are trimmed to fit provider's max tokens.
+// Texts of replied and forwarded messages are added before the question.
+// If the provider fails, the answer is requested from the fallback chain and the answered provider is noted.
+func ask(ctx context.Context, e *Event, name, arguments string) error {
+	provider, ok := e.Cfg.LLM.Get(name)
+	if !ok {
+		return e.SendMessage(name + " is not configured")
 	}
 
+	// use GPT as common AI flag
 	if !e.Chat.GPT {
 		return e.SendMessage("gpt is not allowed for this chat")
 	}
 
-	content := strings.TrimSpace(e.Arguments)
-	if content == "" {
+	content, fresh := cutFlag(arguments, freshFlag)
+	quoted := e.quotedText()
+
+	switch {
+	case content == "" && quoted == "":
 		return e.SendMessage("no arguments")
+	case content == "reset":
+		if _, err := db.DeleteAIMessages(ctx, e.Cfg.DB, e.Chat.ID, name); err != nil {
+			return fmt.Errorf("can't reset conversation: %w", err)
+		}
+		return e.SendMessage("conversation is cleared")
+	}
+
+	var (
+		prompt   = e.Prompt()
+		options  = e.providerOptions(provider).Merge(provider.Defaults())
+		question = db.AIMessage{Role: db.RoleUser, Content: strings.TrimSpace(quoted + "\n\n" + content)}
+	)
+
+	history, err := db.AIMessages(ctx, e.Cfg.DB, e.Chat.ID, name, e.Cfg.AI.HistorySize)
+	if err != nil {
+		return fmt.Errorf("can't load conversation: %w", err)
+	}
+
+	var (
+		maxTokens = options.MaxTokens
+		messages  = make([]llm.Message, 0, len(history)+2)
+	)
+
+	if prompt != "" {
+		messages = append(messages, llm.Message{Role: llm.RoleSystem, Content: prompt})
+
+		if maxTokens > 0 {
+			// the prompt is always sent, so at least the question is kept
+			maxTokens = max(maxTokens-estimateTokens(prompt), 1)
+		}
+	}
+
+	for _, m := range trimMessages(append(history, question), maxTokens) {
+		messages = append(messages, llm.Message{Role: m.Role, Content: m.Content})
+	}
+
+	key := e.cacheKey(name, options.Model, messages)
+	if !fresh {
+		cached, errCache := e.cachedAnswer(ctx, key)
+		if errCache != nil {
+			return errCache
+		}
+
+		if cached != nil {
+			return e.answer(ctx, name, cached.Provider, question, cached.Answer, nil)
+		}
+	}
+
+	exceeded, err := e.quotaExceeded(ctx)
+	if err != nil {
+		return err
+	}
+
+	if exceeded != "" {
+		return e.SendMessage(exceeded + " AI quota is exceeded")
 	}
 
-	result, err := e.Cfg.G.Response(ctx, content, aoapi.ModelGPT4oMini)
+	var placeholder *streamMessage
+
+	if _, ok = llm.AsStreamer(provider); ok {
+		var cancel context.CancelFunc
+
+		// streamed generation can take more time than the main timeout
+		ctx, cancel = e.Cfg.StreamContext(ctx)
+		defer cancel()
+
+		if placeholder, err = e.sendPlaceholder(); err != nil {
+			return err
+		}
+	}
+
+	answered, result, err := e.complete(ctx, provider, messages, placeholder)
 	if err != nil {
+		if placeholder != nil {
+			placeholder.fail()
+		}
 		return err
 	}
 
-	return e.SendMessage(result)
+	tokens := result.Tokens
+	if tokens < 1 {
+		// the provider doesn't report usage
+		for _, m := range messages {
+			tokens += estimateTokens(m.Content)
+		}
+		tokens += estimateTokens(result.Text)
+	}
+
+	userID := e.ChatEvent.From.ID
+	if err = db.SaveUsage(ctx, e.Cfg.DB, e.Chat.ID, userID, answered, time.Now(), tokens); err != nil {
+		return fmt.Errorf("can't save usage: %w", err)
+	}
+
+	if e.Cfg.AI.CacheTTL > 0 {
+		cached := &db.CachedAnswer{Key: key, Provider: answered, Answer: result.Text}
+
+		if err = db.SaveCachedAnswer(ctx, e.Cfg.DB, cached, e.Cfg.AI.CacheSince()); err != nil {
+			return fmt.Errorf("can't save cached answer: %w", err)
+		}
+	}
+
+	return e.answer(ctx, name, answered, question, result.Text, placeholder)
 }
 
-// YandexGPT generates text using Yandex GPT.
-func YandexGPT(ctx context.Context, e *Event) error {
-	if e.Cfg.Y.Client == nil {
-		return e.SendMessage("yandex gpt is not configured")
+// answer saves the question and the answer to the provider's conversation and sends the answer,
+// if it was received from other provider, its name is noted.
+func (e *Event) answer(
+	ctx context.Context, name, answered string, question db.AIMessage, text string, placeholder *streamMessage,
+) error {
+	answer := db.AIMessage{Role: db.RoleAssistant, Content: text}
+
+	err := db.SaveAIMessages(ctx, e.Cfg.DB, e.Chat.ID, name, e.Cfg.AI.HistorySize, question, answer)
+	if err != nil {
+		return fmt.Errorf("can't save conversation: %w", err)
 	}
 
-	if !e.Chat.GPT {
-		return e.SendMessage("gpt is not allowed for this chat")
+	if answered != name {
+		text += "\n\n(answered by " + answered + ")"
 	}
 
-	content := strings.TrimSpace(e.Arguments)
-	if content == "" {
-		return e.SendMessage("no arguments")
+	if placeholder != nil {
+		return placeholder.finish(text)
 	}
 
-	result, err := e.Cfg.Y.Response(ctx, content)
+	return e.SendLongMessage(text)
+}
+
+// freshFlag is an argument of AI commands which bypasses the answers cache.
+const freshFlag = "--fresh"
+
+// cutFlag returns arguments without the leading flag and true if it was found.
+func cutFlag(arguments, flag string) (string, bool) {
+	arguments = strings.TrimSpace(arguments)
+
+	if first, rest := splitArguments(arguments); first == flag {
+		return strings.TrimSpace(rest), true
+	}
+
+	return arguments, false
+}
+
+// cacheKey returns a cache key of AI answer for the model and all sent messages.
+// A question without conversation context is shared between chats,
+// but follow-up questions depend on the chat's conversation, so the chat ID is added to their keys.
+func (e *Event) cacheKey(name, model string, messages []llm.Message) string {
+	parts := []string{name, model}
+
+	if n := len(messages); n > 1 && messages[n-2].Role != llm.RoleSystem {
+		parts = append(parts, e.Chat.ID)
+	}
+
+	for _, m := range messages {
+		parts = append(parts, m.Role, m.Content)
+	}
+
+	return contentKey(parts...)
+}
+
+// contentKey returns a content-addressed key, parts are separated by zero byte.
+func contentKey(parts ...string) string {
+	hash := sha256.New()
+
+	for _, part := range parts {
+		hash.Write([]byte(part))
+		hash.Write([]byte{0})
+	}
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// cachedAnswer returns a valid cached answer by the key, it's nil if the cache is disabled or there is no one.
+func (e *Event) cachedAnswer(ctx context.Context, key string) (*db.CachedAnswer, error) {
+	if e.Cfg.AI.CacheTTL < 1 {
+		return nil, nil
+	}
+
+	cached, err := db.GetCachedAnswer(ctx, e.Cfg.DB, key, e.Cfg.AI.CacheSince())
 	if err != nil {
-		return err
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("can't get cached answer: %w", err)
 	}
 
-	return e.SendMessage(result)
+	return cached, nil
 }
 
-// DeepSeek generates text using DeepSeek API.
-func DeepSeek(ctx context.Context, e *Event) error {
-	if e.Cfg.DS.Client == nil {
-		return e.SendMessage("DeepSeek is not configured")
+// complete returns a name of the answered provider and its response.
+// If the provider fails, the next providers of the fallback chain are asked,
+// transient errors of every provider are retried with exponential backoff.
+func (e *Event) complete(
+	ctx context.Context, provider llm.Provider, messages []llm.Message, placeholder *streamMessage,
+) (string, *llm.Response, error) {
+	var errs []error
+
+	for _, p := range e.fallbackChain(provider) {
+		var (
+			result  *llm.Response
+			options = e.providerOptions(p)
+		)
+
+		err := llm.Retry(ctx, e.Cfg.AI.Retries+1, e.Cfg.AI.RetryInterval(), func() error {
+			var err error
+
+			if streamer, ok := llm.AsStreamer(p); ok && placeholder != nil {
+				result, err = streamer.Stream(ctx, messages, options, placeholder.update)
+			} else {
+				result, err = p.Complete(ctx, messages, options)
+			}
+
+			return err
+		})
+
+		if err == nil {
+			return p.Name(), result, nil
+		}
+
+		errs = append(errs, err)
+		if ctx.Err() != nil {
+			break
+		}
 	}
 
-	// use GPT as common AI flag
-	if !e.Chat.GPT {
-		return e.SendMessage("gpt is not allowed for this chat")
+	return "", nil, errors.Join(errs...)
+}
+
+// fallbackChain returns the provider and other available providers of the fallback chain in its order.
+func (e *Event) fallbackChain(provider llm.Provider) []llm.Provider {
+	chain := []llm.Provider{provider}
+
+	for _, name := range e.Cfg.AI.Fallback {
+		if p, ok := e.Cfg.LLM.Get(name); ok && name != provider.Name() {
+			chain = append(chain, p)
+		}
 	}
 
-	content := strings.TrimSpace(e.Arguments)
-	if content == "" {
-		return e.SendMessage("no arguments")
+	return chain
+}
+
+// streamInterval is a minimal interval between edits of a streamed answer message.
+var streamInterval = 2 * time.Second
+
+// streamPlaceholder is a text of the message which is sent before the first part of streamed answer.
+const streamPlaceholder = "thinking…"
+
+// streamEmpty is a text of the placeholder message if the streamed answer is empty.
+const streamEmpty = "empty answer"
+
+// streamMessage is a placeholder message which is edited by parts of streamed AI answer.
+type streamMessage struct {
+	e       *Event
+	message *transport.Message
+	text    string    // last sent text
+	edited  time.Time // time of the last edit
+}
+
+// sendPlaceholder sends a placeholder message of streamed AI answer.
+func (e *Event) sendPlaceholder() (*streamMessage, error) {
+	message := &transport.Message{ChatID: e.Chat.ID, Text: streamPlaceholder}
+
+	if err := e.Cfg.Messenger.Send(message); err != nil {
+		return nil, fmt.Errorf("can't send placeholder: %w", err)
 	}
 
-	result, err := e.Cfg.DS.Response(ctx, content, aoapi.ModelDeepSeekChat)
+	return &streamMessage{e: e, message: message, text: streamPlaceholder, edited: time.Now()}, nil
+}
+
+// update edits the message by the accumulated text not more often than streamInterval.
+// The text is not formatted because Markdown of incomplete answer can be invalid,
+// errors are ignored to not interrupt the generation, the final edit is checked.
+func (s *streamMessage) update(text string) error {
+	if time.Since(s.edited) < streamInterval {
+		return nil
+	}
+
+	if runes := []rune(text); len(runes) > markup.MaxLength {
+		// the end of the answer will be sent by the final edit
+		text = string(runes[:markup.MaxLength-1]) + "…"
+	}
+
+	if text == s.text {
+		return nil
+	}
+
+	s.message.Text = text
+	if err := s.e.Cfg.Messenger.Edit(s.message); err == nil {
+		s.text = text
+	}
+
+	s.edited = time.Now()
+	return nil
+}
+
+// finish edits the message by the first part of the formatted answer, other parts are sent as new messages.
+func (s *streamMessage) finish(text string) error {
+	var parts []string
+	if strings.TrimSpace(text) != "" {
+		parts = markup.Prepare(text, s.e.Cfg.AI.Markup, markup.MaxLength)
+	}
+
+	if len(parts) == 0 {
+		// an empty message can't be sent, but the placeholder should not stay
+		parts = []string{streamEmpty}
+	}
+
+	if parts[0] == s.text && s.e.Cfg.AI.Markup == markup.Plain {
+		// the message already has the full text
+		return s.e.sendParts(parts[1:])
+	}
+
+	message := s.e.newMarkupMessage(parts[0])
+	message.ID = s.message.ID
+
+	if err := s.e.Cfg.Messenger.Edit(message); err != nil {
+		return fmt.Errorf("can't edit streamed message: %w", err)
+	}
+
+	return s.e.sendParts(parts[1:])
+}
+
+// fail deletes the placeholder message if the answer was not received.
+func (s *streamMessage) fail() {
+	// the error is reported by a new message, so the deletion is not important
+	_ = s.e.Cfg.Messenger.Delete(s.message)
+}
+
+// usagePeriod is a usage summary with its quota.
+type usagePeriod struct {
+	name  string
+	usage db.Usage
+	quota config.Quota
+}
+
+// usagePeriods returns daily and monthly usage of the chat and the author.
+// Periods are calculated in UTC, because the author's usage is common for chats with different timezones.
+func (e *Event) usagePeriods(ctx context.Context) ([]usagePeriod, error) {
+	var (
+		now    = time.Now().UTC()
+		today  = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+		month  = time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+		author = e.ChatEvent.From.ID
+	)
+
+	periods := []usagePeriod{
+		{name: "chat daily", quota: e.Cfg.AI.ChatDaily},
+		{name: "chat monthly", quota: e.Cfg.AI.ChatMonthly},
+		{name: "your daily", quota: e.Cfg.AI.UserDaily},
+		{name: "your monthly", quota: e.Cfg.AI.UserMonthly},
+	}
+
+	for i, since := range []time.Time{today, month, today, month} {
+		var err error
+
+		if i < 2 {
+			periods[i].usage, err = db.ChatUsage(ctx, e.Cfg.DB, e.Chat.ID, since)
+		} else {
+			periods[i].usage, err = db.UserUsage(ctx, e.Cfg.DB, author, since)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("can't get usage: %w", err)
+		}
+	}
+
+	return periods, nil
+}
+
+// quotaExceeded returns a name of the first exceeded quota or empty string.
+func (e *Event) quotaExceeded(ctx context.Context) (string, error) {
+	periods, err := e.usagePeriods(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	for _, p := range periods {
+		if p.quota.Exceeded(p.usage) {
+			return p.name, nil
+		}
+	}
+
+	return "", nil
+}
+
+// Usage shows daily and monthly AI commands usage of the chat and the author with quotas.
+func Usage(ctx context.Context, e *Event) error {
+	periods, err := e.usagePeriods(ctx)
 	if err != nil {
 		return err
 	}
 
-	return e.SendMessage(result)
+	lines := make([]string, 0, len(periods))
+	for _, p := range periods {
+		line := fmt.Sprintf("%s: %d requests, %d tokens", p.name, p.usage.Requests, p.usage.Tokens)
+
+		if !p.quota.IsZero() {
+			line += " (quota: " + formatQuota(p.quota) + ")"
+		}
+
+		lines = append(lines, line)
+	}
+
+	return e.SendMessage(strings.Join(lines, "\n"))
+}
+
+// formatQuota returns a description of quota's limits.
+func formatQuota(q config.Quota) string {
+	var limits []string
+
+	if q.Requests > 0 {
+		limits = append(limits, fmt.Sprintf("%d requests", q.Requests))
+	}
+
+	if q.Tokens > 0 {
+		limits = append(limits, fmt.Sprintf("%d tokens", q.Tokens))
+	}
+
+	return strings.Join(limits, ", ")
+}
+
+// quotedText returns texts of replied and forwarded messages with their authors.
+func (e *Event) quotedText() string {
+	var quotes []string
+
+	for _, quote := range e.ChatEvent.Quotes {
+		text := strings.TrimSpace(quote.Text)
+
+		if text == "" {
+			continue
+		}
+
+		quotes = append(quotes, fmt.Sprintf("Quoted message from %s:\n%s", quote.From.Name(), text))
+	}
+
+	return strings.Join(quotes, "\n\n")
+}
+
+// estimateTokens returns an approximate number of tokens in the text.
+func estimateTokens(text string) int {
+	const runesPerToken = 3
+	return (utf8.RuneCountInString(text) + runesPerToken - 1) / runesPerToken
+}
+
+// trimMessages removes the oldest messages while their estimated tokens exceed maxTokens,
+// the last message is always kept, and the conversation starts from a user's message.
+// Not positive maxTokens means no limit.
+func trimMessages(messages []db.AIMessage, maxTokens int) []db.AIMessage {
+	var (
+		i      int
+		tokens int
+	)
+
+	for _, m := range messages {
+		tokens += estimateTokens(m.Content)
+	}
+
+	for maxTokens > 0 && tokens > maxTokens && i < len(messages)-1 {
+		tokens -= estimateTokens(messages[i].Content)
+		i++
+	}
+
+	for i < len(messages)-1 && messages[i].Role != db.RoleUser {
+		i++
+	}
+
+	return messages[i:]
+}
+
+// isAdmin returns true if the user is the chat admin.
+func (e *Event) isAdmin(userID string) (bool, error) {
+	admins, err := e.Cfg.Messenger.Admins(e.Chat.ID)
+	if err != nil {
+		return false, fmt.Errorf("can't get chat admins: %v", err)
+	}
+
+	for _, admin := range admins {
+		if admin.ID == userID {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// AIToggle returns true if AI command arguments show or change the chat permission,
+// other arguments are questions to providers.
+func AIToggle(arguments string) bool {
+	switch strings.TrimSpace(arguments) {
+	case "", "status", "on", "off":
+		return true
+	}
+	return false
+}
+
+// AI enables, disables or shows permission of AI commands for the chat,
+// or asks AI provider if the first argument is its name.
+func AI(ctx context.Context, e *Event) error {
+	var (
+		status     = "disabled"
+		authorUser = e.ChatEvent.From.ID
+	)
+
+	switch arg := strings.TrimSpace(e.Arguments); arg {
+	case "", "status":
+		if e.Chat.GPT {
+			status = "enabled"
+		}
+		return e.SendMessage("AI commands are " + status + " for this chat")
+	case "on", "off":
+		if !authorRegexp.MatchString(authorUser) {
+			return e.SendMessage("no valid author user")
+		}
+
+		ok, err := e.isAdmin(authorUser)
+		if err != nil {
+			return err
+		}
+
+		if !ok {
+			return e.SendMessage("only chat admins can change AI permission")
+		}
+
+		e.Chat.GPT = arg == "on"
+		if e.Chat.GPT {
+			status = "enabled"
+		}
+
+		if err = e.Chat.Update(ctx, e.Cfg.DB); err != nil {
+			return fmt.Errorf("can't handle command: %v", err)
+		}
+
+		return e.SendMessage("AI commands are " + status + " for this chat")
+	default:
+		name, text := splitArguments(arg)
+		if _, ok := e.Cfg.LLM.Get(name); ok {
+			return ask(ctx, e, name, text)
+		}
+
+		if names := e.Cfg.LLM.Names(); len(names) > 0 {
+			return e.SendMessage("unknown argument, use: on, off, status or provider " + strings.Join(names, ", "))
+		}
+
+		return e.SendMessage("unknown argument, use: on, off or status")
+	}
+}
+
+// nextDay returns the beginning of the next day in the location of ts.
+func nextDay(ts time.Time) time.Time {
+	return time.Date(ts.Year(), ts.Month(), ts.Day()+1, 0, 0, 0, 0, ts.Location())
 }
 
 // Skip adds or removes users from skipped list.
 func Skip(ctx context.Context, e *Event) error {
 	var (
 		msg        string
-		authorUser = e.ChatEvent.Payload.From.User.ID
+		err        error
+		authorUser = e.ChatEvent.From.ID
 	)
 	if !authorRegexp.MatchString(authorUser) {
 		return e.SendMessage("no valid author user")
 	}
 
-	if _, ok := e.Chat.SkipUsers[authorUser]; ok {
-		e.Chat.DelSkip(authorUser)
+	if _, ok := e.Chat.SkipUsers[authorUser]; !e.toggle(ok) {
+		err = e.Chat.DeleteSkip(ctx, e.Cfg.DB, authorUser)
 		msg = "ok, you are in the list again"
 	} else {
-		e.Chat.AddSkip(authorUser)
+		err = e.Chat.SaveSkip(ctx, e.Cfg.DB, authorUser, nextDay(e.Now()))
 		msg = "ok, you will be skipped today"
 	}
 
-	if err := e.Chat.Update(ctx, e.Cfg.DB); err != nil {
+	if err != nil {
 		return fmt.Errorf("can't handle command: %v", err)
 	}
 
@@ -435,17 +1067,7 @@ func Skip(ctx context.Context, e *Event) error {
 
 // reduceNoDays removes authorUser user from all days.
 func reduceNoDays(ctx context.Context, authorUser string, e *Event) error {
-	for day, users := range e.Chat.WeekDays {
-		if _, ok := users[authorUser]; ok {
-			delete(users, authorUser)
-
-			if len(users) == 0 {
-				delete(e.Chat.WeekDays, day)
-			}
-		}
-	}
-
-	if err := e.Chat.Update(ctx, e.Cfg.DB); err != nil {
+	if err := e.Chat.SaveWeekDays(ctx, e.Cfg.DB, authorUser, nil); err != nil {
 		return fmt.Errorf("can't handle command: %v", err)
 	}
 
@@ -484,33 +1106,13 @@ func extendNoDays(ctx context.Context, authorUser string, e *Event) (string, err
 		wd := time.Weekday(i)
 		weekDays[wd] = struct{}{}
 		weekDaysNames = append(weekDaysNames, wd.String())
-
-		if _, ok := e.Chat.WeekDays[wd]; !ok {
-			if e.Chat.WeekDays == nil {
-				e.Chat.WeekDays = make(map[time.Weekday]map[string]struct{})
-			}
-			e.Chat.WeekDays[wd] = make(map[string]struct{})
-		}
-
-		e.Chat.WeekDays[wd][authorUser] = struct{}{}
 	}
 
 	if len(weekDays) == 0 {
 		return "no days", nil
 	}
 
-	for day, users := range e.Chat.WeekDays {
-		if _, ok := weekDays[day]; !ok {
-			delete(users, authorUser)
-
-			// no other users in current day
-			if len(users) == 0 {
-				delete(e.Chat.WeekDays, day)
-			}
-		}
-	}
-
-	if err := e.Chat.Update(ctx, e.Cfg.DB); err != nil {
+	if err := e.Chat.SaveWeekDays(ctx, e.Cfg.DB, authorUser, weekDays); err != nil {
 		return "", fmt.Errorf("can't handle command: %v", err)
 	}
 
@@ -519,7 +1121,7 @@ func extendNoDays(ctx context.Context, authorUser string, e *Event) (string, err
 
 func NoDays(ctx context.Context, e *Event) error {
 	var (
-		authorUser = e.ChatEvent.Payload.From.User.ID
+		authorUser = e.ChatEvent.From.ID
 		msg        = "days are cleaned"
 		err        error
 	)
@@ -536,3 +1138,396 @@ func NoDays(ctx context.Context, e *Event) error {
 
 	return e.SendMessage(fmt.Sprintf("@[%s] %s", authorUser, msg))
 }
+
+// parseWeekDays parses week days numbers (0-6, from Sunday to Saturday) and their ranges like "1-5".
+// Items can be separated by spaces or commas.
+func parseWeekDays(value string) (map[time.Weekday]struct{}, error) {
+	var (
+		days             = make(map[time.Weekday]struct{})
+		sunday, saturday = int(time.Sunday), int(time.Saturday)
+	)
+
+	items := strings.FieldsFunc(value, func(r rune) bool {
+		return r == ' ' || r == ','
+	})
+
+	for _, item := range items {
+		first, last, isRange := strings.Cut(item, "-")
+		if !isRange {
+			last = first
+		}
+
+		from, errFrom := strconv.Atoi(first)
+		to, errTo := strconv.Atoi(last)
+
+		if errFrom != nil || errTo != nil || from < sunday || to > saturday || from > to {
+			return nil, fmt.Errorf("incorrect week days %q, use numbers from sunday=%d to saturday=%d", item, sunday, saturday)
+		}
+
+		for i := from; i <= to; i++ {
+			days[time.Weekday(i)] = struct{}{}
+		}
+	}
+
+	return days, nil
+}
+
+// parseSchedule parses schedule arguments "HH:MM [days]", empty days mean every day.
+func parseSchedule(chatID, value string) (*db.Schedule, error) {
+	clock, days, _ := strings.Cut(strings.TrimSpace(value), " ")
+
+	ts, err := time.Parse("15:04", clock)
+	if err != nil {
+		return nil, fmt.Errorf("incorrect time %q, use HH:MM", clock)
+	}
+
+	weekDays, err := parseWeekDays(days)
+	if err != nil {
+		return nil, err
+	}
+
+	return db.NewSchedule(chatID, ts.Hour(), ts.Minute(), weekDays), nil
+}
+
+// Schedule sets, removes or shows a schedule of automatic "/go" posts for the chat.
+func Schedule(ctx context.Context, e *Event) error {
+	switch arg := strings.TrimSpace(e.Arguments); arg {
+	case "":
+		s, err := db.GetSchedule(ctx, e.Cfg.DB, e.Chat.ID)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return e.SendMessage("no schedule for this chat")
+			}
+			return err
+		}
+		return e.SendMessage(fmt.Sprintf("schedule: %s (%s)", s, e.Location()))
+	case "off":
+		ok, err := db.DeleteSchedule(ctx, e.Cfg.DB, e.Chat.ID)
+		if err != nil {
+			return fmt.Errorf("can't handle command: %v", err)
+		}
+		if !ok {
+			return e.SendMessage("no schedule for this chat")
+		}
+		return e.SendMessage("schedule is removed")
+	default:
+		s, err := parseSchedule(e.Chat.ID, arg)
+		if err != nil {
+			return e.SendMessage(err.Error())
+		}
+
+		if err = s.Save(ctx, e.Cfg.DB); err != nil {
+			return fmt.Errorf("can't handle command: %v", err)
+		}
+		return e.SendMessage(fmt.Sprintf("schedule is set: %s (%s)", s, e.Location()))
+	}
+}
+
+// Timezone sets, resets or shows the chat's timezone.
+// It's used for week days, skip and vacation dates, and schedules of the chat.
+func Timezone(ctx context.Context, e *Event) error {
+	switch arg := strings.TrimSpace(e.Arguments); arg {
+	case "":
+		if e.Chat.Timezone == "" {
+			return e.SendMessage(fmt.Sprintf("timezone: %s (default)", e.Cfg.Timezone))
+		}
+		return e.SendMessage("timezone: " + e.Chat.Timezone)
+	case "reset":
+		e.Chat.Timezone = ""
+	default:
+		loc, err := time.LoadLocation(arg)
+		if err != nil || arg == "Local" {
+			return e.SendMessage(fmt.Sprintf("unknown timezone %q, use IANA name like Europe/Moscow", arg))
+		}
+		e.Chat.Timezone = loc.String()
+	}
+
+	if err := e.Chat.Update(ctx, e.Cfg.DB); err != nil {
+		return fmt.Errorf("can't handle command: %v", err)
+	}
+
+	return e.SendMessage(fmt.Sprintf("timezone is set: %s, current time %s", e.Location(), e.Now().Format("15:04")))
+}
+
+// Prompt returns the chat's system prompt of AI commands or the default one.
+func (e *Event) Prompt() string {
+	if e.Chat.Prompt != "" {
+		return e.Chat.Prompt
+	}
+
+	return e.Cfg.AI.Prompt
+}
+
+// Prompt sets, shows or resets the chat's system prompt of AI commands.
+func Prompt(ctx context.Context, e *Event) error {
+	const maxPromptLength = 2000
+
+	command, text := splitArguments(strings.TrimSpace(e.Arguments))
+	text = strings.TrimSpace(text)
+
+	switch command {
+	case "", "show":
+		switch {
+		case e.Chat.Prompt != "":
+			return e.SendMessage("prompt: " + e.Chat.Prompt)
+		case e.Cfg.AI.Prompt != "":
+			return e.SendMessage("prompt (default): " + e.Cfg.AI.Prompt)
+		default:
+			return e.SendMessage("no prompt")
+		}
+	case "set":
+		if text == "" {
+			return e.SendMessage("no prompt text")
+		}
+
+		if n := utf8.RuneCountInString(text); n > maxPromptLength {
+			return e.SendMessage(fmt.Sprintf("prompt is too long, %d characters, maximum is %d", n, maxPromptLength))
+		}
+
+		e.Chat.Prompt = text
+	case "reset":
+		e.Chat.Prompt = ""
+	default:
+		return e.SendMessage("unknown argument, use: set <text>, show or reset")
+	}
+
+	if err := e.Chat.Update(ctx, e.Cfg.DB); err != nil {
+		return fmt.Errorf("can't handle command: %v", err)
+	}
+
+	if e.Chat.Prompt == "" {
+		return e.SendMessage("prompt is reset to default")
+	}
+
+	return e.SendMessage("prompt is set")
+}
+
+// splitArguments returns the first word of arguments and the rest text.
+func splitArguments(arguments string) (string, string) {
+	if i := strings.IndexFunc(arguments, unicode.IsSpace); i > 0 {
+		return arguments[:i], arguments[i:]
+	}
+
+	return arguments, ""
+}
+
+// aiOptions returns the chat's completion options of AI provider.
+func (e *Event) aiOptions(provider string) llm.Options {
+	o := e.Chat.AIOptions[provider]
+	return llm.Options{Model: o.Model, MaxTokens: o.MaxTokens, Temperature: o.Temperature}
+}
+
+// providerOptions returns the chat's options of the provider or defaults if they are not allowed anymore.
+func (e *Event) providerOptions(provider llm.Provider) llm.Options {
+	options := e.aiOptions(provider.Name())
+
+	if err := llm.Check(provider, options); err != nil {
+		// provider's configuration was changed after the chat's choice
+		return llm.Options{}
+	}
+
+	return options
+}
+
+// describeOptions returns a human-readable description of provider's options.
+func describeOptions(provider string, o llm.Options) string {
+	temperature, maxTokens := "default", "default"
+
+	if o.Temperature != nil {
+		temperature = strconv.FormatFloat(float64(*o.Temperature), 'g', -1, 32)
+	}
+
+	if o.MaxTokens > 0 {
+		maxTokens = strconv.Itoa(o.MaxTokens)
+	}
+
+	return fmt.Sprintf("%s: %s, temperature %s, max tokens %s", provider, o.Model, temperature, maxTokens)
+}
+
+// parseAIOptions returns the options changed by arguments: model name, "reset",
+// "temperature=N" or "max_tokens=N".
+func parseAIOptions(options db.AIOptions, arguments []string) (db.AIOptions, error) {
+	for _, arg := range arguments {
+		key, value, ok := strings.Cut(arg, "=")
+
+		switch {
+		case !ok && arg == "reset":
+			options = db.AIOptions{}
+		case !ok:
+			options.Model = arg
+		case key == "temperature":
+			t, err := strconv.ParseFloat(value, 32)
+			if err != nil {
+				return options, fmt.Errorf("incorrect temperature %q", value)
+			}
+			temperature := float32(t)
+			options.Temperature = &temperature
+		case key == "max_tokens":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return options, fmt.Errorf("incorrect max tokens %q", value)
+			}
+			options.MaxTokens = n
+		default:
+			return options, fmt.Errorf("unknown option %q, use: temperature=N, max_tokens=N", key)
+		}
+	}
+
+	return options, nil
+}
+
+// Model sets or shows the chat's model, temperature and max tokens of AI providers.
+func Model(ctx context.Context, e *Event) error {
+	names := e.Cfg.LLM.Names()
+	if len(names) == 0 {
+		return e.SendMessage("no AI providers")
+	}
+
+	args := strings.Fields(e.Arguments)
+	if len(args) == 0 {
+		lines := make([]string, 0, len(names))
+		for _, name := range names {
+			provider, _ := e.Cfg.LLM.Get(name)
+			lines = append(lines, describeOptions(name, e.aiOptions(name).Merge(provider.Defaults())))
+		}
+		return e.SendMessage(strings.Join(lines, "\n"))
+	}
+
+	name := args[0]
+	provider, ok := e.Cfg.LLM.Get(name)
+	if !ok {
+		return e.SendMessage(fmt.Sprintf("unknown provider %q, use: %s", name, strings.Join(names, ", ")))
+	}
+
+	if len(args) == 1 {
+		description := describeOptions(name, e.aiOptions(name).Merge(provider.Defaults()))
+		return e.SendMessage(description + "\nmodels: " + strings.Join(provider.Models(), ", "))
+	}
+
+	options, err := parseAIOptions(e.Chat.AIOptions[name], args[1:])
+	if err != nil {
+		return e.SendMessage(err.Error())
+	}
+
+	llmOptions := llm.Options{Model: options.Model, MaxTokens: options.MaxTokens, Temperature: options.Temperature}
+	if err = llm.Check(provider, llmOptions); err != nil {
+		return e.SendMessage(err.Error())
+	}
+
+	e.Chat.SetAIOptions(name, options)
+	if err = e.Chat.Update(ctx, e.Cfg.DB); err != nil {
+		return fmt.Errorf("can't handle command: %v", err)
+	}
+
+	return e.SendMessage("model is set: " + describeOptions(name, llmOptions.Merge(provider.Defaults())))
+}
+
+// Order sets or shows the chat's ordering strategy of "/go" command.
+func Order(ctx context.Context, e *Event) error {
+	arg := strings.TrimSpace(e.Arguments)
+	if arg == "" {
+		mode, err := order.Parse(e.Chat.Order)
+		if err != nil {
+			mode = order.Random
+		}
+		return e.SendMessage(fmt.Sprintf("order: %s", mode))
+	}
+
+	mode, err := order.Parse(arg)
+	if err != nil {
+		names := make([]string, 0, len(order.Modes))
+		for _, m := range order.Modes {
+			names = append(names, string(m))
+		}
+		return e.SendMessage(fmt.Sprintf("%v, use: %s", err, strings.Join(names, ", ")))
+	}
+
+	e.Chat.Order = string(mode)
+	if err = e.Chat.Update(ctx, e.Cfg.DB); err != nil {
+		return fmt.Errorf("can't handle command: %v", err)
+	}
+
+	return e.SendMessage(fmt.Sprintf("order is set: %s", mode))
+}
+
+// parseLimit returns a positive number from arguments, defaultValue if they are empty, or an error.
+func parseLimit(value string, defaultValue, maxValue int) (int, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return defaultValue, nil
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 || n > maxValue {
+		return 0, fmt.Errorf("incorrect number %q, it must be from 1 to %d", value, maxValue)
+	}
+
+	return n, nil
+}
+
+// History shows recent results of "/go" command.
+// User identifiers are not mentions, so members are not notified.
+func History(ctx context.Context, e *Event) error {
+	const defaultItems, maxItems = 5, 20
+
+	n, err := parseLimit(e.Arguments, defaultItems, maxItems)
+	if err != nil {
+		return e.SendMessage(err.Error())
+	}
+
+	items, err := db.History(ctx, e.Cfg.DB, e.Chat.ID, n)
+	if err != nil {
+		return fmt.Errorf("can't get history: %v", err)
+	}
+
+	if len(items) == 0 {
+		return e.SendMessage("no history")
+	}
+
+	var (
+		b   strings.Builder
+		loc = e.Location()
+	)
+
+	for _, item := range items {
+		author := "schedule"
+		if item.Author != "" {
+			author = item.Author
+		}
+
+		b.WriteString(fmt.Sprintf(
+			"%s (%s): %s\n",
+			item.Created.In(loc).Format("2006-01-02 15:04"), author, strings.Join(item.Users, ", "),
+		))
+	}
+
+	return e.SendMessage(strings.TrimSuffix(b.String(), "\n"))
+}
+
+// Stats shows users' first and last positions statistics of "/go" results for a number of days.
+func Stats(ctx context.Context, e *Event) error {
+	const defaultDays, maxDays = 30, 366
+
+	days, err := parseLimit(e.Arguments, defaultDays, maxDays)
+	if err != nil {
+		return e.SendMessage(err.Error())
+	}
+
+	items, err := db.HistorySince(ctx, e.Cfg.DB, e.Chat.ID, e.Now().AddDate(0, 0, -days))
+	if err != nil {
+		return fmt.Errorf("can't get history: %v", err)
+	}
+
+	if len(items) == 0 {
+		return e.SendMessage("no history")
+	}
+
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("stats for %d days, results: %d", days, len(items)))
+
+	for _, s := range db.Stats(items) {
+		b.WriteString(fmt.Sprintf("\n%s - first: %d, last: %d, total: %d", s.UserID, s.First, s.Last, s.Total))
+	}
+
+	return e.SendMessage(b.String())
+}
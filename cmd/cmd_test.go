@@ -2,18 +2,25 @@ package cmd
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"maps"
 	"net/http"
 	"net/http/httptest"
+	"slices"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	botgolang "github.com/mail-ru-im/bot-golang"
 
+	"github.com/z0rr0/gobot/botapitest"
 	"github.com/z0rr0/gobot/config"
 	"github.com/z0rr0/gobot/db"
+	"github.com/z0rr0/gobot/llm"
+	"github.com/z0rr0/gobot/markup"
+	"github.com/z0rr0/gobot/transport"
 )
 
 const (
@@ -33,29 +40,52 @@ var (
 	defaultCtx = context.Background()
 )
 
-func TestStart(t *testing.T) {
-	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		response := "{\"msgId\": \"7083436385855602743\", \"ok\": true}"
-		_, err := fmt.Fprint(w, response)
-		if err != nil {
-			t.Error(err)
-		}
-	})
-	s := httptest.NewServer(handler)
-	defer s.Close()
-	c, err := config.New(configPath, buildInfo, s)
+// newTestConfig returns a configuration with the fake bot API server, they are closed after the test.
+func newTestConfig(t *testing.T) (*config.Config, *botapitest.Server) {
+	s := botapitest.NewServer()
+
+	c, err := config.New(configPath, buildInfo, s.Server)
 	if err != nil {
+		s.Close()
 		t.Fatalf("config.New: %v", err)
 	}
-	defer func() {
+
+	t.Cleanup(func() {
 		if errCfg := c.Close(); errCfg != nil {
 			t.Error(errCfg)
 		}
-	}()
+		s.Close()
+	})
+
+	return c, s
+}
+
+// botMessages reads texts of messages which are sent by the bot to the chat.
+type botMessages struct {
+	s      *botapitest.Server
+	chatID string
+	read   int // number of already read messages
+}
+
+// next returns texts of messages which are sent after the previous call, they are joined by new lines.
+func (m *botMessages) next() string {
+	messages := m.s.Messages(m.chatID)
+	texts := make([]string, 0, len(messages))
+
+	for _, msg := range messages[m.read:] {
+		texts = append(texts, msg.Text)
+	}
+
+	m.read = len(messages)
+	return strings.Join(texts, "\n")
+}
+
+func TestStart(t *testing.T) {
+	c, s := newTestConfig(t)
 	chat := &db.Chat{ID: "TestStart"}
-	e := &Event{Cfg: c, ChatEvent: &botgolang.Event{}, Chat: chat, debug: true}
-	if err = Start(defaultCtx, e); err != nil {
+	sent := &botMessages{s: s, chatID: chat.ID}
+	e := &Event{Cfg: c, ChatEvent: &transport.Event{}, Chat: chat}
+	if err := Start(defaultCtx, e); err != nil {
 		t.Errorf("Start: %v", err)
 	}
 	if !chat.Saved {
@@ -65,43 +95,25 @@ func TestStart(t *testing.T) {
 		t.Error("chat.Active = false")
 	}
 	expected := "started"
-	if msg := e.buffer.String(); msg != expected {
+	if msg := sent.next(); msg != expected {
 		t.Errorf("failed bot response='%s', want='%s'", msg, expected)
 	}
-	e.buffer.Reset()
-	if err = Start(defaultCtx, e); err != nil {
+	if err := Start(defaultCtx, e); err != nil {
 		t.Errorf("Start: %v", err)
 	}
 	expected = "already started"
-	if msg := e.buffer.String(); msg != expected {
+	if msg := sent.next(); msg != expected {
 		t.Errorf("failed bot response='%s', want='%s'", msg, expected)
 	}
 }
 
 func TestStop(t *testing.T) {
-	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		response := "{\"msgId\": \"7083436385855602743\", \"ok\": true}"
-		_, err := fmt.Fprint(w, response)
-		if err != nil {
-			t.Error(err)
-		}
-	})
-	s := httptest.NewServer(handler)
-	defer s.Close()
-	c, err := config.New(configPath, buildInfo, s)
-	if err != nil {
-		t.Fatalf("config.New: %v", err)
-	}
-	defer func() {
-		if errCfg := c.Close(); errCfg != nil {
-			t.Error(errCfg)
-		}
-	}()
+	c, s := newTestConfig(t)
 	chat := &db.Chat{ID: "TestStop"}
-	e := &Event{Cfg: c, ChatEvent: &botgolang.Event{}, Chat: chat, debug: true}
+	sent := &botMessages{s: s, chatID: chat.ID}
+	e := &Event{Cfg: c, ChatEvent: &transport.Event{}, Chat: chat}
 	// stop for not saved chat
-	if err = Stop(defaultCtx, e); err != nil {
+	if err := Stop(defaultCtx, e); err != nil {
 		t.Errorf("Stop: %v", err)
 	}
 	if chat.Saved {
@@ -111,60 +123,41 @@ func TestStop(t *testing.T) {
 		t.Error("chat.Active = true")
 	}
 	expected := "already stopped"
-	if msg := e.buffer.String(); msg != expected {
+	if msg := sent.next(); msg != expected {
 		t.Errorf("failed bot response='%s', want='%s'", msg, expected)
 	}
-	e.buffer.Reset()
 	// create active db record and stop it
 	chat.Active = true
-	if err = e.Chat.Update(defaultCtx, c.DB); err != nil {
+	if err := e.Chat.Update(defaultCtx, c.DB); err != nil {
 		t.Errorf("e.Chat.Update: %v", err)
 	}
-	if err = Stop(defaultCtx, e); err != nil {
+	if err := Stop(defaultCtx, e); err != nil {
 		t.Errorf("Stop: %v", err)
 	}
 	if chat.Active {
 		t.Error("chat.Active = true")
 	}
 	expected = "stopped"
-	if msg := e.buffer.String(); msg != expected {
+	if msg := sent.next(); msg != expected {
 		t.Errorf("failed bot response='%s', want='%s'", msg, expected)
 	}
 }
 
 func TestVersion(t *testing.T) {
-	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		response := "{\"msgId\": \"7083436385855602743\", \"ok\": true}"
-		_, err := fmt.Fprint(w, response)
-		if err != nil {
-			t.Error(err)
-		}
-	})
-	s := httptest.NewServer(handler)
-	defer s.Close()
-	c, err := config.New(configPath, buildInfo, s)
-	if err != nil {
-		t.Fatalf("config.New: %v", err)
-	}
-	defer func() {
-		if errCfg := c.Close(); errCfg != nil {
-			t.Error(errCfg)
-		}
-	}()
+	c, s := newTestConfig(t)
 	chat := &db.Chat{ID: "TestVersion"}
-	e := &Event{Cfg: c, ChatEvent: &botgolang.Event{}, Chat: chat, debug: true}
-	if err = Version(defaultCtx, e); err != nil {
+	sent := &botMessages{s: s, chatID: chat.ID}
+	e := &Event{Cfg: c, ChatEvent: &transport.Event{}, Chat: chat}
+	if err := Version(defaultCtx, e); err != nil {
 		t.Errorf("Version: %v", err)
 	}
 	expected := fmt.Sprintf(
 		"%v %v\nRevision: %v\nGo version: %v\nBuild time: %v",
 		buildInfo.Name, buildInfo.Hash, buildInfo.Revision, buildInfo.GoVersion, buildInfo.Date,
 	)
-	if msg := e.buffer.String(); msg != expected {
+	if msg := sent.next(); msg != expected {
 		t.Errorf("failed bot response='%s', want='%s'", msg, expected)
 	}
-	e.buffer.Reset()
 	// build info without URL
 	e.Cfg.BuildInfo = &config.BuildInfo{
 		Name:      buildInfo.Name,
@@ -173,25 +166,27 @@ func TestVersion(t *testing.T) {
 		GoVersion: buildInfo.GoVersion,
 		Date:      buildInfo.Date,
 	}
-	if err = Version(defaultCtx, e); err != nil {
+	if err := Version(defaultCtx, e); err != nil {
 		t.Errorf("Version: %v", err)
 	}
-	if msg := e.buffer.String(); msg != expected {
+	if msg := sent.next(); msg != expected {
 		t.Errorf("failed bot response='%s', want='%s'", msg, expected)
 	}
 }
 
-func TestGPT(t *testing.T) {
-	botServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		response := "{\"msgId\": \"7083436385855602743\", \"ok\": true}"
-		_, err := fmt.Fprint(w, response)
-		if err != nil {
-			t.Error(err)
-		}
-	}))
-	defer botServer.Close()
+// setProvider replaces configured AI providers by the one with the test server.
+func setProvider(t *testing.T, c *config.Config, cfg llm.Config, server *httptest.Server) {
+	provider, err := llm.New(cfg, server.Client())
+	if err != nil {
+		t.Fatalf("llm.New: %v", err)
+	}
 
+	if c.LLM, err = llm.NewRegistry(provider); err != nil {
+		t.Fatalf("llm.NewRegistry: %v", err)
+	}
+}
+
+func TestGPT(t *testing.T) {
 	gptServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 		response := `{"id":"test","object":"chat.completion","created":1677652288,` +
@@ -204,44 +199,198 @@ func TestGPT(t *testing.T) {
 	}))
 	defer gptServer.Close()
 
-	c, err := config.New(configPath, buildInfo, botServer)
-	if err != nil {
-		t.Fatalf("config.New: %v", err)
-	}
-	defer func() {
-		if errCfg := c.Close(); errCfg != nil {
-			t.Error(errCfg)
-		}
-	}()
-	c.G.Bearer = "test"
-	c.G.URL = gptServer.URL
-	c.G.Client = gptServer.Client()
+	c, s := newTestConfig(t)
+	setProvider(t, c, llm.Config{Name: providerGPT, URL: gptServer.URL, Token: "test", Models: []string{"gpt-4o-mini"}}, gptServer)
 
 	chat := &db.Chat{ID: "TestGPT", GPT: true}
-	e := &Event{Cfg: c, ChatEvent: &botgolang.Event{}, Chat: chat, Arguments: "request", debug: true}
-	if err = GPT(defaultCtx, e); err != nil {
+	sent := &botMessages{s: s, chatID: chat.ID}
+	e := &Event{Cfg: c, ChatEvent: &transport.Event{}, Chat: chat, Arguments: "request"}
+	if err := GPT(defaultCtx, e); err != nil {
 		t.Errorf("GPT: %v", err)
 	}
 
-	if msg := e.buffer.String(); msg != "Hi, it is ChatGPT!" {
+	if msg := sent.next(); msg != "Hi, it is ChatGPT!" {
 		t.Errorf("failed bot response=%q", msg)
 	}
 }
 
-func TestYandexGPT(t *testing.T) {
-	botServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+func TestGPTStream(t *testing.T) {
+	gptServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		chunks := []string{
+			`{"choices":[{"index":0,"delta":{"content":"a"}}]}`,
+			`{"choices":[{"index":0,"delta":{"content":" < b"},"finish_reason":"stop"}]}`,
+			`{"choices":[],"usage":{"total_tokens":48}}`,
+			"[DONE]",
+		}
+
+		for _, chunk := range chunks {
+			if _, err := fmt.Fprintf(w, "data: %s\n\n", chunk); err != nil {
+				t.Error(err)
+			}
+			w.(http.Flusher).Flush()
+		}
+	}))
+	defer gptServer.Close()
+
+	c, s := newTestConfig(t)
+	c.AI.Markup = markup.HTML
+	llmCfg := llm.Config{Name: providerGPT, URL: gptServer.URL, Token: "test", Models: []string{"gpt-4o-mini"}, Stream: true}
+	setProvider(t, c, llmCfg, gptServer)
+
+	interval := streamInterval
+	streamInterval = 0
+	defer func() {
+		streamInterval = interval
+	}()
+
+	chat := &db.Chat{ID: "TestGPTStream", GPT: true}
+	if _, err := db.DeleteAIMessages(defaultCtx, c.DB, chat.ID, providerGPT); err != nil {
+		t.Fatalf("DeleteAIMessages: %v", err)
+	}
+
+	e := &Event{Cfg: c, ChatEvent: &transport.Event{}, Chat: chat, Arguments: "request"}
+	if err := GPT(defaultCtx, e); err != nil {
+		t.Fatalf("GPT: %v", err)
+	}
+
+	var messages []string
+	for _, r := range s.Requests() {
+		if method, ok := strings.CutPrefix(r.Method, "/messages/"); ok {
+			messages = append(messages, method+":"+r.Params.Get("parseMode")+":"+r.Params.Get("text"))
+		}
+	}
+
+	expected := []string{"sendText::thinking…", "editText::a", "editText::a < b", "editText:HTML:a &lt; b"}
+	if !slices.Equal(messages, expected) {
+		t.Errorf("failed messages %q, want %q", messages, expected)
+	}
+
+	sent := s.Messages(chat.ID)
+	if n := len(sent); n != 1 || sent[0].Text != "a &lt; b" || sent[0].ParseMode != "HTML" || sent[0].Edits != 3 {
+		t.Errorf("failed sent messages %+v", sent)
+	}
+
+	history, err := db.AIMessages(defaultCtx, c.DB, chat.ID, providerGPT, 10)
+	if err != nil {
+		t.Fatalf("AIMessages: %v", err)
+	}
+
+	if n := len(history); n != 2 || history[1].Content != "a < b" {
+		t.Errorf("failed conversation %v", history)
+	}
+}
+
+func TestStreamMessageEmpty(t *testing.T) {
+	c, s := newTestConfig(t)
+	chat := &db.Chat{ID: "TestStreamMessageEmpty", GPT: true}
+	e := &Event{Cfg: c, ChatEvent: &transport.Event{}, Chat: chat}
+
+	placeholder, err := e.sendPlaceholder()
+	if err != nil {
+		t.Fatalf("sendPlaceholder: %v", err)
+	}
+
+	if err = placeholder.finish(" \n "); err != nil {
+		t.Fatalf("finish: %v", err)
+	}
+
+	sent := s.Messages(chat.ID)
+	if n := len(sent); n != 1 || sent[0].Text != streamEmpty || sent[0].Edits != 1 {
+		t.Errorf("failed sent messages %+v", sent)
+	}
+}
+
+func TestGPTFallback(t *testing.T) {
+	var attempts int
+	gptServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
 		w.Header().Set("Content-Type", "application/json")
-		response := "{\"msgId\": \"7083436385855602743\", \"ok\": true}"
-		_, err := fmt.Fprint(w, response)
-		if err != nil {
-			t.Error(err)
+		w.WriteHeader(http.StatusTooManyRequests)
+
+		if _, err := fmt.Fprint(w, `{"error":{"message":"rate limit","type":"requests"}}`); err != nil {
+			panic(err)
 		}
 	}))
-	defer botServer.Close()
+	defer gptServer.Close()
+
+	dsServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		response := `{"choices":[{"index":0,"message":{"content":"answer"},"finish_reason":"stop"}],` +
+			`"usage":{"prompt_tokens":30,"completion_tokens":10,"total_tokens":40}}`
+
+		if _, err := fmt.Fprint(w, response); err != nil {
+			panic(err)
+		}
+	}))
+	defer dsServer.Close()
+
+	c, s := newTestConfig(t)
+
+	gpt, err := llm.New(llm.Config{Name: providerGPT, URL: gptServer.URL, Models: []string{"gpt-4o-mini"}}, nil)
+	if err != nil {
+		t.Fatalf("llm.New: %v", err)
+	}
+
+	ds, err := llm.New(llm.Config{Name: providerDeepSeek, URL: dsServer.URL, Models: []string{"deepseek-chat"}}, nil)
+	if err != nil {
+		t.Fatalf("llm.New: %v", err)
+	}
+
+	if c.LLM, err = llm.NewRegistry(gpt, ds); err != nil {
+		t.Fatalf("llm.NewRegistry: %v", err)
+	}
+	c.AI.Retries = 2
+	c.AI.RetryDelay = 0.001
 
+	chat := &db.Chat{ID: "TestGPTFallback", GPT: true}
+	sent := &botMessages{s: s, chatID: chat.ID}
+	if _, err := db.DeleteAIMessages(defaultCtx, c.DB, chat.ID, providerGPT); err != nil {
+		t.Fatalf("DeleteAIMessages: %v", err)
+	}
+
+	// no fallback chain, only retries
+	e := &Event{Cfg: c, ChatEvent: &transport.Event{}, Chat: chat, Arguments: "request"}
+	if err := GPT(defaultCtx, e); !llm.IsTransient(err) {
+		t.Errorf("expected transient error, got %v", err)
+	}
+
+	if attempts != 3 {
+		t.Errorf("failed attempts %d", attempts)
+	}
+
+	attempts = 0
+	c.AI.Fallback = []string{providerYandex, providerGPT, providerDeepSeek}
+
+	if err := GPT(defaultCtx, e); err != nil {
+		t.Fatalf("GPT: %v", err)
+	}
+
+	if attempts != 3 {
+		t.Errorf("failed attempts %d", attempts)
+	}
+
+	if msg := sent.next(); msg != "answer\n\n(answered by ds)" {
+		t.Errorf("failed bot response=%q", msg)
+	}
+
+	history, err := db.AIMessages(defaultCtx, c.DB, chat.ID, providerGPT, 10)
+	if err != nil {
+		t.Fatalf("AIMessages: %v", err)
+	}
+
+	if n := len(history); n != 2 || history[1].Content != "answer" {
+		t.Errorf("failed conversation %v", history)
+	}
+}
+
+func TestGPTCache(t *testing.T) {
+	var requests int
 	gptServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
 		w.Header().Set("Content-Type", "application/json")
-		response := `{"result":{"message":{"role":"Ассистент","text":"Меня зовут Алиса"},"num_tokens":"20"}}`
+		response := fmt.Sprintf(`{"choices":[{"index":0,"message":{"content":"answer %d"},"finish_reason":"stop"}],`+
+			`"usage":{"prompt_tokens":30,"completion_tokens":10,"total_tokens":40}}`, requests)
 
 		if _, err := fmt.Fprint(w, response); err != nil {
 			panic(err)
@@ -249,377 +398,634 @@ func TestYandexGPT(t *testing.T) {
 	}))
 	defer gptServer.Close()
 
-	c, err := config.New(configPath, buildInfo, botServer)
-	if err != nil {
-		t.Fatalf("config.New: %v", err)
+	c, s := newTestConfig(t)
+	setProvider(t, c, llm.Config{Name: providerGPT, URL: gptServer.URL, Models: []string{"gpt-4o-mini"}}, gptServer)
+	c.AI.CacheTTL = 3600
+
+	chats := map[string]*db.Chat{
+		"a": {ID: "TestGPTCacheA", GPT: true},
+		"b": {ID: "TestGPTCacheB", GPT: true},
 	}
-	defer func() {
-		if errCfg := c.Close(); errCfg != nil {
-			t.Error(errCfg)
+	sent := make(map[string]*botMessages, len(chats))
+	for name, chat := range chats {
+		if _, err := db.DeleteAIMessages(defaultCtx, c.DB, chat.ID, providerGPT); err != nil {
+			t.Fatalf("DeleteAIMessages: %v", err)
 		}
-	}()
-	c.Y.APIKey = "test"
-	c.Y.URL = gptServer.URL
-	c.Y.Client = gptServer.Client()
+		sent[name] = &botMessages{s: s, chatID: chat.ID}
+	}
 
-	chat := &db.Chat{ID: "TestYandexGPT", GPT: true}
-	e := &Event{Cfg: c, ChatEvent: &botgolang.Event{}, Chat: chat, Arguments: "request", debug: true}
-	if err = YandexGPT(defaultCtx, e); err != nil {
-		t.Errorf("Yandex GPT: %v", err)
+	// the cache is common for all chats, so the question is unique for every run
+	question := fmt.Sprintf("question %d", time.Now().UnixNano())
+	testCases := []struct {
+		chat      string
+		arguments string
+		expected  string
+		requests  int
+	}{
+		{chat: "a", arguments: question, expected: "answer 1", requests: 1},
+		{chat: "b", arguments: question, expected: "answer 1", requests: 1},
+		{chat: "b", arguments: freshFlag + " " + question, expected: "answer 2", requests: 2},
+		// the same follow-up questions after different conversations
+		{chat: "a", arguments: "why?", expected: "answer 3", requests: 3},
+		{chat: "b", arguments: "why?", expected: "answer 4", requests: 4},
+	}
+
+	for i, tc := range testCases {
+		e := &Event{Cfg: c, ChatEvent: &transport.Event{}, Chat: chats[tc.chat], Arguments: tc.arguments}
+		if err := GPT(defaultCtx, e); err != nil {
+			t.Fatalf("GPT: %v", err)
+		}
+
+		if msg := sent[tc.chat].next(); msg != tc.expected {
+			t.Errorf("case %d: failed bot response=%q, want %q", i, msg, tc.expected)
+		}
+
+		if requests != tc.requests {
+			t.Errorf("case %d: failed requests number %d, want %d", i, requests, tc.requests)
+		}
 	}
 
-	if msg := e.buffer.String(); msg != "Меня зовут Алиса" {
-		t.Errorf("failed bot response=%q", msg)
+	history, err := db.AIMessages(defaultCtx, c.DB, chats["a"].ID, providerGPT, c.AI.HistorySize)
+	if err != nil {
+		t.Fatalf("AIMessages: %v", err)
+	}
+
+	if n := len(history); n != 4 || history[3].Content != "answer 3" {
+		t.Errorf("failed conversation %v", history)
 	}
 }
 
-func TestGo(t *testing.T) {
-	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		var url = strings.TrimRight(r.URL.Path, " /")
+func TestGPTConversation(t *testing.T) {
+	var requests [][]llm.Message
+	gptServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request := struct {
+			Messages []llm.Message `json:"messages"`
+		}{}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			panic(err)
+		}
+		requests = append(requests, request.Messages)
+
 		w.Header().Set("Content-Type", "application/json")
-		response := "{\"msgId\": \"7083436385855602743\", \"ok\": true}"
-		if url == "/chats/getMembers" {
-			response = "{\"members\": [{\"userId\": \"1001\"}, {\"creator\": true, \"userId\": \"user1@my.team\"}, " +
-				"{\"userId\": \"1001\"}, {\"creator\": false, \"userId\": \"user2@my.team\"}], \"ok\": true}"
+		response := fmt.Sprintf(`{"id":"test","object":"chat.completion","created":1677652288,`+
+			`"choices":[{"index":0,"message":{"content":"answer %d"},`+
+			`"finish_reason":"stop"}],"usage":{"prompt_tokens":35,"completion_tokens":13,"total_tokens":48}}`,
+			len(requests),
+		)
+
+		if _, err := fmt.Fprint(w, response); err != nil {
+			panic(err)
+		}
+	}))
+	defer gptServer.Close()
+
+	c, s := newTestConfig(t)
+	setProvider(t, c, llm.Config{Name: providerGPT, URL: gptServer.URL, Token: "test", Models: []string{"gpt-4o-mini"}}, gptServer)
+
+	chat := &db.Chat{ID: "TestGPTConversation", GPT: true}
+	sent := &botMessages{s: s, chatID: chat.ID}
+	if _, err := db.DeleteAIMessages(defaultCtx, c.DB, chat.ID, providerGPT); err != nil {
+		t.Fatalf("DeleteAIMessages: %v", err)
+	}
+
+	for _, args := range []string{"first", "second", "reset", "third"} {
+		var (
+			err error
+			e   = &Event{Cfg: c, ChatEvent: &transport.Event{}, Chat: chat, Arguments: args}
+		)
+		if args == "third" {
+			// the same conversation via common AI command
+			e.Arguments = "gpt " + args
+			err = AI(defaultCtx, e)
+		} else {
+			err = GPT(defaultCtx, e)
 		}
-		_, err := fmt.Fprint(w, response)
+
 		if err != nil {
-			t.Error(err)
+			t.Fatalf("GPT %q: %v", args, err)
+		}
+
+		if msg := sent.next(); args == "reset" && msg != "conversation is cleared" {
+			t.Errorf("failed reset response=%q", msg)
 		}
-	})
-	s := httptest.NewServer(handler)
-	defer s.Close()
-	c, err := config.New(configPath, buildInfo, s)
-	if err != nil {
-		t.Fatalf("config.New: %v", err)
 	}
-	defer func() {
-		if errCfg := c.Close(); errCfg != nil {
-			t.Error(errCfg)
+
+	expected := [][]string{
+		{"user:first"},
+		{"user:first", "assistant:answer 1", "user:second"},
+		{"user:third"},
+	}
+	if n := len(requests); n != len(expected) {
+		t.Fatalf("failed requests number %d, expected %d", n, len(expected))
+	}
+
+	for i, request := range requests {
+		messages := make([]string, len(request))
+		for j, m := range request {
+			messages[j] = m.Role + ":" + m.Content
 		}
-	}()
+
+		if !slices.Equal(messages, expected[i]) {
+			t.Errorf("failed request %d messages %v, expected %v", i, messages, expected[i])
+		}
+	}
+}
+
+func TestGPTQuoted(t *testing.T) {
+	var messages []llm.Message
+	gptServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request := struct {
+			Messages []llm.Message `json:"messages"`
+		}{}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			panic(err)
+		}
+		messages = request.Messages
+
+		w.Header().Set("Content-Type", "application/json")
+		response := `{"choices":[{"index":0,"message":{"content":"answer"},"finish_reason":"stop"}]}`
+		if _, err := fmt.Fprint(w, response); err != nil {
+			panic(err)
+		}
+	}))
+	defer gptServer.Close()
+
+	c, _ := newTestConfig(t)
+	setProvider(t, c, llm.Config{Name: providerGPT, URL: gptServer.URL, Models: []string{"gpt-4o-mini"}}, gptServer)
+	c.AI.Prompt = ""
+
+	chat := &db.Chat{ID: "TestGPTQuoted", GPT: true}
+	parts := []botgolang.Part{
+		{Type: botgolang.MENTION, Payload: botgolang.PartPayload{UserID: "user@my.team"}},
+		{
+			Type: botgolang.REPLY,
+			Payload: botgolang.PartPayload{
+				PartMessage: botgolang.PartMessage{
+					From: botgolang.Contact{FirstName: "John", LastName: "Doe"},
+					Text: "long message",
+				},
+			},
+		},
+		{
+			Type: botgolang.FORWARD,
+			Payload: botgolang.PartPayload{
+				PartMessage: botgolang.PartMessage{
+					From: botgolang.Contact{User: botgolang.User{ID: "jane@my.team"}},
+					Text: " forwarded message\n",
+				},
+			},
+		},
+	}
+
+	testCases := []struct {
+		name      string
+		arguments string
+		expected  string
+	}{
+		{
+			name:      "question",
+			arguments: "summarize this",
+			expected: "Quoted message from John Doe:\nlong message\n\n" +
+				"Quoted message from jane@my.team:\nforwarded message\n\nsummarize this",
+		},
+		{
+			name:     "no_arguments",
+			expected: "Quoted message from John Doe:\nlong message\n\nQuoted message from jane@my.team:\nforwarded message",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := db.DeleteAIMessages(defaultCtx, c.DB, chat.ID, providerGPT); err != nil {
+				t.Fatalf("DeleteAIMessages: %v", err)
+			}
+
+			// quotes are converted from VK Teams message parts
+			chatEvent := transport.VKTeamsEvent(&botgolang.Event{Payload: botgolang.EventPayload{Parts: parts}})
+			e := &Event{Cfg: c, ChatEvent: &chatEvent, Chat: chat, Arguments: tc.arguments}
+			if err := GPT(defaultCtx, e); err != nil {
+				t.Fatalf("GPT: %v", err)
+			}
+
+			if n := len(messages); n != 1 {
+				t.Fatalf("failed messages number %d", n)
+			}
+
+			if content := messages[0].Content; content != tc.expected {
+				t.Errorf("failed content %q, want %q", content, tc.expected)
+			}
+		})
+	}
+}
+
+func TestSendLongMessage(t *testing.T) {
+	c, s := newTestConfig(t)
+	c.AI.Markup = markup.HTML
+
+	var (
+		first  = strings.Repeat("a", 3000)
+		second = strings.Repeat("b", 3000)
+		chat   = &db.Chat{ID: "TestSendLongMessage"}
+		e      = &Event{Cfg: c, ChatEvent: &transport.Event{}, Chat: chat}
+	)
+
+	if err := e.SendLongMessage(first + " <x>\n\n" + second); err != nil {
+		t.Fatalf("SendLongMessage: %v", err)
+	}
+
+	messages := s.Messages(chat.ID)
+	expected := []string{first + " &lt;x&gt;", second}
+
+	if n := len(messages); n != len(expected) {
+		t.Fatalf("failed messages number %d, want %d", n, len(expected))
+	}
+
+	for i, m := range messages {
+		if m.Text != expected[i] || m.ParseMode != "HTML" {
+			t.Errorf("failed message %d with parse mode %q", i, m.ParseMode)
+		}
+	}
+}
+
+func TestTrimMessages(t *testing.T) {
+	user := func(content string) db.AIMessage {
+		return db.AIMessage{Role: db.RoleUser, Content: content}
+	}
+	assistant := func(content string) db.AIMessage {
+		return db.AIMessage{Role: db.RoleAssistant, Content: content}
+	}
+	messages := []db.AIMessage{
+		user("abcdef"),       // 2 tokens
+		assistant("abcdef"),  // 2 tokens
+		user("abc"),          // 1 token
+		assistant("abcdefg"), // 3 tokens
+		user("abcd"),         // 2 tokens
+	}
+
+	testCases := []struct {
+		name      string
+		maxTokens int
+		expected  int
+	}{
+		{name: "no_limit", maxTokens: 0, expected: 5},
+		{name: "enough", maxTokens: 10, expected: 5},
+		{name: "one_message", maxTokens: 8, expected: 3},
+		{name: "assistant_first", maxTokens: 6, expected: 3},
+		{name: "last_only", maxTokens: 4, expected: 1},
+		{name: "too_long", maxTokens: 1, expected: 1},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result := trimMessages(messages, tc.maxTokens)
+
+			if n := len(result); n != tc.expected {
+				t.Fatalf("failed messages number %d, expected %d", n, tc.expected)
+			}
+
+			if result[0].Role != db.RoleUser {
+				t.Errorf("failed first message role %q", result[0].Role)
+			}
+
+			if last := result[len(result)-1]; last != messages[len(messages)-1] {
+				t.Errorf("failed last message %v", last)
+			}
+		})
+	}
+}
+
+func TestYandexGPT(t *testing.T) {
+	gptServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		response := `{"result":{"message":{"role":"Ассистент","text":"Меня зовут Алиса"},"num_tokens":"20"}}`
+
+		if _, err := fmt.Fprint(w, response); err != nil {
+			panic(err)
+		}
+	}))
+	defer gptServer.Close()
+
+	c, s := newTestConfig(t)
+	setProvider(t, c, llm.Config{Name: providerYandex, Type: llm.TypeYandex, URL: gptServer.URL, Token: "test"}, gptServer)
+
+	chat := &db.Chat{ID: "TestYandexGPT", GPT: true}
+	sent := &botMessages{s: s, chatID: chat.ID}
+	e := &Event{Cfg: c, ChatEvent: &transport.Event{}, Chat: chat, Arguments: "request"}
+	if err := YandexGPT(defaultCtx, e); err != nil {
+		t.Errorf("Yandex GPT: %v", err)
+	}
+
+	if msg := sent.next(); msg != "Меня зовут Алиса" {
+		t.Errorf("failed bot response=%q", msg)
+	}
+}
+
+func TestGo(t *testing.T) {
+	c, s := newTestConfig(t)
 	chat := &db.Chat{ID: "TestGo", Active: true}
-	e := &Event{Cfg: c, ChatEvent: &botgolang.Event{}, Chat: chat, debug: true}
-	if err = Go(defaultCtx, e); err != nil {
+	sent := &botMessages{s: s, chatID: chat.ID}
+	s.SetMembers(chat.ID, botapitest.BotID, "user1@my.team", "user2@my.team")
+	e := &Event{Cfg: c, ChatEvent: &transport.Event{}, Chat: chat}
+	if err := Go(defaultCtx, e); err != nil {
 		t.Errorf("Go: %v", err)
 	}
 
 	// no users order guarantee, example "1. @[user1@my.team]\n2. @[user2@my.team]"
-	respMsg := e.buffer.String()
+	respMsg := sent.next()
 
 	if n := len(respMsg); !(n == 39 && strings.HasPrefix(respMsg[3:], "@[user")) {
 		t.Errorf("failed bot response [%d] ='%s'", n, respMsg)
 	}
-	e.buffer.Reset()
 
 	// with exclude
 	chat.ExcludeUsers = map[string]struct{}{"user1@my.team": {}}
-	if err = Go(defaultCtx, e); err != nil {
+	if err := Go(defaultCtx, e); err != nil {
 		t.Errorf("Go: %v", err)
 	}
 
 	expected := "1. @[user2@my.team]"
-	if msg := e.buffer.String(); msg != expected {
+	if msg := sent.next(); msg != expected {
 		t.Errorf("failed bot response='%s', want='%s'", msg, expected)
 	}
-	e.buffer.Reset()
 
 	// with url
 	chat.URL = "https://github.com/z0rr0/gobot"
-	if err = Go(defaultCtx, e); err != nil {
+	if err := Go(defaultCtx, e); err != nil {
 		t.Errorf("Go: %v", err)
 	}
 
-	if msg := e.buffer.String(); msg != expected {
+	if msg := sent.next(); msg != expected {
 		t.Errorf("failed bot response='%s', want='%s'", msg, expected)
 	}
 
-	e.buffer.Reset()
 	// all users excluded
 	chat.ExcludeUsers = map[string]struct{}{"user1@my.team": {}, "user2@my.team": {}}
 
-	if err = Go(defaultCtx, e); err != nil {
+	if err := Go(defaultCtx, e); err != nil {
 		t.Errorf("Go: %v", err)
 	}
 	expected = "no users :("
-	if msg := e.buffer.String(); msg != expected {
+	if msg := sent.next(); msg != expected {
+		t.Errorf("failed bot response='%s', want='%s'", msg, expected)
+	}
+
+	// new chat without known members
+	s.SetMembers(chat.ID)
+
+	if err := Go(defaultCtx, e); err != nil {
+		t.Errorf("Go: %v", err)
+	}
+	expected = "no members"
+	if msg := sent.next(); msg != expected {
 		t.Errorf("failed bot response='%s', want='%s'", msg, expected)
 	}
 }
 
-func TestExclude(t *testing.T) {
+func TestGoTelegram(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		texts []string
+	)
 	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
-		response := "{\"msgId\": \"7083436385855602743\", \"ok\": true}"
-		_, err := fmt.Fprint(w, response)
-		if err != nil {
+		response := "{\"ok\": true, \"result\": {\"message_id\": 1, \"chat\": {\"id\": -1}}}"
+
+		switch r.URL.Path {
+		case "/bottoken/getChatAdministrators":
+			response = "{\"ok\": true, \"result\": [" +
+				"{\"user\": {\"id\": 1, \"first_name\": \"Alice\", \"username\": \"alice_user\"}}, " +
+				"{\"user\": {\"id\": 2, \"is_bot\": true, \"first_name\": \"Bot\"}}]}"
+		case "/bottoken/sendMessage":
+			params := make(map[string]string)
+			if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+				t.Error(err)
+			}
+
+			mu.Lock()
+			texts = append(texts, params["text"])
+			mu.Unlock()
+		}
+
+		if _, err := fmt.Fprint(w, response); err != nil {
 			t.Error(err)
 		}
 	})
-	s := httptest.NewServer(handler)
-	defer s.Close()
-	c, err := config.New(configPath, buildInfo, s)
-	if err != nil {
-		t.Fatalf("config.New: %v", err)
-	}
-	defer func() {
-		if errCfg := c.Close(); errCfg != nil {
-			t.Error(errCfg)
+	tgServer := httptest.NewServer(handler)
+	defer tgServer.Close()
+
+	// the same commands work with Telegram Bot API
+	c, _ := newTestConfig(t)
+	c.Messenger = transport.NewTelegram(tgServer.URL, "token", 1, tgServer.Client(), c.DB)
+	chat := &db.Chat{ID: "TestGoTelegram", Active: true}
+	chatEvent := &transport.Event{ChatID: chat.ID, From: transport.User{ID: "1", FirstName: "Alice"}}
+
+	for _, f := range []func(context.Context, *Event) error{Go, Skip, Go} {
+		e := &Event{Cfg: c, ChatEvent: chatEvent, Chat: chat}
+		if err := f(defaultCtx, e); err != nil {
+			t.Fatal(err)
 		}
-	}()
+	}
+
+	expected := []string{"1. @alice_user", "@alice_user ok, you will be skipped today", "no users :("}
+	if result := strings.Join(texts, ";"); result != strings.Join(expected, ";") {
+		t.Errorf("failed messages=%q, want=%q", texts, expected)
+	}
+}
+
+func TestExclude(t *testing.T) {
+	c, s := newTestConfig(t)
 	chat := &db.Chat{ID: "TestExclude"}
-	e := &Event{Cfg: c, ChatEvent: &botgolang.Event{}, Chat: chat, debug: true}
-	if err = Exclude(defaultCtx, e); err != nil {
+	sent := &botMessages{s: s, chatID: chat.ID}
+	e := &Event{Cfg: c, ChatEvent: &transport.Event{}, Chat: chat}
+	if err := Exclude(defaultCtx, e); err != nil {
 		t.Errorf("Exclude: %v", err)
 	}
 	expected := "no excluded users"
-	if msg := e.buffer.String(); msg != expected {
+	if msg := sent.next(); msg != expected {
 		t.Errorf("failed bot response='%s', want='%s'", msg, expected)
 	}
-	e.buffer.Reset()
 	// show excluded
 	chat.ExcludeUsers = map[string]struct{}{"user1@my.team": {}, "user2@my.team": {}}
-	if err = Exclude(defaultCtx, e); err != nil {
+	if err := Exclude(defaultCtx, e); err != nil {
 		t.Errorf("Exclude: %v", err)
 	}
 	expected = "@[user1@my.team]\n@[user2@my.team]"
-	if msg := e.buffer.String(); msg != expected {
+	if msg := sent.next(); msg != expected {
 		t.Errorf("failed bot response='%s', want='%s'", msg, expected)
 	}
-	e.buffer.Reset()
 	// set incorrect value
 	e.Arguments = "set user user3@my.team ok?"
-	if err = Exclude(defaultCtx, e); err != nil {
+	if err := Exclude(defaultCtx, e); err != nil {
 		t.Errorf("Exclude: %v", err)
 	}
 	expected = "no user IDs in arguments"
-	if msg := e.buffer.String(); msg != expected {
+	if msg := sent.next(); msg != expected {
 		t.Errorf("failed bot response='%s', want='%s'", msg, expected)
 	}
-	e.buffer.Reset()
 	// set excluded user
 	e.Arguments = "set user @[user3@my.team], ok?"
-	if err = Exclude(defaultCtx, e); err != nil {
+	if err := Exclude(defaultCtx, e); err != nil {
 		t.Errorf("Exclude: %v", err)
 	}
 	expected = "success"
-	if msg := e.buffer.String(); msg != expected {
+	if msg := sent.next(); msg != expected {
 		t.Errorf("failed bot response='%s', want='%s'", msg, expected)
 	}
 	expectedExcluded := map[string]struct{}{"user1@my.team": {}, "user2@my.team": {}, "user3@my.team": {}}
 	if !maps.Equal(expectedExcluded, chat.ExcludeUsers) {
 		t.Error("failed compare excluded users")
 	}
-	expected = "[\"user1@my.team\",\"user2@my.team\",\"user3@my.team\"]"
-	if chat.Exclude != expected {
-		t.Errorf("failed chat.Exclude='%s', want='%s'", chat.Exclude, expected)
+	chats, err := db.StateChats(defaultCtx, c.DB, "user3@my.team", db.StateExcluded)
+	if err != nil {
+		t.Fatalf("db.StateChats: %v", err)
+	}
+	if !slices.Contains(chats, chat.ID) {
+		t.Errorf("failed excluded chats='%v', want '%s'", chats, chat.ID)
 	}
 }
 
 func TestInclude(t *testing.T) {
-	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		var url = strings.TrimRight(r.URL.Path, " /")
-		w.Header().Set("Content-Type", "application/json")
-		response := "{\"msgId\": \"7083436385855602743\", \"ok\": true}"
-		if url == "/chats/getMembers" {
-			response = "{\"members\": [{\"userId\": \"1001\"}, {\"creator\": true, \"userId\": \"user1@my.team\"}, " +
-				"{\"userId\": \"1001\"}, {\"creator\": false, \"userId\": \"user2@my.team\"}], \"ok\": true}"
-		}
-		_, err := fmt.Fprint(w, response)
-		if err != nil {
-			t.Error(err)
-		}
-	})
-	s := httptest.NewServer(handler)
-	defer s.Close()
-	c, err := config.New(configPath, buildInfo, s)
-	if err != nil {
-		t.Fatalf("config.New: %v", err)
-	}
-	defer func() {
-		if errCfg := c.Close(); errCfg != nil {
-			t.Error(errCfg)
-		}
-	}()
+	c, s := newTestConfig(t)
 	chat := &db.Chat{ID: "TestInclude"}
-	e := &Event{Cfg: c, ChatEvent: &botgolang.Event{}, Chat: chat, debug: true}
-	if err = Include(defaultCtx, e); err != nil {
+	sent := &botMessages{s: s, chatID: chat.ID}
+	s.SetMembers(chat.ID, botapitest.BotID, "user1@my.team", "user2@my.team")
+	e := &Event{Cfg: c, ChatEvent: &transport.Event{}, Chat: chat}
+	if err := Include(defaultCtx, e); err != nil {
 		t.Errorf("Exclude: %v", err)
 	}
 	// no users order guarantee, example "1. @[user1@my.team]\n2. @[user2@my.team]"
-	respMsg := e.buffer.String()
+	respMsg := sent.next()
 	if n := len(respMsg); !(n == 39 && strings.HasPrefix(respMsg[3:], "@[user")) {
 		t.Errorf("failed bot response [%d] ='%s'", n, respMsg)
 	}
-	e.buffer.Reset()
 	// no excluded users
 	e.Arguments = "some value"
-	if err = Include(defaultCtx, e); err != nil {
+	if err := Include(defaultCtx, e); err != nil {
 		t.Errorf("Include: %v", err)
 	}
 	expected := "success"
-	if msg := e.buffer.String(); msg != expected {
+	if msg := sent.next(); msg != expected {
 		t.Errorf("failed msg='%s', want='%s'", msg, expected)
 	}
-	e.buffer.Reset()
 	// there are excluded users, but failed argument
 	chat.ExcludeUsers = map[string]struct{}{"user1@my.team": {}, "user2@my.team": {}}
 	e.Arguments = "restore user2, ok?"
-	if err = Include(defaultCtx, e); err != nil {
+	if err := Include(defaultCtx, e); err != nil {
 		t.Errorf("Include: %v", err)
 	}
 	expected = "no user IDs in arguments"
-	if msg := e.buffer.String(); msg != expected {
+	if msg := sent.next(); msg != expected {
 		t.Errorf("failed msg='%s', want='%s'", msg, expected)
 	}
-	e.buffer.Reset()
 	// delete from excluded users
 	chat.ExcludeUsers = map[string]struct{}{"user1@my.team": {}, "user2@my.team": {}}
 	e.Arguments = "restore @[user2@my.team], ok?"
-	if err = Include(defaultCtx, e); err != nil {
+	if err := Include(defaultCtx, e); err != nil {
 		t.Errorf("Include: %v", err)
 	}
 	expected = "success"
-	if msg := e.buffer.String(); msg != expected {
+	if msg := sent.next(); msg != expected {
 		t.Errorf("failed msg='%s', want='%s'", msg, expected)
 	}
 	expectedExcluded := map[string]struct{}{"user1@my.team": {}}
 	if !maps.Equal(expectedExcluded, chat.ExcludeUsers) {
 		t.Error("failed compare excluded users")
 	}
-	expected = "[\"user1@my.team\"]"
-	if chat.Exclude != expected {
-		t.Errorf("failed chat.Exclude='%s', want='%s'", chat.Exclude, expected)
+	chats, err := db.StateChats(defaultCtx, c.DB, "user2@my.team", db.StateExcluded)
+	if err != nil {
+		t.Fatalf("db.StateChats: %v", err)
+	}
+	if slices.Contains(chats, chat.ID) {
+		t.Errorf("failed excluded chats='%v', don't want '%s'", chats, chat.ID)
 	}
 }
 
 func TestLink(t *testing.T) {
-	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		response := "{\"msgId\": \"7083436385855602743\", \"ok\": true}"
-		_, err := fmt.Fprint(w, response)
-		if err != nil {
-			t.Error(err)
-		}
-	})
-	s := httptest.NewServer(handler)
-	defer s.Close()
-	c, err := config.New(configPath, buildInfo, s)
-	if err != nil {
-		t.Fatalf("config.New: %v", err)
-	}
-	defer func() {
-		if errCfg := c.Close(); errCfg != nil {
-			t.Error(errCfg)
-		}
-	}()
+	c, s := newTestConfig(t)
 	chat := &db.Chat{ID: "TestLink"}
-	e := &Event{Cfg: c, ChatEvent: &botgolang.Event{}, Chat: chat, debug: true}
-	if err = Link(defaultCtx, e); err != nil {
+	sent := &botMessages{s: s, chatID: chat.ID}
+	e := &Event{Cfg: c, ChatEvent: &transport.Event{}, Chat: chat}
+	if err := Link(defaultCtx, e); err != nil {
 		t.Errorf("Link: %v", err)
 	}
 	expected := "no calling URL for this chat"
-	if msg := e.buffer.String(); msg != expected {
+	if msg := sent.next(); msg != expected {
 		t.Errorf("failed msg='%s', want='%s'", msg, expected)
 	}
-	e.buffer.Reset()
 	// chat has URL
 	chat.URL = "https://github.com/z0rr0/gobot"
-	if err = Link(defaultCtx, e); err != nil {
+	if err := Link(defaultCtx, e); err != nil {
 		t.Errorf("Link: %v", err)
 	}
 	expected = "https://github.com/z0rr0/gobot"
-	if msg := e.buffer.String(); msg != expected {
+	if msg := sent.next(); msg != expected {
 		t.Errorf("failed msg='%s', want='%s'", msg, expected)
 	}
-	e.buffer.Reset()
 	// failed new URL
 	e.Arguments = "invalid url value"
-	if err = Link(defaultCtx, e); err != nil {
+	if err := Link(defaultCtx, e); err != nil {
 		t.Errorf("Link: %v", err)
 	}
 	expected = "incorrect URL"
-	if msg := e.buffer.String(); msg != expected {
+	if msg := sent.next(); msg != expected {
 		t.Errorf("failed msg='%s', want='%s'", msg, expected)
 	}
-	e.buffer.Reset()
 	// set valid new URL
 	e.Arguments = "https://github.com/z0rr0/gobot"
-	if err = Link(defaultCtx, e); err != nil {
+	if err := Link(defaultCtx, e); err != nil {
 		t.Errorf("Link: %v", err)
 	}
 	expected = "success"
-	if msg := e.buffer.String(); msg != expected {
+	if msg := sent.next(); msg != expected {
 		t.Errorf("failed msg='%s', want='%s'", msg, expected)
 	}
-	e.buffer.Reset()
 	// set valid new URL with bad text
 	textURL := "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa " +
 		"bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb " +
 		"cccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccc"
 	e.Arguments = "https://github.com/z0rr0/gobot " + textURL
-	if err = Link(defaultCtx, e); err != nil {
+	if err := Link(defaultCtx, e); err != nil {
 		t.Errorf("Link: %v", err)
 	}
 	expected = "text is too long (max 255 characters)"
-	if msg := e.buffer.String(); msg != expected {
+	if msg := sent.next(); msg != expected {
 		t.Errorf("failed msg='%s', want='%s'", msg, expected)
 	}
-	e.buffer.Reset()
 	// set valid new URL with text
 	textURL = "my call text"
 	e.Arguments = "https://github.com/z0rr0/gobot " + textURL
-	if err = Link(defaultCtx, e); err != nil {
+	if err := Link(defaultCtx, e); err != nil {
 		t.Errorf("Link: %v", err)
 	}
 	expected = "success"
-	if msg := e.buffer.String(); msg != expected {
+	if msg := sent.next(); msg != expected {
 		t.Errorf("failed msg='%s', want='%s'", msg, expected)
 	}
 	if chat.URLText != textURL {
 		t.Errorf("failed chat.URLText='%s', want='%s'", chat.URLText, textURL)
 	}
-	e.buffer.Reset()
 }
 
 func TestResetLink(t *testing.T) {
-	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		response := "{\"msgId\": \"7083436385855602743\", \"ok\": true}"
-		_, err := fmt.Fprint(w, response)
-		if err != nil {
-			t.Error(err)
-		}
-	})
-	s := httptest.NewServer(handler)
-	defer s.Close()
-	c, err := config.New(configPath, buildInfo, s)
-	if err != nil {
-		t.Fatalf("config.New: %v", err)
-	}
-	defer func() {
-		if errCfg := c.Close(); errCfg != nil {
-			t.Error(errCfg)
-		}
-	}()
+	c, s := newTestConfig(t)
 	chat := &db.Chat{ID: "TestResetLink"}
-	e := &Event{Cfg: c, ChatEvent: &botgolang.Event{}, Chat: chat, debug: true}
-	if err = ResetLink(defaultCtx, e); err != nil {
+	sent := &botMessages{s: s, chatID: chat.ID}
+	e := &Event{Cfg: c, ChatEvent: &transport.Event{}, Chat: chat}
+	if err := ResetLink(defaultCtx, e); err != nil {
 		t.Errorf("ResetLink: %v", err)
 	}
 	expected := "no calling URL for this chat"
-	if msg := e.buffer.String(); msg != expected {
+	if msg := sent.next(); msg != expected {
 		t.Errorf("failed msg='%s', want='%s'", msg, expected)
 	}
-	e.buffer.Reset()
 	// chat has URL
 	chat.URL = "https://github.com/z0rr0/gobot"
 	chat.URLText = "my call text"
-	if err = ResetLink(defaultCtx, e); err != nil {
+	if err := ResetLink(defaultCtx, e); err != nil {
 		t.Errorf("ResetLink: %v", err)
 	}
 	expected = "success"
-	if msg := e.buffer.String(); msg != expected {
+	if msg := sent.next(); msg != expected {
 		t.Errorf("failed msg='%s', want='%s'", msg, expected)
 	}
 	if chat.URL != "" {
@@ -631,159 +1037,198 @@ func TestResetLink(t *testing.T) {
 }
 
 func TestVacation(t *testing.T) {
-	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		response := "{\"msgId\": \"7083436385855602743\", \"ok\": true, " +
-			"\"from\": {\"firstName\": \"A\", \"lastName\": \"B\", \"userId\": \"author@my.team\"}}"
-		_, err := fmt.Fprint(w, response)
-		if err != nil {
-			t.Error(err)
-		}
-	})
-	s := httptest.NewServer(handler)
-	defer s.Close()
-	c, err := config.New(configPath, buildInfo, s)
-	if err != nil {
-		t.Fatalf("config.New: %v", err)
-	}
-	defer func() {
-		if errCfg := c.Close(); errCfg != nil {
-			t.Error(errCfg)
-		}
-	}()
+	c, s := newTestConfig(t)
 	chat := &db.Chat{ID: "TestVacation"}
+	sent := &botMessages{s: s, chatID: chat.ID}
 	if len(chat.ExcludeUsers) > 0 {
 		t.Errorf("failed chat.ExcludeUsers='%v', want empty", chat.ExcludeUsers)
 	}
 
 	// no author
-	e := &Event{Cfg: c, ChatEvent: &botgolang.Event{}, Chat: chat, debug: true}
-	if err = Vacation(defaultCtx, e); err != nil {
+	e := &Event{Cfg: c, ChatEvent: &transport.Event{}, Chat: chat}
+	if err := Vacation(defaultCtx, e); err != nil {
 		t.Errorf("Vacation: %v", err)
 	}
 
 	expected := "no valid author user"
-	if msg := e.buffer.String(); msg != expected {
+	if msg := sent.next(); msg != expected {
 		t.Errorf("failed msg='%s', want='%s'", msg, expected)
 	}
-	e.buffer.Reset()
 
 	if len(chat.ExcludeUsers) > 0 {
 		t.Errorf("failed chat.ExcludeUsers='%v', want empty", chat.ExcludeUsers)
 	}
 
-	payLoad := botgolang.EventPayload{
-		BaseEventPayload: botgolang.BaseEventPayload{
-			From: botgolang.Contact{User: botgolang.User{ID: "author@my.team"}},
-		},
-	}
-	e = &Event{Cfg: c, ChatEvent: &botgolang.Event{Payload: payLoad}, Chat: chat, debug: true}
+	chatEvent := &transport.Event{From: transport.User{ID: "author@my.team"}}
+	e = &Event{Cfg: c, ChatEvent: chatEvent, Chat: chat}
 
 	// add author to exclude users
-	if err = Vacation(defaultCtx, e); err != nil {
+	if err := Vacation(defaultCtx, e); err != nil {
 		t.Errorf("Vacation: %v", err)
 	}
 
 	expected = "@[author@my.team] you are on vacation, good luck"
-	if msg := e.buffer.String(); msg != expected {
+	if msg := sent.next(); msg != expected {
 		t.Errorf("failed msg='%s', want='%s'", msg, expected)
 	}
-	e.buffer.Reset()
 
 	if _, ok := chat.ExcludeUsers["author@my.team"]; !ok {
 		t.Errorf("not author in chat.ExcludeUsers: %v", chat.ExcludeUsers)
 	}
 
-	// remove author from exclude users
-	if err = Vacation(defaultCtx, e); err != nil {
+	// re-run of the edited message repeats its outcome
+	if e.Outcome != outcomeOn {
+		t.Errorf("failed outcome %q", e.Outcome)
+	}
+
+	if err := Vacation(defaultCtx, e); err != nil {
+		t.Errorf("Vacation: %v", err)
+	}
+
+	expected = "@[author@my.team] you are on vacation, good luck"
+	if msg := sent.next(); msg != expected {
+		t.Errorf("failed msg='%s', want='%s'", msg, expected)
+	}
+
+	// remove author from exclude users by a new message
+	e.Outcome = ""
+	if err := Vacation(defaultCtx, e); err != nil {
 		t.Errorf("Vacation: %v", err)
 	}
 
 	expected = "@[author@my.team] you are back from vacation, welcome"
-	if msg := e.buffer.String(); msg != expected {
+	if msg := sent.next(); msg != expected {
+		t.Errorf("failed msg='%s', want='%s'", msg, expected)
+	}
+
+	if len(chat.ExcludeUsers) > 0 {
+		t.Errorf("failed chat.ExcludeUsers='%v', want empty", chat.ExcludeUsers)
+	}
+
+	// vacation with return date
+	e = &Event{Cfg: c, ChatEvent: chatEvent, Chat: chat, Arguments: "2w"}
+	if err := Vacation(defaultCtx, e); err != nil {
+		t.Errorf("Vacation: %v", err)
+	}
+
+	returnDate := time.Now().In(c.Timezone).AddDate(0, 0, 14).Format(time.DateOnly)
+	expected = "@[author@my.team] you are on vacation until " + returnDate + ", good luck"
+	if msg := sent.next(); msg != expected {
+		t.Errorf("failed msg='%s', want='%s'", msg, expected)
+	}
+
+	if _, ok := chat.ExcludeUsers["author@my.team"]; !ok {
+		t.Errorf("not author in chat.ExcludeUsers: %v", chat.ExcludeUsers)
+	}
+
+	// incorrect return date
+	e = &Event{Cfg: c, ChatEvent: chatEvent, Chat: chat, Arguments: "tomorrow"}
+	if err := Vacation(defaultCtx, e); err != nil {
+		t.Errorf("Vacation: %v", err)
+	}
+
+	expected = "incorrect date or duration \"tomorrow\", use YYYY-MM-DD, Nd or Nw"
+	if msg := sent.next(); msg != expected {
 		t.Errorf("failed msg='%s', want='%s'", msg, expected)
 	}
-	e.buffer.Reset()
+}
+
+func TestParseReturnDate(t *testing.T) {
+	moscow, err := time.LoadLocation("Europe/Moscow")
+	if err != nil {
+		t.Fatalf("failed to load timezone: %v", err)
+	}
+
+	now := time.Date(2026, 10, 17, 15, 4, 5, 0, moscow)
+	testCases := []struct {
+		name     string
+		value    string
+		expected time.Time
+		wantErr  bool
+	}{
+		{name: "date", value: "2026-11-03", expected: time.Date(2026, 11, 3, 0, 0, 0, 0, moscow)},
+		{name: "tomorrow", value: "2026-10-18", expected: time.Date(2026, 10, 18, 0, 0, 0, 0, moscow)},
+		{name: "days", value: "3d", expected: time.Date(2026, 10, 20, 0, 0, 0, 0, moscow)},
+		{name: "weeks", value: "2w", expected: time.Date(2026, 10, 31, 0, 0, 0, 0, moscow)},
+		{name: "today", value: "2026-10-17", wantErr: true},
+		{name: "past", value: "2025-01-01", wantErr: true},
+		{name: "zero", value: "0d", wantErr: true},
+		{name: "too_long", value: "60w", wantErr: true},
+		{name: "unknown_unit", value: "2m", wantErr: true},
+		{name: "invalid", value: "next monday", wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := parseReturnDate(tc.value, now)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("failed error=%v, wantErr=%v", err, tc.wantErr)
+			}
 
-	if len(chat.ExcludeUsers) > 0 {
-		t.Errorf("failed chat.ExcludeUsers='%v', want empty", chat.ExcludeUsers)
+			if !result.Equal(tc.expected) {
+				t.Errorf("failed result=%v, expected=%v", result, tc.expected)
+			}
+		})
 	}
 }
 
 func TestSkip(t *testing.T) {
-	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		response := "{\"msgId\": \"7083436385855602743\", \"ok\": true, " +
-			"\"from\": {\"firstName\": \"A\", \"lastName\": \"B\", \"userId\": \"author@my.team\"}}"
-		_, err := fmt.Fprint(w, response)
-		if err != nil {
-			t.Error(err)
-		}
-	})
-
-	s := httptest.NewServer(handler)
-	defer s.Close()
-
-	c, err := config.New(configPath, buildInfo, s)
-	if err != nil {
-		t.Fatalf("config.New: %v", err)
-	}
-	defer func() {
-		if errCfg := c.Close(); errCfg != nil {
-			t.Error(errCfg)
-		}
-	}()
+	c, s := newTestConfig(t)
 
 	chat := &db.Chat{ID: "TestSkip"}
+	sent := &botMessages{s: s, chatID: chat.ID}
 
 	// no author
-	e := &Event{Cfg: c, ChatEvent: &botgolang.Event{}, Chat: chat, debug: true}
-	if err = Skip(defaultCtx, e); err != nil {
+	e := &Event{Cfg: c, ChatEvent: &transport.Event{}, Chat: chat}
+	if err := Skip(defaultCtx, e); err != nil {
 		t.Errorf("Skip: %v", err)
 	}
 
 	expected := "no valid author user"
-	if msg := e.buffer.String(); msg != expected {
+	if msg := sent.next(); msg != expected {
 		t.Errorf("failed msg='%s', want='%s'", msg, expected)
 	}
-	e.buffer.Reset()
 
 	if len(chat.SkipUsers) > 0 {
 		t.Errorf("failed chat.SkipUsers='%v', want empty", chat.SkipUsers)
 	}
 
-	payLoad := botgolang.EventPayload{
-		BaseEventPayload: botgolang.BaseEventPayload{
-			From: botgolang.Contact{User: botgolang.User{ID: "author@my.team"}},
-		},
-	}
-	e = &Event{Cfg: c, ChatEvent: &botgolang.Event{Payload: payLoad}, Chat: chat, debug: true}
+	chatEvent := &transport.Event{From: transport.User{ID: "author@my.team"}}
+	e = &Event{Cfg: c, ChatEvent: chatEvent, Chat: chat}
 
 	// add author to skip users set
-	if err = Skip(defaultCtx, e); err != nil {
+	if err := Skip(defaultCtx, e); err != nil {
 		t.Errorf("Skip: %v", err)
 	}
 
 	expected = "@[author@my.team] ok, you will be skipped today"
-	if msg := e.buffer.String(); msg != expected {
+	if msg := sent.next(); msg != expected {
 		t.Errorf("failed msg='%s', want='%s'", msg, expected)
 	}
-	e.buffer.Reset()
 
 	if _, ok := chat.SkipUsers["author@my.team"]; !ok {
 		t.Errorf("not author in chat.SkipUsers: %v", chat.SkipUsers)
 	}
 
-	// remove author from skip-set users
-	if err = Skip(defaultCtx, e); err != nil {
+	// re-run of the edited message repeats its outcome
+	if err := Skip(defaultCtx, e); err != nil {
+		t.Errorf("Skip: %v", err)
+	}
+
+	if msg := sent.next(); msg != expected {
+		t.Errorf("failed msg='%s', want='%s'", msg, expected)
+	}
+
+	// remove author from skip-set users by a new message
+	e.Outcome = ""
+	if err := Skip(defaultCtx, e); err != nil {
 		t.Errorf("Vacation: %v", err)
 	}
 
 	expected = "@[author@my.team] ok, you are in the list again"
-	if msg := e.buffer.String(); msg != expected {
+	if msg := sent.next(); msg != expected {
 		t.Errorf("failed msg='%s', want='%s'", msg, expected)
 	}
-	e.buffer.Reset()
 
 	if len(chat.SkipUsers) > 0 {
 		t.Errorf("failed chat.SkipUsers='%v', want empty", chat.SkipUsers)
@@ -791,64 +1236,38 @@ func TestSkip(t *testing.T) {
 }
 
 func TestNoDays(t *testing.T) {
-	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		response := "{\"msgId\": \"7083436385855602743\", \"ok\": true, " +
-			"\"from\": {\"firstName\": \"A\", \"lastName\": \"B\", \"userId\": \"author@my.team\"}}"
-		_, err := fmt.Fprint(w, response)
-		if err != nil {
-			t.Error(err)
-		}
-	})
-
-	s := httptest.NewServer(handler)
-	defer s.Close()
-
-	c, err := config.New(configPath, buildInfo, s)
-	if err != nil {
-		t.Fatalf("config.New: %v", err)
-	}
-	defer func() {
-		if errCfg := c.Close(); errCfg != nil {
-			t.Error(errCfg)
-		}
-	}()
+	c, s := newTestConfig(t)
 
 	chat := &db.Chat{ID: "TestNoDays"}
+	sent := &botMessages{s: s, chatID: chat.ID}
 
 	// no author
-	e := &Event{Cfg: c, ChatEvent: &botgolang.Event{}, Chat: chat, debug: true}
-	if err = Skip(defaultCtx, e); err != nil {
+	e := &Event{Cfg: c, ChatEvent: &transport.Event{}, Chat: chat}
+	if err := Skip(defaultCtx, e); err != nil {
 		t.Errorf("Skip: %v", err)
 	}
 
 	expected := "no valid author user"
-	if msg := e.buffer.String(); msg != expected {
+	if msg := sent.next(); msg != expected {
 		t.Errorf("failed msg='%s', want='%s'", msg, expected)
 	}
-	e.buffer.Reset()
 
 	if len(chat.WeekDays) > 0 {
 		t.Errorf("failed chat.WeekDays='%v', want empty", chat.WeekDays)
 	}
 
-	payLoad := botgolang.EventPayload{
-		BaseEventPayload: botgolang.BaseEventPayload{
-			From: botgolang.Contact{User: botgolang.User{ID: "author@my.team"}},
-		},
-	}
-	e = &Event{Cfg: c, ChatEvent: &botgolang.Event{Payload: payLoad}, Chat: chat, Arguments: "2 5", debug: true}
+	chatEvent := &transport.Event{From: transport.User{ID: "author@my.team"}}
+	e = &Event{Cfg: c, ChatEvent: chatEvent, Chat: chat, Arguments: "2 5"}
 
 	// add noDays for author
-	if err = NoDays(defaultCtx, e); err != nil {
+	if err := NoDays(defaultCtx, e); err != nil {
 		t.Errorf("NoDays: %v", err)
 	}
 
 	expected = "@[author@my.team] days are set: Tuesday, Friday"
-	if msg := e.buffer.String(); msg != expected {
+	if msg := sent.next(); msg != expected {
 		t.Errorf("failed msg='%s', want='%s'", msg, expected)
 	}
-	e.buffer.Reset()
 
 	expectedMap := map[time.Weekday]map[string]struct{}{
 		time.Tuesday: {"author@my.team": {}},
@@ -872,44 +1291,92 @@ func TestNoDays(t *testing.T) {
 	}
 
 	// update user's noDays
-	e = &Event{Cfg: c, ChatEvent: &botgolang.Event{Payload: payLoad}, Chat: chat, Arguments: "3", debug: true}
-	if err = NoDays(defaultCtx, e); err != nil {
+	e = &Event{Cfg: c, ChatEvent: chatEvent, Chat: chat, Arguments: "3"}
+	if err := NoDays(defaultCtx, e); err != nil {
 		t.Errorf("NoDays: %v", err)
 	}
 
 	expected = "@[author@my.team] days are set: Wednesday"
-	if msg := e.buffer.String(); msg != expected {
+	if msg := sent.next(); msg != expected {
 		t.Errorf("failed msg='%s', want='%s'", msg, expected)
 	}
-	e.buffer.Reset()
 
-	expected = "{\"3\":[\"author@my.team\"]}"
-	if chat.Days != expected {
-		t.Errorf("failed chat.Days='%s', want='%s'", chat.Days, expected)
+	expectedMap = map[time.Weekday]map[string]struct{}{time.Wednesday: {"author@my.team": {}}}
+	if !maps.EqualFunc(chat.WeekDays, expectedMap, maps.Equal) {
+		t.Errorf("failed chat.WeekDays='%v', want='%v'", chat.WeekDays, expectedMap)
 	}
 
 	// reset user's noDays
-	e = &Event{Cfg: c, ChatEvent: &botgolang.Event{Payload: payLoad}, Chat: chat, debug: true}
-	if err = NoDays(defaultCtx, e); err != nil {
+	e = &Event{Cfg: c, ChatEvent: chatEvent, Chat: chat}
+	if err := NoDays(defaultCtx, e); err != nil {
 		t.Errorf("NoDays: %v", err)
 	}
 
 	expected = "@[author@my.team] days are cleaned"
-	if msg := e.buffer.String(); msg != expected {
+	if msg := sent.next(); msg != expected {
 		t.Errorf("failed msg='%s', want='%s'", msg, expected)
 	}
-	e.buffer.Reset()
-
-	expected = ""
-	if chat.Days != expected {
-		t.Errorf("failed chat.Days='%s', want='%s'", chat.Days, expected)
-	}
 
 	if len(chat.WeekDays) != 0 {
 		t.Errorf("failed chat.WeekDays='%v', want empty", chat.WeekDays)
 	}
 }
 
+func TestAI(t *testing.T) {
+	c, s := newTestConfig(t)
+
+	chat := &db.Chat{ID: "TestAI", Active: true}
+	sent := &botMessages{s: s, chatID: chat.ID}
+	s.SetAdmins(chat.ID, "admin@my.team")
+	if err := chat.Upsert(defaultCtx, c.DB); err != nil {
+		t.Fatalf("chat.Upsert: %v", err)
+	}
+
+	newEvent := func(userID, arguments string) *Event {
+		chatEvent := &transport.Event{From: transport.User{ID: userID}}
+		return &Event{Cfg: c, ChatEvent: chatEvent, Chat: chat, Arguments: arguments}
+	}
+
+	testCases := []struct {
+		name      string
+		userID    string
+		arguments string
+		expected  string
+		gpt       bool
+	}{
+		{name: "status", userID: "user@my.team", expected: "AI commands are disabled for this chat"},
+		{name: "not_admin", userID: "user@my.team", arguments: "on", expected: "only chat admins can change AI permission"},
+		{name: "no_author", arguments: "on", expected: "no valid author user"},
+		{name: "unknown", userID: "admin@my.team", arguments: "yes", expected: "unknown argument, use: on, off, status or provider gpt, ds, ygpt"},
+		{name: "provider", userID: "user@my.team", arguments: "gpt\nhello", expected: "gpt is not allowed for this chat"},
+		{name: "on", userID: "admin@my.team", arguments: "on", expected: "AI commands are enabled for this chat", gpt: true},
+		{name: "enabled", userID: "user@my.team", arguments: "status", expected: "AI commands are enabled for this chat", gpt: true},
+		{name: "off", userID: "admin@my.team", arguments: " off ", expected: "AI commands are disabled for this chat"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := newEvent(tc.userID, tc.arguments)
+			if err := AI(defaultCtx, e); err != nil {
+				t.Fatalf("AI: %v", err)
+			}
+
+			if msg := sent.next(); msg != tc.expected {
+				t.Errorf("failed msg='%s', want='%s'", msg, tc.expected)
+			}
+
+			dbChat, err := db.Get(defaultCtx, c.DB, chat.ID)
+			if err != nil {
+				t.Fatalf("db.Get: %v", err)
+			}
+
+			if dbChat.GPT != tc.gpt {
+				t.Errorf("failed chat.GPT=%v, want %v", dbChat.GPT, tc.gpt)
+			}
+		})
+	}
+}
+
 func TestEvent_ArgsUserIDs(t *testing.T) {
 	cases := []struct {
 		name     string
@@ -979,3 +1446,491 @@ func FuzzEventArgsUserIDs(f *testing.F) {
 		}
 	})
 }
+
+func TestParseSchedule(t *testing.T) {
+	testCases := []struct {
+		name     string
+		value    string
+		expected string
+		wantErr  bool
+	}{
+		{name: "every_day", value: "10:00", expected: "10:00 every day"},
+		{name: "range", value: "9:30 1-5", expected: "09:30 Monday, Tuesday, Wednesday, Thursday, Friday"},
+		{name: "list", value: "23:59 0,6", expected: "23:59 Sunday, Saturday"},
+		{name: "mixed", value: "07:05 1 3-4,6", expected: "07:05 Monday, Wednesday, Thursday, Saturday"},
+		{name: "all_days", value: "10:00 0-6", expected: "10:00 every day"},
+		{name: "bad_time", value: "25:00 1-5", wantErr: true},
+		{name: "no_time", value: "1-5", wantErr: true},
+		{name: "bad_day", value: "10:00 7", wantErr: true},
+		{name: "bad_range", value: "10:00 5-1", wantErr: true},
+		{name: "bad_value", value: "10:00 monday", wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s, err := parseSchedule("TestParseSchedule", tc.value)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("failed error=%v, wantErr=%v", err, tc.wantErr)
+			}
+
+			if err == nil && s.String() != tc.expected {
+				t.Errorf("failed result=%q, expected=%q", s.String(), tc.expected)
+			}
+		})
+	}
+}
+
+func TestSchedule(t *testing.T) {
+	c, s := newTestConfig(t)
+	chat := &db.Chat{ID: "TestSchedule", Active: true}
+	sent := &botMessages{s: s, chatID: chat.ID}
+	if err := chat.Upsert(defaultCtx, c.DB); err != nil {
+		t.Fatalf("chat.Upsert: %v", err)
+	}
+
+	testCases := []struct {
+		arguments string
+		expected  string
+	}{
+		{arguments: "", expected: "no schedule for this chat"},
+		{arguments: "10:00 1-5", expected: "schedule is set: 10:00 Monday, Tuesday, Wednesday, Thursday, Friday (Europe/Moscow)"},
+		{arguments: "", expected: "schedule: 10:00 Monday, Tuesday, Wednesday, Thursday, Friday (Europe/Moscow)"},
+		{arguments: "11:00", expected: "schedule is set: 11:00 every day (Europe/Moscow)"},
+		{arguments: "10:00 8", expected: "incorrect week days \"8\", use numbers from sunday=0 to saturday=6"},
+		{arguments: "off", expected: "schedule is removed"},
+		{arguments: "off", expected: "no schedule for this chat"},
+	}
+
+	for _, tc := range testCases {
+		e := &Event{Cfg: c, ChatEvent: &transport.Event{}, Chat: chat, Arguments: tc.arguments}
+		if err := Schedule(defaultCtx, e); err != nil {
+			t.Fatalf("Schedule(%q): %v", tc.arguments, err)
+		}
+
+		if msg := sent.next(); msg != tc.expected {
+			t.Errorf("failed bot response='%s', want='%s'", msg, tc.expected)
+		}
+	}
+}
+
+func TestTimezone(t *testing.T) {
+	c, s := newTestConfig(t)
+	chat := &db.Chat{ID: "TestTimezone", Active: true}
+	sent := &botMessages{s: s, chatID: chat.ID}
+	if err := chat.Upsert(defaultCtx, c.DB); err != nil {
+		t.Fatalf("chat.Upsert: %v", err)
+	}
+
+	testCases := []struct {
+		arguments string
+		expected  string
+		timezone  string
+	}{
+		{arguments: "", expected: "timezone: Europe/Moscow (default)"},
+		{arguments: "Mars/Olympus", expected: "unknown timezone \"Mars/Olympus\", use IANA name like Europe/Moscow"},
+		{arguments: "Local", expected: "unknown timezone \"Local\", use IANA name like Europe/Moscow"},
+		{arguments: "Asia/Novosibirsk", expected: "timezone is set: Asia/Novosibirsk", timezone: "Asia/Novosibirsk"},
+		{arguments: "", expected: "timezone: Asia/Novosibirsk", timezone: "Asia/Novosibirsk"},
+		{arguments: "reset", expected: "timezone is set: Europe/Moscow"},
+	}
+
+	for _, tc := range testCases {
+		e := &Event{Cfg: c, ChatEvent: &transport.Event{}, Chat: chat, Arguments: tc.arguments}
+		if err := Timezone(defaultCtx, e); err != nil {
+			t.Fatalf("Timezone(%q): %v", tc.arguments, err)
+		}
+
+		// skip current time suffix
+		if msg := sent.next(); !strings.HasPrefix(msg, tc.expected) {
+			t.Errorf("failed bot response='%s', want='%s'", msg, tc.expected)
+		}
+
+		dbChat, errGet := db.Get(defaultCtx, c.DB, chat.ID)
+		if errGet != nil {
+			t.Fatalf("db.Get: %v", errGet)
+		}
+
+		if dbChat.Timezone != tc.timezone {
+			t.Errorf("failed saved timezone %q, want %q", dbChat.Timezone, tc.timezone)
+		}
+	}
+
+	chat.Timezone = "Asia/Yekaterinburg"
+	e := &Event{Cfg: c, ChatEvent: &transport.Event{}, Chat: chat}
+	if loc := e.Now().Location().String(); loc != chat.Timezone {
+		t.Errorf("failed now location %q", loc)
+	}
+}
+
+func TestPrompt(t *testing.T) {
+	var messages []llm.Message
+	gptServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request := struct {
+			Messages []llm.Message `json:"messages"`
+		}{}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			panic(err)
+		}
+		messages = request.Messages
+
+		w.Header().Set("Content-Type", "application/json")
+		response := `{"choices":[{"index":0,"message":{"content":"answer"},"finish_reason":"stop"}]}`
+		if _, err := fmt.Fprint(w, response); err != nil {
+			panic(err)
+		}
+	}))
+	defer gptServer.Close()
+
+	c, s := newTestConfig(t)
+	setProvider(t, c, llm.Config{Name: providerDeepSeek, URL: gptServer.URL, Models: []string{"deepseek-chat"}}, gptServer)
+
+	chat := &db.Chat{ID: "TestPrompt", Active: true, GPT: true}
+	sent := &botMessages{s: s, chatID: chat.ID}
+	if err := chat.Upsert(defaultCtx, c.DB); err != nil {
+		t.Fatalf("chat.Upsert: %v", err)
+	}
+
+	testCases := []struct {
+		arguments string
+		expected  string
+		prompt    string
+	}{
+		{arguments: "", expected: "no prompt"},
+		{arguments: "set", expected: "no prompt text"},
+		{arguments: "unknown", expected: "unknown argument, use: set <text>, show or reset"},
+		{arguments: "set " + strings.Repeat("a", 2001), expected: "prompt is too long, 2001 characters, maximum is 2000"},
+		{arguments: "set\nanswer briefly ", expected: "prompt is set", prompt: "answer briefly"},
+		{arguments: "show", expected: "prompt: answer briefly", prompt: "answer briefly"},
+		{arguments: "reset", expected: "prompt is reset to default"},
+	}
+
+	for _, tc := range testCases {
+		e := &Event{Cfg: c, ChatEvent: &transport.Event{}, Chat: chat, Arguments: tc.arguments}
+		if err := Prompt(defaultCtx, e); err != nil {
+			t.Fatalf("Prompt(%q): %v", tc.arguments, err)
+		}
+
+		if msg := sent.next(); msg != tc.expected {
+			t.Errorf("failed bot response='%s', want='%s'", msg, tc.expected)
+		}
+
+		dbChat, errGet := db.Get(defaultCtx, c.DB, chat.ID)
+		if errGet != nil {
+			t.Fatalf("db.Get: %v", errGet)
+		}
+
+		if dbChat.Prompt != tc.prompt {
+			t.Errorf("failed saved prompt %q, want %q", dbChat.Prompt, tc.prompt)
+		}
+	}
+
+	c.AI.Prompt = "default prompt"
+	e := &Event{Cfg: c, ChatEvent: &transport.Event{}, Chat: chat}
+	if err := Prompt(defaultCtx, e); err != nil {
+		t.Fatalf("Prompt: %v", err)
+	}
+
+	if msg := sent.next(); msg != "prompt (default): default prompt" {
+		t.Errorf("failed bot response='%s'", msg)
+	}
+
+	e = &Event{Cfg: c, ChatEvent: &transport.Event{}, Chat: chat, Arguments: "reset"}
+	if err := DeepSeek(defaultCtx, e); err != nil {
+		t.Fatalf("DeepSeek: %v", err)
+	}
+
+	e = &Event{Cfg: c, ChatEvent: &transport.Event{}, Chat: chat, Arguments: "question"}
+	if err := DeepSeek(defaultCtx, e); err != nil {
+		t.Fatalf("DeepSeek: %v", err)
+	}
+
+	expected := []llm.Message{{Role: llm.RoleSystem, Content: "default prompt"}, {Role: llm.RoleUser, Content: "question"}}
+	if !slices.Equal(messages, expected) {
+		t.Errorf("failed request messages %v, want %v", messages, expected)
+	}
+}
+
+func TestModel(t *testing.T) {
+	var request map[string]any
+	gptServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			panic(err)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		response := `{"choices":[{"index":0,"message":{"content":"answer"},"finish_reason":"stop"}]}`
+		if _, err := fmt.Fprint(w, response); err != nil {
+			panic(err)
+		}
+	}))
+	defer gptServer.Close()
+
+	c, s := newTestConfig(t)
+
+	temperature := float32(0)
+	cfg := llm.Config{
+		Name:           providerDeepSeek,
+		URL:            gptServer.URL,
+		Models:         []string{"deepseek-chat", "deepseek-reasoner"},
+		MaxTokens:      1000,
+		Temperature:    &temperature,
+		MaxTemperature: 1.5,
+	}
+	setProvider(t, c, cfg, gptServer)
+
+	chat := &db.Chat{ID: "TestModel", Active: true, GPT: true}
+	sent := &botMessages{s: s, chatID: chat.ID}
+	if err := chat.Upsert(defaultCtx, c.DB); err != nil {
+		t.Fatalf("chat.Upsert: %v", err)
+	}
+
+	testCases := []struct {
+		arguments string
+		expected  string
+	}{
+		{arguments: "", expected: "ds: deepseek-chat, temperature 0, max tokens 1000"},
+		{
+			arguments: "ds",
+			expected:  "ds: deepseek-chat, temperature 0, max tokens 1000\nmodels: deepseek-chat, deepseek-reasoner",
+		},
+		{arguments: "gpt gpt-4o", expected: "unknown provider \"gpt\", use: ds"},
+		{arguments: "ds gpt-4o", expected: "unknown model \"gpt-4o\", use: deepseek-chat, deepseek-reasoner"},
+		{arguments: "ds temperature=hot", expected: "incorrect temperature \"hot\""},
+		{arguments: "ds temperature=2", expected: "temperature must be from 0 to 1.5"},
+		{arguments: "ds max_tokens=0", expected: "incorrect max tokens \"0\""},
+		{arguments: "ds max_tokens=2000", expected: "max tokens must be from 1 to 1000"},
+		{arguments: "ds top_p=1", expected: "unknown option \"top_p\", use: temperature=N, max_tokens=N"},
+		{
+			arguments: "ds deepseek-reasoner temperature=0.7 max_tokens=500",
+			expected:  "model is set: ds: deepseek-reasoner, temperature 0.7, max tokens 500",
+		},
+		{arguments: "", expected: "ds: deepseek-reasoner, temperature 0.7, max tokens 500"},
+	}
+
+	for _, tc := range testCases {
+		e := &Event{Cfg: c, ChatEvent: &transport.Event{}, Chat: chat, Arguments: tc.arguments}
+		if err := Model(defaultCtx, e); err != nil {
+			t.Fatalf("Model(%q): %v", tc.arguments, err)
+		}
+
+		if msg := sent.next(); msg != tc.expected {
+			t.Errorf("failed bot response='%s', want='%s'", msg, tc.expected)
+		}
+	}
+
+	dbChat, err := db.Get(defaultCtx, c.DB, chat.ID)
+	if err != nil {
+		t.Fatalf("db.Get: %v", err)
+	}
+
+	if !dbChat.Equal(chat) {
+		t.Errorf("failed saved chat options %v, want %v", dbChat.AIOptions, chat.AIOptions)
+	}
+
+	e := &Event{Cfg: c, ChatEvent: &transport.Event{}, Chat: chat, Arguments: "question"}
+	if err := DeepSeek(defaultCtx, e); err != nil {
+		t.Fatalf("DeepSeek: %v", err)
+	}
+
+	if request["model"] != "deepseek-reasoner" || request["max_tokens"] != 500.0 || request["temperature"] != 0.7 {
+		t.Errorf("failed request options %v", request)
+	}
+
+	if msg := sent.next(); msg != "answer" {
+		t.Errorf("failed bot response='%s', want='answer'", msg)
+	}
+
+	e = &Event{Cfg: c, ChatEvent: &transport.Event{}, Chat: chat, Arguments: "ds reset"}
+	if err := Model(defaultCtx, e); err != nil {
+		t.Fatalf("Model: %v", err)
+	}
+
+	if msg, expected := sent.next(), "model is set: ds: deepseek-chat, temperature 0, max tokens 1000"; msg != expected {
+		t.Errorf("failed bot response='%s', want='%s'", msg, expected)
+	}
+
+	if len(chat.AIOptions) != 0 {
+		t.Errorf("failed reset options %v", chat.AIOptions)
+	}
+}
+
+func TestUsage(t *testing.T) {
+	gptServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		response := `{"choices":[{"index":0,"message":{"content":"answer"},"finish_reason":"stop"}],` +
+			`"usage":{"prompt_tokens":30,"completion_tokens":10,"total_tokens":40}}`
+		if _, err := fmt.Fprint(w, response); err != nil {
+			panic(err)
+		}
+	}))
+	defer gptServer.Close()
+
+	c, s := newTestConfig(t)
+	setProvider(t, c, llm.Config{Name: providerGPT, URL: gptServer.URL, Models: []string{"gpt-4o-mini"}}, gptServer)
+	c.AI.ChatDaily = config.Quota{Requests: 2}
+	c.AI.ChatMonthly = config.Quota{}
+	c.AI.UserDaily = config.Quota{}
+	c.AI.UserMonthly = config.Quota{Tokens: 1000}
+
+	// unique identifiers, because the usage is kept between test runs
+	var (
+		chatID = fmt.Sprintf("TestUsage%d", time.Now().UnixNano())
+		chat   = &db.Chat{ID: chatID, Active: true, GPT: true}
+		sent   = &botMessages{s: s, chatID: chatID}
+	)
+	newEvent := func(arguments string) *Event {
+		chatEvent := &transport.Event{From: transport.User{ID: chatID + "@my.team"}}
+		return &Event{Cfg: c, ChatEvent: chatEvent, Chat: chat, Arguments: arguments}
+	}
+
+	expected := []string{"answer", "answer", "chat daily AI quota is exceeded"}
+	for i, msg := range expected {
+		e := newEvent("question")
+		if err := GPT(defaultCtx, e); err != nil {
+			t.Fatalf("GPT %d: %v", i, err)
+		}
+
+		if response := sent.next(); response != msg {
+			t.Errorf("failed response %d='%s', want='%s'", i, response, msg)
+		}
+	}
+
+	e := newEvent("")
+	if err := Usage(defaultCtx, e); err != nil {
+		t.Fatalf("Usage: %v", err)
+	}
+
+	report := "chat daily: 2 requests, 80 tokens (quota: 2 requests)\n" +
+		"chat monthly: 2 requests, 80 tokens\n" +
+		"your daily: 2 requests, 80 tokens\n" +
+		"your monthly: 2 requests, 80 tokens (quota: 1000 tokens)"
+	if msg := sent.next(); msg != report {
+		t.Errorf("failed usage report='%s', want='%s'", msg, report)
+	}
+}
+
+func TestOrder(t *testing.T) {
+	c, s := newTestConfig(t)
+	// unique identifier, because the history is kept between test runs
+	chat := &db.Chat{ID: fmt.Sprintf("TestOrder%d", time.Now().UnixNano()), Active: true}
+	sent := &botMessages{s: s, chatID: chat.ID}
+	s.SetMembers(chat.ID, botapitest.BotID, "user2@my.team", "user1@my.team", "user3@my.team")
+	if err := chat.Upsert(defaultCtx, c.DB); err != nil {
+		t.Fatalf("chat.Upsert: %v", err)
+	}
+
+	testCases := []struct {
+		arguments string
+		expected  string
+	}{
+		{arguments: "", expected: "order: random"},
+		{arguments: "next", expected: "unknown order \"next\", use: random, fair, rotate, alphabetical"},
+		{arguments: "rotate", expected: "order is set: rotate"},
+		{arguments: "", expected: "order: rotate"},
+	}
+
+	for _, tc := range testCases {
+		e := &Event{Cfg: c, ChatEvent: &transport.Event{}, Chat: chat, Arguments: tc.arguments}
+		if err := Order(defaultCtx, e); err != nil {
+			t.Fatalf("Order(%q): %v", tc.arguments, err)
+		}
+
+		if msg := sent.next(); msg != tc.expected {
+			t.Errorf("failed bot response='%s', want='%s'", msg, tc.expected)
+		}
+	}
+
+	dbChat, err := db.Get(defaultCtx, c.DB, chat.ID)
+	if err != nil {
+		t.Fatalf("db.Get: %v", err)
+	}
+
+	// rotate order shifts the first user every time
+	expected := []string{
+		"1. @[user1@my.team]\n2. @[user2@my.team]\n3. @[user3@my.team]",
+		"1. @[user2@my.team]\n2. @[user3@my.team]\n3. @[user1@my.team]",
+		"1. @[user3@my.team]\n2. @[user1@my.team]\n3. @[user2@my.team]",
+		"1. @[user1@my.team]\n2. @[user2@my.team]\n3. @[user3@my.team]",
+	}
+
+	for _, msg := range expected {
+		e := &Event{Cfg: c, ChatEvent: &transport.Event{}, Chat: dbChat}
+		if err := Go(defaultCtx, e); err != nil {
+			t.Fatalf("Go: %v", err)
+		}
+
+		if result := sent.next(); result != msg {
+			t.Errorf("failed bot response='%s', want='%s'", result, msg)
+		}
+	}
+}
+
+func TestHistory(t *testing.T) {
+	c, s := newTestConfig(t)
+	// unique identifier, because the history is kept between test runs
+	chat := &db.Chat{ID: fmt.Sprintf("TestHistory%d", time.Now().UnixNano()), Active: true, Order: "alphabetical"}
+	sent := &botMessages{s: s, chatID: chat.ID}
+	s.SetMembers(chat.ID, "user2@my.team", "user1@my.team")
+	if err := chat.Upsert(defaultCtx, c.DB); err != nil {
+		t.Fatalf("chat.Upsert: %v", err)
+	}
+
+	newEvent := func(arguments string) *Event {
+		chatEvent := &transport.Event{From: transport.User{ID: "user2@my.team"}}
+		return &Event{Cfg: c, ChatEvent: chatEvent, Chat: chat, Arguments: arguments}
+	}
+
+	for _, f := range []func(context.Context, *Event) error{History, Stats} {
+		e := newEvent("")
+		if err := f(defaultCtx, e); err != nil {
+			t.Fatal(err)
+		}
+
+		if msg := sent.next(); msg != "no history" {
+			t.Errorf("failed bot response='%s'", msg)
+		}
+	}
+
+	for range 2 {
+		if err := Go(defaultCtx, newEvent("")); err != nil {
+			t.Fatalf("Go: %v", err)
+		}
+
+		if msg, expected := sent.next(), "1. @[user1@my.team]\n2. @[user2@my.team]"; msg != expected {
+			t.Errorf("failed bot response='%s', want='%s'", msg, expected)
+		}
+	}
+
+	e := newEvent("1")
+	if err := History(defaultCtx, e); err != nil {
+		t.Fatalf("History: %v", err)
+	}
+
+	// skip timestamp "2006-01-02 15:04"
+	expected := " (user2@my.team): user1@my.team, user2@my.team"
+	if msg := sent.next(); len(msg) != 16+len(expected) || msg[16:] != expected {
+		t.Errorf("failed bot response='%s', want='%s'", msg, expected)
+	}
+
+	e = newEvent("21")
+	if err := History(defaultCtx, e); err != nil {
+		t.Fatalf("History: %v", err)
+	}
+
+	expected = "incorrect number \"21\", it must be from 1 to 20"
+	if msg := sent.next(); msg != expected {
+		t.Errorf("failed bot response='%s', want='%s'", msg, expected)
+	}
+
+	e = newEvent("7")
+	if err := Stats(defaultCtx, e); err != nil {
+		t.Fatalf("Stats: %v", err)
+	}
+
+	expected = "stats for 7 days, results: 2\n" +
+		"user1@my.team - first: 2, last: 0, total: 2\n" +
+		"user2@my.team - first: 0, last: 2, total: 2"
+	if msg := sent.next(); msg != expected {
+		t.Errorf("failed bot response='%s', want='%s'", msg, expected)
+	}
+}
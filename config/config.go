@@ -12,6 +12,7 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"sync"
 	"time"
@@ -20,18 +21,122 @@ import (
 	_ "github.com/mattn/go-sqlite3" // SQLite3 driver
 	"github.com/pelletier/go-toml/v2"
 	"github.com/z0rr0/aoapi"
-	"github.com/z0rr0/tgtpgybot/ygpt"
 
+	"github.com/z0rr0/gobot/db"
+	"github.com/z0rr0/gobot/llm"
+	"github.com/z0rr0/gobot/markup"
 	"github.com/z0rr0/gobot/random"
+	"github.com/z0rr0/gobot/transport"
 )
 
+// defaultHistorySize is a default number of saved AI conversation messages.
+const defaultHistorySize = 20
+
+// defaultEvents is a default number of kept processed messages.
+const defaultEvents = 10000
+
+// defaultStreamTimeout is a default timeout of streamed AI responses (seconds).
+const defaultStreamTimeout = 300
+
 // Bot contains base API configuration parameters.
 type Bot struct {
-	ID    string `toml:"id"`
-	Nick  string `toml:"nick"`
+	ID        string `toml:"id"`
+	Nick      string `toml:"nick"`
+	Token     string `toml:"token"`
+	ULR       string `toml:"url"`
+	Src       string `toml:"src"`
+	Mode      string `toml:"mode"`      // events ingestion mode: "polling" (default) or "webhook"
+	Messenger string `toml:"messenger"` // messenger API: "vkteams" (default) or "telegram"
+}
+
+// Modes of bot events ingestion.
+const (
+	ModePolling = "polling"
+	ModeWebhook = "webhook"
+)
+
+// Supported messengers.
+const (
+	MessengerVKTeams  = "vkteams"
+	MessengerTelegram = "telegram"
+)
+
+// Telegram is a Telegram Bot API configuration settings.
+type Telegram struct {
 	Token string `toml:"token"`
-	ULR   string `toml:"url"`
-	Src   string `toml:"src"`
+	URL   string `toml:"url"`
+	Poll  int    `toml:"poll"` // long polling timeout (seconds)
+}
+
+// defaultWebhookPath is a default URL path of webhook events.
+const defaultWebhookPath = "/events"
+
+// Webhook is a configuration of HTTP events ingestion,
+// events are POSTed by a gateway in the same format as bot API "events/get" response.
+type Webhook struct {
+	Address string `toml:"address"`
+	Path    string `toml:"path"`
+	Secret  string `toml:"secret"` // shared secret of "Authorization: Bearer <secret>" header
+}
+
+// validate checks webhook settings and sets default values.
+func (w *Webhook) validate() error {
+	if w.Address == "" {
+		return errors.New("webhook address is required")
+	}
+
+	if w.Secret == "" {
+		return errors.New("webhook secret is required")
+	}
+
+	if w.Path == "" {
+		w.Path = defaultWebhookPath
+	}
+
+	if !strings.HasPrefix(w.Path, "/") {
+		return fmt.Errorf("webhook path %q must start with /", w.Path)
+	}
+
+	return nil
+}
+
+// Default identifiers of the console mode.
+const (
+	defaultConsoleChat = "console@chat.agent"
+	defaultConsoleUser = "console@my.team"
+)
+
+// Console is a configuration of the fake chat of console mode.
+type Console struct {
+	ChatID  string   `toml:"chat_id"`
+	UserID  string   `toml:"user_id"`
+	Members []string `toml:"members"` // chat members, the user is always added
+}
+
+// messenger returns a console messenger of the fake chat and user, empty identifiers are set to defaults.
+func (con *Console) messenger(in io.Reader, out io.Writer) *transport.Console {
+	if con.ChatID == "" {
+		con.ChatID = defaultConsoleChat
+	}
+
+	if con.UserID == "" {
+		con.UserID = defaultConsoleUser
+	}
+
+	var (
+		user    = transport.User{ID: con.UserID}
+		members = make([]transport.User, 0, len(con.Members)+1)
+	)
+
+	for _, userID := range con.Members {
+		members = append(members, transport.User{ID: userID})
+	}
+
+	if !slices.Contains(con.Members, user.ID) {
+		members = append(members, user)
+	}
+
+	return transport.NewConsole(in, out, con.ChatID, user, members)
 }
 
 // Main is a basic configuration settings.
@@ -42,6 +147,7 @@ type Main struct {
 	Workers      int    `toml:"workers"`
 	SecureRandom bool   `toml:"secure_random"`
 	Timezone     string `toml:"Timezone"`
+	Events       int    `toml:"events"` // number of kept processed messages to skip their duplicates
 }
 
 // Log is a logging configuration settings.
@@ -61,79 +167,119 @@ type BuildInfo struct {
 	URL       string
 }
 
-// GPT is a ChatGPT API configuration settings.
+// GPT is a ChatGPT API configuration settings, it's a legacy form of OpenAI compatible provider.
 type GPT struct {
-	Bearer       string       `toml:"bearer"`
-	Organization string       `toml:"organization"`
-	MaxTokens    uint         `toml:"max_tokens"`
-	URL          string       `toml:"url"`
-	Proxy        string       `toml:"proxy"`
-	Temperature  float32      `toml:"temperature"`
-	Client       *http.Client `toml:"-"`
+	Bearer       string   `toml:"bearer"`
+	Organization string   `toml:"organization"`
+	MaxTokens    uint     `toml:"max_tokens"`
+	URL          string   `toml:"url"`
+	Proxy        string   `toml:"proxy"`
+	Temperature  float32  `toml:"temperature"`
+	Models       []string `toml:"models"` // allowed models, the first one is the default
+	Stream       bool     `toml:"stream"`
+	Timeout      int      `toml:"timeout"`
 }
 
-// Response returns ChatGPT response.
-func (gpt *GPT) Response(ctx context.Context, content string, model aoapi.Model) (string, error) {
-	if gpt.Client == nil {
-		return "", fmt.Errorf("gpt client is not defined")
-	}
-
-	request := &aoapi.CompletionRequest{
-		Model:       model,
-		Messages:    []aoapi.Message{{Role: aoapi.RoleUser, Content: content}},
-		MaxTokens:   gpt.MaxTokens,
-		Temperature: &gpt.Temperature,
+// provider returns a provider configuration with the name and default model if models are not set.
+func (gpt *GPT) provider(name, model string) llm.Config {
+	models := gpt.Models
+	if len(models) == 0 {
+		models = []string{model}
 	}
 
-	params := aoapi.Params{
-		Bearer:       gpt.Bearer,
-		Organization: gpt.Organization,
+	return llm.Config{
+		Name:         name,
+		Type:         llm.TypeOpenAI,
 		URL:          gpt.URL,
-		StopMarker:   "....",
+		Token:        gpt.Bearer,
+		Organization: gpt.Organization,
+		Models:       models,
+		MaxTokens:    int(gpt.MaxTokens),
+		Temperature:  &gpt.Temperature,
+		Proxy:        gpt.Proxy,
+		Stream:       gpt.Stream,
+		Timeout:      gpt.Timeout,
 	}
+}
 
-	resp, err := aoapi.Completion(ctx, gpt.Client, request, params)
-	if err != nil {
-		return "", fmt.Errorf("gpt completion error: %w", err)
+// YandexGPT is a Yandex GPT API configuration settings, it's a legacy form of Yandex provider.
+type YandexGPT struct {
+	APIKey  string `toml:"api_key"`
+	URL     string `toml:"url"`
+	Proxy   string `toml:"proxy"`
+	Timeout int    `toml:"timeout"`
+}
+
+// provider returns a provider configuration with the name.
+func (yt *YandexGPT) provider(name string) llm.Config {
+	return llm.Config{
+		Name:    name,
+		Type:    llm.TypeYandex,
+		URL:     yt.URL,
+		Token:   yt.APIKey,
+		Proxy:   yt.Proxy,
+		Timeout: yt.Timeout,
 	}
+}
 
-	return resp.String(), nil
+// Quota is a limit of AI commands usage, zero values mean no limit.
+type Quota struct {
+	Requests int `toml:"requests"`
+	Tokens   int `toml:"tokens"`
 }
 
-// YandexGPT is a Yandex GPT API configuration settings.
-type YandexGPT struct {
-	APIKey string       `toml:"api_key"`
-	URL    string       `toml:"url"`
-	Proxy  string       `toml:"proxy"`
-	Client *http.Client `toml:"-"`
+// IsZero returns true if there are no limits.
+func (q Quota) IsZero() bool {
+	return q.Requests < 1 && q.Tokens < 1
 }
 
-// Response returns Yandex GPT response.
-func (yt *YandexGPT) Response(ctx context.Context, content string) (string, error) {
-	if yt.Client == nil {
-		return "", fmt.Errorf("yandex gpt client is not defined")
-	}
+// Exceeded returns true if the usage reached the quota.
+func (q Quota) Exceeded(u db.Usage) bool {
+	return (q.Requests > 0 && u.Requests >= q.Requests) || (q.Tokens > 0 && u.Tokens >= q.Tokens)
+}
 
-	request := &ygpt.ChatRequest{APIKey: yt.APIKey, URL: yt.URL, Text: content}
+// AI is a common configuration of AI commands.
+type AI struct {
+	HistorySize   int         `toml:"history_size"`   // maximum number of saved conversation messages per chat and provider
+	Prompt        string      `toml:"prompt"`         // default system prompt, chats can override it
+	Markup        markup.Mode `toml:"markup"`         // format of answers: empty for plain text, "markdown" or "html"
+	StreamTimeout int64       `toml:"stream_timeout"` // timeout of streamed answers (seconds) instead of the main one
+	ChatDaily     Quota       `toml:"chat_daily"`
+	ChatMonthly   Quota       `toml:"chat_monthly"`
+	UserDaily     Quota       `toml:"user_daily"` // user's quotas are common for all chats
+	UserMonthly   Quota       `toml:"user_monthly"`
+	Retries       int         `toml:"retries"`     // number of additional attempts after transient errors
+	RetryDelay    float64     `toml:"retry_delay"` // delay before the first retry (seconds), it's doubled every time
+	Fallback      []string    `toml:"fallback"`    // ordered providers which are asked if the requested one fails
+	CacheTTL      int64       `toml:"cache_ttl"`   // lifetime of cached answers (seconds), zero value disables the cache
+}
 
-	resp, err := ygpt.GenerationChat(ctx, yt.Client, request)
-	if err != nil {
-		return "", fmt.Errorf("yandex gpt completion error: %w", err)
-	}
+// CacheSince returns the creation time of the oldest valid cached answer.
+func (ai *AI) CacheSince() time.Time {
+	return time.Now().Add(-time.Duration(ai.CacheTTL) * time.Second)
+}
 
-	return resp.String(), nil
+// RetryInterval returns a delay before the first retry.
+func (ai *AI) RetryInterval() time.Duration {
+	return time.Duration(ai.RetryDelay * float64(time.Second))
 }
 
 // Config is common configuration struct.
 type Config struct {
 	sync.Mutex
-	M          Main      `toml:"main"`
-	B          Bot       `toml:"bot"`
-	G          GPT       `toml:"gpt"`
-	Y          YandexGPT `toml:"yandex_gpt"`
-	DS         GPT       `toml:"deepseek"`
-	L          Log       `toml:"log"`
-	Bt         *botgolang.Bot
+	M          Main         `toml:"main"`
+	B          Bot          `toml:"bot"`
+	W          Webhook      `toml:"webhook"`
+	T          Telegram     `toml:"telegram"`
+	C          Console      `toml:"console"`
+	G          GPT          `toml:"gpt"`
+	Y          YandexGPT    `toml:"yandex_gpt"`
+	DS         GPT          `toml:"deepseek"`
+	AI         AI           `toml:"ai"`
+	Providers  []llm.Config `toml:"llm"`
+	LLM        *llm.Registry
+	L          Log `toml:"log"`
+	Messenger  transport.Messenger
 	DB         *sql.DB
 	BuildInfo  *BuildInfo
 	RandSource rand.Source
@@ -143,6 +289,21 @@ type Config struct {
 
 // New returns new configuration.
 func New(fileName string, b *BuildInfo, server *httptest.Server) (*Config, error) {
+	return load(fileName, b, server, nil)
+}
+
+// NewConsole returns new configuration with the console messenger instead of the configured one,
+// it reads messages from in and writes bot replies to out.
+func NewConsole(fileName string, b *BuildInfo, in io.Reader, out io.Writer) (*Config, error) {
+	return load(fileName, b, nil, func(c *Config) transport.Messenger {
+		return c.C.messenger(in, out)
+	})
+}
+
+// load returns new configuration, the messenger is created by newMessenger if it's set.
+func load(
+	fileName string, b *BuildInfo, server *httptest.Server, newMessenger func(*Config) transport.Messenger,
+) (*Config, error) {
 	const (
 		testConfig = "/tmp/gobot_config_test.toml"
 		dockerDir  = "/data/gobot"
@@ -171,20 +332,39 @@ func New(fileName string, b *BuildInfo, server *httptest.Server) (*Config, error
 		return nil, errors.New("number of workers must be greater than 0")
 	}
 
-	if err = c.initLog(); err != nil {
-		return nil, fmt.Errorf("log init: %w", err)
+	switch c.B.Mode {
+	case "", ModePolling:
+		c.B.Mode = ModePolling
+	case ModeWebhook:
+		if err = c.W.validate(); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown bot mode %q, use: %q or %q", c.B.Mode, ModePolling, ModeWebhook)
 	}
 
-	if err = c.initGPT(); err != nil {
-		return nil, fmt.Errorf("GPT init: %w", err)
+	if c.M.Events < 1 {
+		c.M.Events = defaultEvents
 	}
 
-	if err = c.initDeepSeek(); err != nil {
-		return nil, fmt.Errorf("DeepSeek init: %w", err)
+	if c.AI.HistorySize < 1 {
+		c.AI.HistorySize = defaultHistorySize
 	}
 
-	if err = c.initYandexGPT(); err != nil {
-		return nil, fmt.Errorf("yandex GPT init: %w", err)
+	if c.AI.StreamTimeout < 1 {
+		c.AI.StreamTimeout = defaultStreamTimeout
+	}
+
+	if err = c.AI.Markup.Validate(); err != nil {
+		return nil, fmt.Errorf("AI markup: %w", err)
+	}
+
+	if err = c.initLog(); err != nil {
+		return nil, fmt.Errorf("log init: %w", err)
+	}
+
+	if err = c.initLLM(); err != nil {
+		return nil, fmt.Errorf("LLM init: %w", err)
 	}
 
 	if err = c.parseTimezone(); err != nil {
@@ -195,15 +375,7 @@ func New(fileName string, b *BuildInfo, server *httptest.Server) (*Config, error
 	if server != nil {
 		client = server.Client()
 		c.B.ULR = server.URL
-	}
-	bot, err := botgolang.NewBot(
-		c.B.Token,
-		botgolang.BotDebug(c.M.Debug),
-		botgolang.BotApiURL(c.B.ULR),
-		botgolang.BotHTTPClient(*client),
-	)
-	if err != nil {
-		return nil, fmt.Errorf("can not init bot: %Output", err)
+		c.T.URL = server.URL
 	}
 
 	database, err := sql.Open("sqlite3", c.M.Storage)
@@ -211,10 +383,21 @@ func New(fileName string, b *BuildInfo, server *httptest.Server) (*Config, error
 		return nil, fmt.Errorf("database file: %Output", err)
 	}
 
-	b.URL = c.B.Src
 	c.timeout = time.Duration(c.M.Timeout) * time.Second
+	if err = c.migrate(database); err != nil {
+		return nil, errors.Join(fmt.Errorf("database migration: %w", err), database.Close())
+	}
+
+	// the messenger can store its data in the database
 	c.DB = database
-	c.Bt = bot
+
+	if newMessenger != nil {
+		c.Messenger = newMessenger(c)
+	} else if err = c.initMessenger(client); err != nil {
+		return nil, errors.Join(fmt.Errorf("can not init bot: %w", err), database.Close())
+	}
+
+	b.URL = c.B.Src
 	c.BuildInfo = b
 
 	c.RandSource = random.New(c.M.SecureRandom, 0, 0)
@@ -239,6 +422,54 @@ func (c *Config) Context() (context.Context, context.CancelFunc) {
 	return context.WithTimeout(context.Background(), c.timeout)
 }
 
+// StreamContext returns context for streamed AI responses, it keeps values of the parent context
+// but ignores its deadline, because long generation can take more time than the main timeout.
+func (c *Config) StreamContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.WithoutCancel(ctx), time.Duration(c.AI.StreamTimeout)*time.Second)
+}
+
+// migrate applies pending database schema migrations.
+func (c *Config) migrate(database *sql.DB) error {
+	ctx, cancel := c.Context()
+	defer cancel()
+
+	_, err := db.Migrate(ctx, database)
+	return err
+}
+
+// initMessenger initializes the messenger client.
+func (c *Config) initMessenger(client *http.Client) error {
+	switch c.B.Messenger {
+	case "", MessengerVKTeams:
+		bot, err := botgolang.NewBot(
+			c.B.Token,
+			botgolang.BotDebug(c.M.Debug),
+			botgolang.BotApiURL(c.B.ULR),
+			botgolang.BotHTTPClient(*client),
+		)
+		if err != nil {
+			return err
+		}
+
+		c.B.Messenger = MessengerVKTeams
+		c.Messenger = transport.NewVKTeams(bot)
+	case MessengerTelegram:
+		if c.T.Token == "" {
+			return errors.New("telegram token is required")
+		}
+
+		if c.B.Mode == ModeWebhook {
+			return errors.New("webhook mode is supported only for vkteams messenger")
+		}
+
+		c.Messenger = transport.NewTelegram(c.T.URL, c.T.Token, c.T.Poll, client, c.DB)
+	default:
+		return fmt.Errorf("unknown messenger %q, use: %q or %q", c.B.Messenger, MessengerVKTeams, MessengerTelegram)
+	}
+
+	return nil
+}
+
 // initLog initializes logging.
 func (c *Config) initLog() error {
 	const tmpDir = "/tmp"
@@ -270,10 +501,11 @@ func (c *Config) initLog() error {
 	return nil
 }
 
-func gptInit(key, uri, proxy string) (*http.Client, error) {
-	if (key == "") || (uri == "") {
-		// no config settings
-		return nil, nil
+// httpClient returns HTTP client with the proxy or environment proxy settings and the timeout (seconds).
+func httpClient(proxy string, timeout int) (*http.Client, error) {
+	client := &http.Client{
+		Transport: &http.Transport{Proxy: http.ProxyFromEnvironment},
+		Timeout:   time.Duration(timeout) * time.Second,
 	}
 
 	if proxy != "" {
@@ -282,54 +514,59 @@ func gptInit(key, uri, proxy string) (*http.Client, error) {
 			return nil, fmt.Errorf("failed to parse proxy URL: %w", err)
 		}
 
-		return &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}, nil
+		client.Transport = &http.Transport{Proxy: http.ProxyURL(proxyURL)}
 	}
 
-	return &http.Client{Transport: &http.Transport{Proxy: http.ProxyFromEnvironment}}, nil
+	return client, nil
 }
 
-// initGPT initializes GPT client.
-func (c *Config) initGPT() error {
-	if c.G.Client != nil {
-		return nil
-	}
+// initLLM initializes LLM providers registry.
+// Legacy sections "gpt", "deepseek" and "yandex_gpt" are added as providers before "llm" ones
+// if they have credentials and URL.
+func (c *Config) initLLM() error {
+	var configs []llm.Config
 
-	client, err := gptInit(c.G.Bearer, c.G.URL, c.G.Proxy)
-	if err != nil {
-		return err
+	if c.G.Bearer != "" && c.G.URL != "" {
+		configs = append(configs, c.G.provider("gpt", string(aoapi.ModelGPT4oMini)))
 	}
 
-	c.G.Client = client
-	return nil
-}
-
-// initYandexGPT initializes Yandex GPT client.
-func (c *Config) initYandexGPT() error {
-	if c.Y.Client != nil {
-		return nil
+	if c.DS.Bearer != "" && c.DS.URL != "" {
+		configs = append(configs, c.DS.provider("ds", string(aoapi.ModelDeepSeekChat)))
 	}
 
-	client, err := gptInit(c.Y.APIKey, c.Y.URL, c.Y.Proxy)
-	if err != nil {
-		return err
+	if c.Y.APIKey != "" && c.Y.URL != "" {
+		configs = append(configs, c.Y.provider("ygpt"))
 	}
 
-	c.Y.Client = client
-	return nil
-}
+	configs = append(configs, c.Providers...)
+	providers := make([]llm.Provider, 0, len(configs))
+
+	for _, cfg := range configs {
+		client, err := httpClient(cfg.Proxy, cfg.Timeout)
+		if err != nil {
+			return fmt.Errorf("provider %q: %w", cfg.Name, err)
+		}
+
+		p, err := llm.New(cfg, client)
+		if err != nil {
+			return err
+		}
 
-// initDeepSeek initializes initDeepSeek client.
-func (c *Config) initDeepSeek() error {
-	if c.DS.Client != nil {
-		return nil
+		providers = append(providers, p)
 	}
 
-	client, err := gptInit(c.DS.Bearer, c.DS.URL, c.DS.Proxy)
+	registry, err := llm.NewRegistry(providers...)
 	if err != nil {
 		return err
 	}
 
-	c.DS.Client = client
+	for _, name := range c.AI.Fallback {
+		if _, ok := registry.Get(name); !ok {
+			return fmt.Errorf("unknown fallback provider %q", name)
+		}
+	}
+
+	c.LLM = registry
 	return nil
 }
 
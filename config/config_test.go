@@ -6,7 +6,10 @@ import (
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+
+	"github.com/z0rr0/gobot/transport"
 )
 
 const (
@@ -45,8 +48,12 @@ func TestNew(t *testing.T) {
 			t.Error(e)
 		}
 	}()
-	if c.Bt.Info.ID != "123" {
-		t.Errorf("c.Bt.Info.ID = %v, want %v", c.Bt.Info.ID, 123)
+	vk, ok := c.Messenger.(*transport.VKTeams)
+	if !ok {
+		t.Fatalf("c.Messenger = %T, want VK Teams", c.Messenger)
+	}
+	if info := vk.Info(); info.ID != "123" {
+		t.Errorf("c.Messenger.Info().ID = %v, want %v", info.ID, 123)
 	}
 }
 
@@ -113,3 +120,102 @@ func TestCleanFileName(t *testing.T) {
 		})
 	}
 }
+
+func TestWebhook_validate(t *testing.T) {
+	testCases := []struct {
+		name    string
+		webhook Webhook
+		path    string
+		err     bool
+	}{
+		{name: "valid", webhook: Webhook{Address: ":8080", Path: "/hook", Secret: "s"}, path: "/hook"},
+		{name: "default_path", webhook: Webhook{Address: ":8080", Secret: "s"}, path: defaultWebhookPath},
+		{name: "no_address", webhook: Webhook{Secret: "s"}, err: true},
+		{name: "no_secret", webhook: Webhook{Address: ":8080"}, err: true},
+		{name: "bad_path", webhook: Webhook{Address: ":8080", Path: "hook", Secret: "s"}, err: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.webhook.validate()
+			if (err != nil) != tc.err {
+				t.Fatalf("failed error: %v", err)
+			}
+
+			if !tc.err && tc.webhook.Path != tc.path {
+				t.Errorf("failed path %q, want %q", tc.webhook.Path, tc.path)
+			}
+		})
+	}
+}
+
+func TestConfig_initMessenger(t *testing.T) {
+	testCases := []struct {
+		name      string
+		bot       Bot
+		telegram  Telegram
+		messenger string
+		err       bool
+	}{
+		{name: "telegram", bot: Bot{Messenger: MessengerTelegram}, telegram: Telegram{Token: "x"}, messenger: "*transport.Telegram"},
+		{name: "telegram_no_token", bot: Bot{Messenger: MessengerTelegram}, err: true},
+		{
+			name:     "telegram_webhook",
+			bot:      Bot{Messenger: MessengerTelegram, Mode: ModeWebhook},
+			telegram: Telegram{Token: "x"},
+			err:      true,
+		},
+		{name: "unknown", bot: Bot{Messenger: "unknown"}, err: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := &Config{B: tc.bot, T: tc.telegram}
+
+			err := c.initMessenger(http.DefaultClient)
+			if (err != nil) != tc.err {
+				t.Fatalf("failed error: %v", err)
+			}
+
+			if m := fmt.Sprintf("%T", c.Messenger); !tc.err && m != tc.messenger {
+				t.Errorf("failed messenger %s, want %s", m, tc.messenger)
+			}
+		})
+	}
+}
+
+func TestConsole_messenger(t *testing.T) {
+	testCases := []struct {
+		name    string
+		console Console
+		members string
+	}{
+		{name: "defaults", members: defaultConsoleUser},
+		{
+			name:    "members",
+			console: Console{ChatID: "chat", UserID: "user", Members: []string{"a", "b"}},
+			members: "a,b,user",
+		},
+		{name: "user_member", console: Console{UserID: "a", Members: []string{"a", "b"}}, members: "a,b"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			m := tc.console.messenger(nil, nil)
+
+			users, err := m.Members("")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ids := make([]string, len(users))
+			for i, u := range users {
+				ids[i] = u.ID
+			}
+
+			if s := strings.Join(ids, ","); s != tc.members {
+				t.Errorf("failed members %s, want %s", s, tc.members)
+			}
+		})
+	}
+}
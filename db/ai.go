@@ -0,0 +1,100 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// Roles of AI conversation messages.
+const (
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+)
+
+// AIMessage is a message of AI conversation in a chat.
+type AIMessage struct {
+	ID       int64     `db:"id"`
+	ChatID   string    `db:"chat_id"`
+	Provider string    `db:"provider"`
+	Role     string    `db:"role"`
+	Content  string    `db:"content"`
+	Created  time.Time `db:"created"`
+}
+
+// AIMessages returns n latest conversation messages of the chat and provider in chronological order.
+func AIMessages(ctx context.Context, db *sql.DB, chatID, provider string, n int) ([]AIMessage, error) {
+	const query = "SELECT `id`, `chat_id`, `provider`, `role`, `content`, `created` FROM `ai_message` " +
+		"WHERE `chat_id`=? AND `provider`=? ORDER BY `id` DESC LIMIT ?;"
+
+	rows, err := db.QueryContext(ctx, query, chatID, provider, n)
+	if err != nil {
+		return nil, fmt.Errorf("ai messages query: %w", err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var messages []AIMessage
+	for rows.Next() {
+		var m AIMessage
+
+		if err = rows.Scan(&m.ID, &m.ChatID, &m.Provider, &m.Role, &m.Content, &m.Created); err != nil {
+			return nil, fmt.Errorf("ai messages scan: %w", err)
+		}
+
+		messages = append(messages, m)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("ai messages rows: %w", err)
+	}
+
+	slices.Reverse(messages)
+	return messages, nil
+}
+
+// SaveAIMessages saves new conversation messages of the chat and provider
+// and removes old ones, so only "keep" latest messages are stored.
+func SaveAIMessages(ctx context.Context, db *sql.DB, chatID, provider string, keep int, messages ...AIMessage) error {
+	const (
+		insertQuery = "INSERT INTO `ai_message` (`chat_id`, `provider`, `role`, `content`, `created`) VALUES (?,?,?,?,?);"
+		deleteQuery = "DELETE FROM `ai_message` WHERE `chat_id`=? AND `provider`=? AND `id` NOT IN " +
+			"(SELECT `id` FROM `ai_message` WHERE `chat_id`=? AND `provider`=? ORDER BY `id` DESC LIMIT ?);"
+	)
+
+	return InTransaction(ctx, db, func(tx *sql.Tx) error {
+		now := time.Now().UTC()
+
+		for _, m := range messages {
+			if _, err := tx.ExecContext(ctx, insertQuery, chatID, provider, m.Role, m.Content, now); err != nil {
+				return fmt.Errorf("ai message insert: %w", err)
+			}
+		}
+
+		if _, err := tx.ExecContext(ctx, deleteQuery, chatID, provider, chatID, provider, keep); err != nil {
+			return fmt.Errorf("ai message delete: %w", err)
+		}
+
+		return nil
+	})
+}
+
+// DeleteAIMessages removes all conversation messages of the chat and provider and returns their number.
+func DeleteAIMessages(ctx context.Context, db *sql.DB, chatID, provider string) (int64, error) {
+	const query = "DELETE FROM `ai_message` WHERE `chat_id`=? AND `provider`=?;"
+
+	result, err := db.ExecContext(ctx, query, chatID, provider)
+	if err != nil {
+		return 0, fmt.Errorf("ai message delete exec: %w", err)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("ai message delete rows: %w", err)
+	}
+
+	return n, nil
+}
@@ -0,0 +1,72 @@
+package db
+
+import (
+	"context"
+	"slices"
+	"testing"
+)
+
+func TestAIMessages(t *testing.T) {
+	const (
+		chatID   = "TestAIMessages"
+		provider = "test"
+	)
+
+	db, err := open()
+	if err != nil {
+		t.Fatalf("failed to open database: %s", err)
+	}
+	defer func() {
+		if e := db.Close(); e != nil {
+			t.Errorf("failed to close database: %s", e)
+		}
+	}()
+
+	ctx := context.Background()
+	if _, err = DeleteAIMessages(ctx, db, chatID, provider); err != nil {
+		t.Fatalf("failed to delete messages: %s", err)
+	}
+
+	for _, content := range []string{"q1", "q2", "q3"} {
+		messages := []AIMessage{
+			{Role: RoleUser, Content: content},
+			{Role: RoleAssistant, Content: "a" + content[1:]},
+		}
+		if err = SaveAIMessages(ctx, db, chatID, provider, 4, messages...); err != nil {
+			t.Fatalf("failed to save messages: %s", err)
+		}
+	}
+
+	// other provider's messages are not affected
+	if err = SaveAIMessages(ctx, db, chatID, "other", 4, AIMessage{Role: RoleUser, Content: "other"}); err != nil {
+		t.Fatalf("failed to save messages: %s", err)
+	}
+
+	items, err := AIMessages(ctx, db, chatID, provider, 10)
+	if err != nil {
+		t.Fatalf("failed to get messages: %s", err)
+	}
+
+	contents := make([]string, len(items))
+	for i, m := range items {
+		contents[i] = m.Role + ":" + m.Content
+	}
+
+	expected := []string{"user:q2", "assistant:a2", "user:q3", "assistant:a3"}
+	if !slices.Equal(contents, expected) {
+		t.Errorf("failed messages %v, expected %v", contents, expected)
+	}
+
+	n, err := DeleteAIMessages(ctx, db, chatID, provider)
+	if err != nil {
+		t.Fatalf("failed to delete messages: %s", err)
+	}
+
+	if n != 4 {
+		t.Errorf("failed deleted messages %d", n)
+	}
+
+	if n, err = DeleteAIMessages(ctx, db, chatID, "other"); err != nil || n != 1 {
+		t.Errorf("failed deleted other messages %d: %v", n, err)
+	}
+}
@@ -0,0 +1,53 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// CachedAnswer is a saved AI answer of the request.
+type CachedAnswer struct {
+	Key      string    `db:"key"`
+	Provider string    `db:"provider"`
+	Answer   string    `db:"answer"`
+	Created  time.Time `db:"created"`
+}
+
+// GetCachedAnswer returns an answer by the key if it was created after since,
+// error wraps sql.ErrNoRows if there is no one.
+func GetCachedAnswer(ctx context.Context, db *sql.DB, key string, since time.Time) (*CachedAnswer, error) {
+	const query = "SELECT `key`, `provider`, `answer`, `created` FROM `ai_cache` " +
+		"WHERE `key`=? AND `created`>? LIMIT 1;"
+
+	a := &CachedAnswer{}
+	err := db.QueryRowContext(ctx, query, key, since.UTC()).Scan(&a.Key, &a.Provider, &a.Answer, &a.Created)
+	if err != nil {
+		return nil, fmt.Errorf("cached answer scan: %w", err)
+	}
+
+	return a, nil
+}
+
+// SaveCachedAnswer saves the answer and removes expired ones which were created before since.
+func SaveCachedAnswer(ctx context.Context, db *sql.DB, a *CachedAnswer, since time.Time) error {
+	const (
+		insertQuery = "INSERT OR REPLACE INTO `ai_cache` (`key`, `provider`, `answer`, `created`) VALUES (?,?,?,?);"
+		deleteQuery = "DELETE FROM `ai_cache` WHERE `created`<=?;"
+	)
+
+	return InTransaction(ctx, db, func(tx *sql.Tx) error {
+		a.Created = time.Now().UTC()
+
+		if _, err := tx.ExecContext(ctx, insertQuery, a.Key, a.Provider, a.Answer, a.Created); err != nil {
+			return fmt.Errorf("cached answer insert: %w", err)
+		}
+
+		if _, err := tx.ExecContext(ctx, deleteQuery, since.UTC()); err != nil {
+			return fmt.Errorf("cached answer delete: %w", err)
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,55 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCachedAnswer(t *testing.T) {
+	db, err := open()
+	if err != nil {
+		t.Fatalf("failed to open database: %s", err)
+	}
+	defer func() {
+		if e := db.Close(); e != nil {
+			t.Errorf("failed to close database: %s", e)
+		}
+	}()
+
+	var (
+		ctx    = context.Background()
+		now    = time.Now()
+		answer = &CachedAnswer{Key: "TestCachedAnswer", Provider: "gpt", Answer: "answer"}
+	)
+
+	if err = SaveCachedAnswer(ctx, db, answer, now.Add(-time.Hour)); err != nil {
+		t.Fatalf("failed to save answer: %v", err)
+	}
+
+	cached, err := GetCachedAnswer(ctx, db, answer.Key, now.Add(-time.Minute))
+	if err != nil {
+		t.Fatalf("failed to get answer: %v", err)
+	}
+
+	if cached.Provider != answer.Provider || cached.Answer != answer.Answer {
+		t.Errorf("failed answer %+v", cached)
+	}
+
+	// expired answer
+	if _, err = GetCachedAnswer(ctx, db, answer.Key, now.Add(time.Minute)); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected ErrNoRows, got %v", err)
+	}
+
+	// the previous answer is removed as expired
+	other := &CachedAnswer{Key: "TestCachedAnswerOther", Provider: "ds", Answer: "other"}
+	if err = SaveCachedAnswer(ctx, db, other, now.Add(time.Minute)); err != nil {
+		t.Fatalf("failed to save answer: %v", err)
+	}
+
+	if _, err = GetCachedAnswer(ctx, db, answer.Key, time.Time{}); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected ErrNoRows, got %v", err)
+	}
+}
@@ -5,21 +5,44 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"maps"
 	"time"
 )
 
+// AIOptions are chat's overrides of AI provider's completion options, zero values mean defaults.
+type AIOptions struct {
+	Model       string   `json:"model,omitempty"`
+	Temperature *float32 `json:"temperature,omitempty"`
+	MaxTokens   int      `json:"max_tokens,omitempty"`
+}
+
+// Equal returns true if the two options are equal.
+func (o AIOptions) Equal(a AIOptions) bool {
+	sameTemperature := o.Temperature == a.Temperature ||
+		(o.Temperature != nil && a.Temperature != nil && *o.Temperature == *a.Temperature)
+
+	return o.Model == a.Model && o.MaxTokens == a.MaxTokens && sameTemperature
+}
+
+// IsZero returns true if there are no overrides.
+func (o AIOptions) IsZero() bool {
+	return o.Equal(AIOptions{})
+}
+
 // Chat is a struct for chat's info.
+// ExcludeUsers, SkipUsers and WeekDays are in-memory views of users' states from the chat_user_state table.
 type Chat struct {
-	ID           string    `db:"id"`
-	Active       bool      `db:"active"`
-	GPT          bool      `db:"gpt"`
-	Exclude      string    `db:"exclude"`
-	Skip         string    `db:"skip"`
-	Days         string    `db:"days"`
-	URL          string    `db:"url"`
-	URLText      string    `db:"url_text"`
-	Created      time.Time `db:"created_at"`
-	Updated      time.Time `db:"updated_at"`
+	ID           string               `db:"id"`
+	Active       bool                 `db:"active"`
+	GPT          bool                 `db:"gpt"`
+	URL          string               `db:"url"`
+	URLText      string               `db:"url_text"`
+	Timezone     string               `db:"timezone"`   // empty value for the default timezone
+	Order        string               `db:"go_order"`   // empty value for random order
+	Prompt       string               `db:"prompt"`     // empty value for the default system prompt of AI commands
+	AIOptions    map[string]AIOptions `db:"ai_options"` // AI providers' options by their names
+	Created      time.Time            `db:"created_at"`
+	Updated      time.Time            `db:"updated_at"`
 	ExcludeUsers map[string]struct{}
 	SkipUsers    map[string]struct{}
 	WeekDays     map[time.Weekday]map[string]struct{}
@@ -28,181 +51,131 @@ type Chat struct {
 
 // Equal returns true if the two chats are equal.
 func (chat *Chat) Equal(c *Chat) bool {
-	value := chat.ID == c.ID && chat.Active == c.Active && chat.Exclude == c.Exclude && chat.Skip == c.Skip
-	value = value && chat.Days == c.Days && chat.URL == c.URL && chat.URLText == c.URLText
+	value := chat.ID == c.ID && chat.Active == c.Active && chat.GPT == c.GPT
+	value = value && maps.Equal(chat.ExcludeUsers, c.ExcludeUsers) && maps.Equal(chat.SkipUsers, c.SkipUsers)
+	value = value && maps.EqualFunc(chat.WeekDays, c.WeekDays, maps.Equal) && chat.URL == c.URL && chat.URLText == c.URLText
+	value = value && chat.Timezone == c.Timezone && chat.Order == c.Order && chat.Prompt == c.Prompt
+	value = value && maps.EqualFunc(chat.AIOptions, c.AIOptions, AIOptions.Equal)
 	return value && chat.Created.Equal(c.Created) // updated chan be change automatically
 }
 
-// AddExclude adds user to an exclude set.
-func (chat *Chat) AddExclude(userIDs map[string]struct{}) {
-	if chat.ExcludeUsers == nil {
-		chat.ExcludeUsers = make(map[string]struct{})
-	}
-	for userID := range userIDs {
-		chat.ExcludeUsers[userID] = struct{}{}
-	}
+// Location returns the chat's timezone location or defaultLocation if it is not set or invalid.
+func (chat *Chat) Location(defaultLocation *time.Location) *time.Location {
+	return location(chat.Timezone, defaultLocation)
 }
 
-// DelExclude removes user from an exclude set.
-func (chat *Chat) DelExclude(userIDs map[string]struct{}) {
-	if chat.ExcludeUsers == nil {
-		return
+// location returns a location by timezone name or defaultLocation if the name is empty or invalid.
+func location(timezone string, defaultLocation *time.Location) *time.Location {
+	if timezone == "" {
+		return defaultLocation
 	}
-	for userID := range userIDs {
-		delete(chat.ExcludeUsers, userID)
-	}
-}
 
-// ExcludeToString returns a string of exclude users set.
-func (chat *Chat) ExcludeToString() error {
-	s, err := setToString(chat.ExcludeUsers)
+	loc, err := time.LoadLocation(timezone)
 	if err != nil {
-		return err
+		return defaultLocation
 	}
 
-	chat.Exclude = s
-	return nil
+	return loc
 }
 
-// ExcludeToMap loads exclude users set from a string.
-func (chat *Chat) ExcludeToMap() error {
-	m, err := stringToSet(chat.Exclude)
-	if err != nil {
-		return err
+// SetAIOptions sets the provider's options, zero options remove overrides.
+func (chat *Chat) SetAIOptions(provider string, options AIOptions) {
+	if options.IsZero() {
+		delete(chat.AIOptions, provider)
+		return
 	}
 
-	chat.ExcludeUsers = m
-	return nil
-}
-
-// SkipToString returns a string of skipped users set.
-func (chat *Chat) SkipToString() error {
-	s, err := setToString(chat.SkipUsers)
-	if err != nil {
-		return err
+	if chat.AIOptions == nil {
+		chat.AIOptions = make(map[string]AIOptions)
 	}
 
-	chat.Skip = s
-	return nil
+	chat.AIOptions[provider] = options
 }
 
-// SkipToMap loads skipped users set from a string.
-func (chat *Chat) SkipToMap() error {
-	m, err := stringToSet(chat.Skip)
-	if err != nil {
-		return err
+// marshalAIOptions returns JSON value of AI options or empty string if there are no ones.
+func (chat *Chat) marshalAIOptions() (string, error) {
+	if len(chat.AIOptions) == 0 {
+		return "", nil
 	}
 
-	chat.SkipUsers = m
-	return nil
-}
-
-// AddSkip adds user to an skip-set.
-func (chat *Chat) AddSkip(userID string) {
-	if chat.SkipUsers == nil {
-		chat.SkipUsers = make(map[string]struct{})
+	data, err := json.Marshal(chat.AIOptions)
+	if err != nil {
+		return "", fmt.Errorf("ai options marshal: %w", err)
 	}
-	chat.SkipUsers[userID] = struct{}{}
-}
 
-// DelSkip removes user from an skip-set.
-func (chat *Chat) DelSkip(userID string) {
-	delete(chat.SkipUsers, userID)
+	return string(data), nil
 }
 
-// MarshalDays converts week days to a string.
-func (chat *Chat) MarshalDays() error {
-	if len(chat.WeekDays) == 0 {
-		chat.Days = ""
+// unmarshalAIOptions loads AI options from JSON value.
+func (chat *Chat) unmarshalAIOptions(data string) error {
+	if data == "" {
+		chat.AIOptions = nil
 		return nil
 	}
 
-	data := make(map[int][]string, len(chat.WeekDays))
-
-	for k, v := range chat.WeekDays {
-		dayNumber := int(k)
-		data[dayNumber] = make([]string, 0, len(v))
-
-		for vk := range v {
-			data[dayNumber] = append(data[dayNumber], vk)
-		}
-	}
-
-	b, err := json.Marshal(data)
-	if err != nil {
-		return fmt.Errorf("failed to marshal days: %w", err)
+	if err := json.Unmarshal([]byte(data), &chat.AIOptions); err != nil {
+		return fmt.Errorf("ai options unmarshal: %w", err)
 	}
 
-	chat.Days = string(b)
 	return nil
 }
 
-// UnmarshalDays converts a string to week days.
-func (chat *Chat) UnmarshalDays() error {
-	if chat.Days == "" {
-		chat.WeekDays = nil
-		return nil
-	}
-
-	data := make(map[int][]string)
-
-	err := json.Unmarshal([]byte(chat.Days), &data)
-	if err != nil {
-		return fmt.Errorf("failed to unmarshal days: %w", err)
+// AddExclude adds user to an exclude set.
+func (chat *Chat) AddExclude(userIDs map[string]struct{}) {
+	if chat.ExcludeUsers == nil {
+		chat.ExcludeUsers = make(map[string]struct{})
 	}
-
-	chat.WeekDays = make(map[time.Weekday]map[string]struct{}, len(data))
-	for k, v := range data {
-		chat.WeekDays[time.Weekday(k)] = make(map[string]struct{}, len(v))
-		for i := range v {
-			chat.WeekDays[time.Weekday(k)][v[i]] = struct{}{}
-		}
+	for userID := range userIDs {
+		chat.ExcludeUsers[userID] = struct{}{}
 	}
-
-	return nil
 }
 
-// Marshal converts exclude and skip sets to strings.
-func (chat *Chat) Marshal() error {
-	if err := chat.ExcludeToString(); err != nil {
-		return err
+// DelExclude removes user from an exclude set.
+func (chat *Chat) DelExclude(userIDs map[string]struct{}) {
+	if chat.ExcludeUsers == nil {
+		return
 	}
-
-	if err := chat.SkipToString(); err != nil {
-		return err
+	for userID := range userIDs {
+		delete(chat.ExcludeUsers, userID)
 	}
+}
 
-	if err := chat.MarshalDays(); err != nil {
-		return err
+// AddSkip adds user to an skip-set.
+func (chat *Chat) AddSkip(userID string) {
+	if chat.SkipUsers == nil {
+		chat.SkipUsers = make(map[string]struct{})
 	}
-
-	return nil
+	chat.SkipUsers[userID] = struct{}{}
 }
 
-// Unmarshal converts exclude and skip strings to sets.
-func (chat *Chat) Unmarshal() error {
-	if err := chat.ExcludeToMap(); err != nil {
-		return err
-	}
+// DelSkip removes user from an skip-set.
+func (chat *Chat) DelSkip(userID string) {
+	delete(chat.SkipUsers, userID)
+}
 
-	if err := chat.SkipToMap(); err != nil {
-		return err
+// addWeekDay adds user to a set of absent users of the week day.
+func (chat *Chat) addWeekDay(day time.Weekday, userID string) {
+	if chat.WeekDays == nil {
+		chat.WeekDays = make(map[time.Weekday]map[string]struct{})
 	}
 
-	if err := chat.UnmarshalDays(); err != nil {
-		return err
+	if _, ok := chat.WeekDays[day]; !ok {
+		chat.WeekDays[day] = make(map[string]struct{})
 	}
 
-	return nil
+	chat.WeekDays[day][userID] = struct{}{}
 }
 
 // Update saves chat's info.
 func (chat *Chat) Update(ctx context.Context, db *sql.DB) error {
 	const query = "UPDATE `chat` " +
-		"SET `active`=?, `exclude`=?, `skip`=?, `days`=?, `url`=?, `url_text`=?, `created`=?, `updated`=? " +
+		"SET `active`=?, `gpt`=?, `url`=?, `url_text`=?, `timezone`=?, `go_order`=?, `prompt`=?, `ai_options`=?, " +
+		"`created`=?, `updated`=? " +
 		"WHERE `id`=?"
-	if e := chat.Marshal(); e != nil {
-		return e
+
+	aiOptions, err := chat.marshalAIOptions()
+	if err != nil {
+		return err
 	}
 
 	return InTransaction(ctx, db, func(tx *sql.Tx) error {
@@ -211,8 +184,8 @@ func (chat *Chat) Update(ctx context.Context, db *sql.DB) error {
 			return fmt.Errorf("insert statement: %w", err)
 		}
 		_, err = tx.StmtContext(ctx, stmt).ExecContext(
-			ctx, chat.Active, chat.Exclude, chat.Skip, chat.Days,
-			chat.URL, chat.URLText, chat.Created, time.Now().UTC(), chat.ID,
+			ctx, chat.Active, chat.GPT, chat.URL, chat.URLText, chat.Timezone, chat.Order, chat.Prompt, aiOptions,
+			chat.Created, time.Now().UTC(), chat.ID,
 		)
 		if err != nil {
 			return fmt.Errorf("upsert exec: %w", err)
@@ -230,11 +203,13 @@ func (chat *Chat) Update(ctx context.Context, db *sql.DB) error {
 // Upsert inserts or updates a chat, make it active.
 func (chat *Chat) Upsert(ctx context.Context, db *sql.DB) error {
 	const query = "INSERT INTO `chat` " +
-		"(`id`, `active`, `exclude`, `skip`, `days`, `url`, `url_text`, `created`, `updated`)  VALUES (?,?,?,?,?,?,?,?,?) " +
+		"(`id`, `active`, `gpt`, `url`, `url_text`, `timezone`, `go_order`, `prompt`, `ai_options`, `created`, `updated`) " +
+		"VALUES (?,?,?,?,?,?,?,?,?,?,?) " +
 		"ON CONFLICT(id) DO UPDATE SET `active`=?, `updated`=?;"
 
-	if e := chat.Marshal(); e != nil {
-		return e
+	aiOptions, err := chat.marshalAIOptions()
+	if err != nil {
+		return err
 	}
 
 	return InTransaction(ctx, db, func(tx *sql.Tx) error {
@@ -243,8 +218,8 @@ func (chat *Chat) Upsert(ctx context.Context, db *sql.DB) error {
 			return fmt.Errorf("insert statement: %w", err)
 		}
 		_, err = tx.StmtContext(ctx, stmt).ExecContext(
-			ctx, chat.ID, chat.Active, chat.Exclude, chat.Skip, chat.Days, chat.URL, chat.URLText,
-			chat.Created, chat.Updated, chat.Active, chat.Updated,
+			ctx, chat.ID, chat.Active, chat.GPT, chat.URL, chat.URLText, chat.Timezone, chat.Order, chat.Prompt,
+			aiOptions, chat.Created, chat.Updated, chat.Active, chat.Updated,
 		)
 		if err != nil {
 			return fmt.Errorf("upsert exec: %w", err)
@@ -32,16 +32,20 @@ func InTransaction(ctx context.Context, db *sql.DB, f func(tx *sql.Tx) error) er
 
 // Get returns a chat's pointer by its ID.
 func Get(ctx context.Context, db *sql.DB, id string) (*Chat, error) {
-	const query = "SELECT `id`, `active`, `exclude`, `skip`, `days`, `url`, `url_text`, `created`, `updated`, `gpt` " +
+	const query = "SELECT `id`, `active`, `url`, `url_text`, `timezone`, `go_order`, `prompt`, `ai_options`, " +
+		"`created`, `updated`, `gpt` " +
 		"FROM `chat` WHERE `id`=? LIMIT 1;"
 	stmt, err := db.PrepareContext(ctx, query)
 	if err != nil {
 		return nil, fmt.Errorf("exist statement: %w", err)
 	}
-	chat := &Chat{}
+	var (
+		chat      = &Chat{}
+		aiOptions string
+	)
 	err = stmt.QueryRowContext(ctx, id).Scan(
-		&chat.ID, &chat.Active, &chat.Exclude, &chat.Skip, &chat.Days,
-		&chat.URL, &chat.URLText, &chat.Created, &chat.Updated, &chat.GPT,
+		&chat.ID, &chat.Active, &chat.URL, &chat.URLText, &chat.Timezone, &chat.Order, &chat.Prompt, &aiOptions,
+		&chat.Created, &chat.Updated, &chat.GPT,
 	)
 
 	if err != nil {
@@ -52,7 +56,11 @@ func Get(ctx context.Context, db *sql.DB, id string) (*Chat, error) {
 		return nil, fmt.Errorf("close exist statement: %w", err)
 	}
 
-	if err = chat.Unmarshal(); err != nil {
+	if err = chat.unmarshalAIOptions(aiOptions); err != nil {
+		return nil, err
+	}
+
+	if err = chat.loadStates(ctx, db); err != nil {
 		return nil, err
 	}
 
@@ -74,15 +82,15 @@ func GetOrCreate(ctx context.Context, db *sql.DB, id string) (*Chat, error) {
 	return chat, nil
 }
 
-// CleanSkip removes all skip columns from all chats.
+// CleanSkip removes all expired skip states from all chats.
 func CleanSkip(ctx context.Context, db *sql.DB) error {
-	const query = "UPDATE `chat` SET `skip`='' WHERE `skip` != '';"
+	const query = "DELETE FROM `chat_user_state` WHERE `state`=? AND `until` <= ?;"
 	stmt, err := db.PrepareContext(ctx, query)
 	if err != nil {
 		return fmt.Errorf("exist statement: %w", err)
 	}
 
-	_, err = stmt.ExecContext(ctx)
+	_, err = stmt.ExecContext(ctx, StateSkipped, time.Now().UTC())
 	if err != nil {
 		return fmt.Errorf("clean skip exec: %w", err)
 	}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
 	"maps"
 	"testing"
 	"time"
@@ -17,11 +18,25 @@ const (
 )
 
 func open() (*sql.DB, error) {
-	return sql.Open("sqlite3", dbPath)
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = Migrate(context.Background(), db); err != nil {
+		return nil, errors.Join(err, db.Close())
+	}
+
+	return db, nil
+}
+
+// uniqueID returns an identifier which is unique for every test run, because the database is kept between runs.
+func uniqueID(name string) string {
+	return fmt.Sprintf("%s%d", name, time.Now().UnixNano())
 }
 
 func TestGet(t *testing.T) {
-	const chatID = "TestGet"
+	chatID := uniqueID("TestGet")
 	db, err := open()
 	if err != nil {
 		t.Fatalf("failed to open database: %s", err)
@@ -36,9 +51,6 @@ func TestGet(t *testing.T) {
 	chat := Chat{
 		ID:      chatID,
 		Active:  true,
-		Exclude: "[\"user1\",\"user2\"]",
-		Skip:    "[\"user3\",\"user4\"]",
-		Days:    "{\"2\":[\"user1\"]",
 		URL:     "https://github.com/",
 		URLText: "GitHub",
 		Created: now,
@@ -47,6 +59,15 @@ func TestGet(t *testing.T) {
 	if err = chat.Upsert(ctx, db); err != nil {
 		t.Fatalf("failed to upsert chat: %s", err)
 	}
+	if err = chat.SaveExclude(ctx, db, map[string]struct{}{"user1": {}, "user2": {}}); err != nil {
+		t.Fatalf("failed to save exclude: %s", err)
+	}
+	if err = chat.SaveSkip(ctx, db, "user3", now.Add(time.Hour)); err != nil {
+		t.Fatalf("failed to save skip: %s", err)
+	}
+	if err = chat.SaveWeekDays(ctx, db, "user1", map[time.Weekday]struct{}{time.Tuesday: {}}); err != nil {
+		t.Fatalf("failed to save week days: %s", err)
+	}
 	gottenChat, err := Get(ctx, db, chatID)
 	if err != nil {
 		t.Fatalf("failed to get chat: %s", err)
@@ -84,33 +105,42 @@ func TestCleanSkip(t *testing.T) {
 		t.Fatalf("failed to upsert chat: %s", err)
 	}
 
-	chat.AddSkip("test1")
-	chat.AddSkip("test2")
-
-	if err = chat.Update(ctx, db); err != nil {
-		t.Fatalf("failed to update chat: %s", err)
+	now := time.Now().UTC()
+	if err = chat.SaveSkip(ctx, db, "test1", now.Add(-time.Second)); err != nil {
+		t.Fatalf("failed to save skip: %s", err)
 	}
-
-	expected := "[\"test1\",\"test2\"]"
-	if chat.Skip != expected {
-		t.Errorf("failed compare skip string, current '%v' expected '%v'", chat.Skip, expected)
+	if err = chat.SaveSkip(ctx, db, "test2", now.Add(time.Hour)); err != nil {
+		t.Fatalf("failed to save skip: %s", err)
 	}
 
-	if err = CleanSkip(ctx, db); err != nil {
-		t.Fatalf("failed to clean skip: %s", err)
+	expected := map[string]struct{}{"test1": {}, "test2": {}}
+	if !maps.Equal(chat.SkipUsers, expected) {
+		t.Errorf("failed compare skip users, current '%v' expected '%v'", chat.SkipUsers, expected)
 	}
 
+	// expired skip state is ignored
 	chat, err = Get(ctx, db, chatID)
 	if err != nil {
 		t.Fatalf("failed to get chat: %s", err)
 	}
 
-	if chat.Skip != "" {
-		t.Errorf("failed compare skip string, current '%v' expected ''", chat.Skip)
+	expected = map[string]struct{}{"test2": {}}
+	if !maps.Equal(chat.SkipUsers, expected) {
+		t.Errorf("failed compare skip users, current '%v' expected '%v'", chat.SkipUsers, expected)
+	}
+
+	if err = CleanSkip(ctx, db); err != nil {
+		t.Fatalf("failed to clean skip: %s", err)
+	}
+
+	var count int
+	err = db.QueryRowContext(ctx, "SELECT COUNT(*) FROM `chat_user_state` WHERE `chat_id`=?;", chatID).Scan(&count)
+	if err != nil {
+		t.Fatalf("failed to count states: %s", err)
 	}
 
-	if chat.SkipUsers != nil {
-		t.Errorf("failed compare skip users, current '%v' expected nil", chat.SkipUsers)
+	if count != 1 {
+		t.Errorf("failed compare states count, current %d expected 1", count)
 	}
 }
 
@@ -131,19 +161,27 @@ func TestGetOrCreate(t *testing.T) {
 	ctx := context.Background()
 	now := time.Now().UTC()
 	chat := Chat{
-		ID:           chatID,
-		Active:       true,
-		ExcludeUsers: map[string]struct{}{"user1": {}, "user2": {}},
-		SkipUsers:    map[string]struct{}{"user3": {}, "user4": {}},
-		WeekDays:     map[time.Weekday]map[string]struct{}{time.Tuesday: {"user1": {}}},
-		URL:          "https://github.com/",
-		URLText:      "GitHub",
-		Created:      now,
-		Updated:      now,
+		ID:      chatID,
+		Active:  true,
+		URL:     "https://github.com/",
+		URLText: "GitHub",
+		Created: now,
+		Updated: now,
 	}
 	if err = chat.Upsert(ctx, db); err != nil {
 		t.Fatalf("failed to upsert chat: %s", err)
 	}
+	if err = chat.SaveExclude(ctx, db, map[string]struct{}{"user1": {}, "user2": {}}); err != nil {
+		t.Fatalf("failed to save exclude: %s", err)
+	}
+	for _, userID := range []string{"user3", "user4"} {
+		if err = chat.SaveSkip(ctx, db, userID, now.Add(time.Hour)); err != nil {
+			t.Fatalf("failed to save skip: %s", err)
+		}
+	}
+	if err = chat.SaveWeekDays(ctx, db, "user1", map[time.Weekday]struct{}{time.Tuesday: {}}); err != nil {
+		t.Fatalf("failed to save week days: %s", err)
+	}
 	chatNew, err := GetOrCreate(ctx, db, chatIDNotExists)
 	if err != nil {
 		t.Fatalf("failed to get or create chat: %s", err)
@@ -164,19 +202,8 @@ func TestGetOrCreate(t *testing.T) {
 		t.Errorf("got chat %+v, want %+v", chatNew, chat)
 	}
 
-	expected := "[\"user1\",\"user2\"]"
-	if chatNew.Exclude != expected {
-		t.Errorf("failed compare exclude string, current '%v' expected '%v'", chatNew.Exclude, expected)
-	}
-
-	expected = "[\"user3\",\"user4\"]"
-	if chatNew.Skip != expected {
-		t.Errorf("failed compare skip string, current '%v' expected '%v'", chatNew.Skip, expected)
-	}
-
-	expected = "{\"2\":[\"user1\"]}"
-	if chatNew.Days != expected {
-		t.Errorf("failed compare days string, current %q expected %q", chatNew.Days, expected)
+	if !maps.EqualFunc(chatNew.WeekDays, chat.WeekDays, maps.Equal) {
+		t.Errorf("failed compare days, current %v expected %v", chatNew.WeekDays, chat.WeekDays)
 	}
 
 	if !maps.Equal(chatNew.ExcludeUsers, chat.ExcludeUsers) {
@@ -200,7 +227,7 @@ func TestChat_Upsert(t *testing.T) {
 		}
 	}()
 	ctx := context.Background()
-	chat := &Chat{ID: chatID, Active: true}
+	chat := &Chat{ID: chatID, Active: true, GPT: true}
 	if err = chat.Upsert(ctx, db); err != nil {
 		t.Fatalf("failed to upsert active chat: %s", err)
 	}
@@ -208,7 +235,7 @@ func TestChat_Upsert(t *testing.T) {
 	if err != nil {
 		t.Fatalf("failed to get chat: %s", err)
 	}
-	if (chat.ID != chatID) || !chat.Active {
+	if (chat.ID != chatID) || !chat.Active || !chat.GPT {
 		t.Errorf("got chat %+v, want %+v", chat, Chat{ID: chatID, Active: true})
 	}
 	// reset active
@@ -226,7 +253,7 @@ func TestChat_Upsert(t *testing.T) {
 }
 
 func TestChat_Update(t *testing.T) {
-	const chatID = "TestChat_Update"
+	chatID := uniqueID("TestChat_Update")
 	db, err := open()
 	if err != nil {
 		t.Fatalf("failed to open database: %s", err)
@@ -239,15 +266,12 @@ func TestChat_Update(t *testing.T) {
 	ctx := context.Background()
 	now := time.Now().UTC()
 	chat := Chat{
-		ID:           chatID,
-		Active:       true,
-		ExcludeUsers: map[string]struct{}{"user1": {}, "user2": {}},
-		SkipUsers:    map[string]struct{}{"user3": {}},
-		WeekDays:     map[time.Weekday]map[string]struct{}{time.Tuesday: {"user1": {}}},
-		URL:          "https://github.com/",
-		URLText:      "GitHub",
-		Created:      now,
-		Updated:      now,
+		ID:      chatID,
+		Active:  true,
+		URL:     "https://github.com/",
+		URLText: "GitHub",
+		Created: now,
+		Updated: now,
 	}
 	if err = chat.Upsert(ctx, db); err != nil {
 		t.Fatalf("failed to upsert chat: %s", err)
@@ -262,12 +286,14 @@ func TestChat_Update(t *testing.T) {
 
 	// change and update
 	chat.Active = false
+	chat.GPT = true
 	chat.Created = time.Now().UTC()
-	chat.AddExclude(map[string]struct{}{"user5": {}})
-	chat.AddSkip("user4")
 	chat.URL = "https://gitlab.com/"
 	chat.URLText = "GitLab"
-	chat.WeekDays[time.Wednesday] = map[string]struct{}{"user2": {}}
+	chat.Timezone = "Asia/Novosibirsk"
+	chat.Prompt = "answer briefly"
+	temperature := float32(0.3)
+	chat.SetAIOptions("ds", AIOptions{Model: "deepseek-reasoner", Temperature: &temperature})
 
 	if err = chat.Update(ctx, db); err != nil {
 		t.Fatalf("failed to update chat: %s", err)
@@ -283,52 +309,6 @@ func TestChat_Update(t *testing.T) {
 	}
 }
 
-func TestChat_ExcludeToMap(t *testing.T) {
-	now := time.Now().UTC()
-	chat := Chat{
-		ID:      "TestChat_ExcludeToMap",
-		Active:  true,
-		Exclude: "[\"user1\",\"user2\"]",
-		URL:     "https://github.com/",
-		URLText: "GitHub",
-		Created: now,
-		Updated: now,
-	}
-	if err := chat.ExcludeToMap(); err != nil {
-		t.Fatalf("failed to load exlclude: %v", err)
-	}
-	expected := map[string]struct{}{"user1": {}, "user2": {}}
-	if !maps.Equal(chat.ExcludeUsers, expected) {
-		t.Fatalf("failed compare maps, current:\n%+v\n want\n%+v", chat.ExcludeUsers, expected)
-	}
-}
-
-func TestChat_ExcludeToString(t *testing.T) {
-	now := time.Now().UTC()
-	chat := Chat{
-		ID:           "TestChat_ExcludeToMap",
-		Active:       true,
-		Exclude:      "[\"user1\",\"user2\"]",
-		URL:          "https://github.com/",
-		URLText:      "GitHub",
-		Created:      now,
-		Updated:      now,
-		ExcludeUsers: map[string]struct{}{"user1": {}, "user2": {}},
-	}
-	chat.AddExclude(map[string]struct{}{"user0": {}})
-	expected := map[string]struct{}{"user0": {}, "user1": {}, "user2": {}}
-	if !maps.Equal(chat.ExcludeUsers, expected) {
-		t.Fatalf("failed compare maps, current:\n%+v\n want\n%+v", chat.ExcludeUsers, expected)
-	}
-	if err := chat.ExcludeToString(); err != nil {
-		t.Errorf("failed convert exclude to string: %v", err)
-	}
-	expectedStr := "[\"user0\",\"user1\",\"user2\"]"
-	if chat.Exclude != expectedStr {
-		t.Errorf("failed compare exclude string, current '%v' expected '%v'", chat.Exclude, expectedStr)
-	}
-}
-
 func TestChat_AddExclude(t *testing.T) {
 	now := time.Now().UTC()
 	chat := Chat{
@@ -345,13 +325,6 @@ func TestChat_AddExclude(t *testing.T) {
 	if !maps.Equal(chat.ExcludeUsers, expected) {
 		t.Fatalf("failed compare maps, current:\n%+v\n want\n%+v", chat.ExcludeUsers, expected)
 	}
-	if err := chat.ExcludeToString(); err != nil {
-		t.Errorf("failed convert exclude to string: %v", err)
-	}
-	expectedStr := "[\"user0\",\"user1\",\"user2\"]"
-	if chat.Exclude != expectedStr {
-		t.Errorf("failed compare exclude string, current '%v' expected '%v'", chat.Exclude, expectedStr)
-	}
 }
 
 func TestChat_DelExclude(t *testing.T) {
@@ -365,13 +338,9 @@ func TestChat_DelExclude(t *testing.T) {
 		Updated: now,
 	}
 	chat.DelExclude(map[string]struct{}{"user2": {}})
-	if chat.Exclude != "" {
-		t.Errorf("failed compare exclude string, current '%v' expected ''", chat.Exclude)
-	}
 	if chat.ExcludeUsers != nil {
 		t.Errorf("failed compare exclude users, current '%v' expected nil", chat.ExcludeUsers)
 	}
-	chat.Exclude = "[\"user0\",\"user1\",\"user2\"]"
 	chat.ExcludeUsers = map[string]struct{}{"user0": {}, "user1": {}, "user2": {}}
 	// delete some value
 	chat.DelExclude(map[string]struct{}{"user2": {}})
@@ -379,11 +348,22 @@ func TestChat_DelExclude(t *testing.T) {
 	if !maps.Equal(chat.ExcludeUsers, expected) {
 		t.Fatalf("failed compare maps, current:\n%+v\n want\n%+v", chat.ExcludeUsers, expected)
 	}
-	if err := chat.ExcludeToString(); err != nil {
-		t.Errorf("failed convert exclude to string: %v", err)
+}
+
+func TestChat_Location(t *testing.T) {
+	testCases := []struct {
+		timezone string
+		expected string
+	}{
+		{timezone: "", expected: "UTC"},
+		{timezone: "Asia/Yekaterinburg", expected: "Asia/Yekaterinburg"},
+		{timezone: "Unknown/Timezone", expected: "UTC"},
 	}
-	expectedStr := "[\"user0\",\"user1\"]"
-	if chat.Exclude != expectedStr {
-		t.Errorf("failed compare exclude string, current '%v' expected '%v'", chat.Exclude, expectedStr)
+
+	for _, tc := range testCases {
+		chat := &Chat{Timezone: tc.timezone}
+		if loc := chat.Location(time.UTC); loc.String() != tc.expected {
+			t.Errorf("failed location %q for timezone %q, expected %q", loc, tc.timezone, tc.expected)
+		}
 	}
 }
@@ -0,0 +1,64 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// ProcessedEvent is a handled message with a bot command.
+type ProcessedEvent struct {
+	ID      int64     `db:"id"`
+	ChatID  string    `db:"chat_id"`
+	MsgID   string    `db:"msg_id"`
+	Text    string    `db:"text"`
+	Command string    `db:"command"`
+	Outcome string    `db:"outcome"`
+	Created time.Time `db:"created"`
+}
+
+// GetProcessedEvent returns a processed message of the chat, error wraps sql.ErrNoRows if there is no one.
+func GetProcessedEvent(ctx context.Context, db *sql.DB, chatID, msgID string) (*ProcessedEvent, error) {
+	const query = "SELECT `id`, `chat_id`, `msg_id`, `text`, `command`, `outcome`, `created` FROM `processed_event` " +
+		"WHERE `chat_id`=? AND `msg_id`=? LIMIT 1;"
+
+	e := &ProcessedEvent{}
+	err := db.QueryRowContext(ctx, query, chatID, msgID).Scan(
+		&e.ID, &e.ChatID, &e.MsgID, &e.Text, &e.Command, &e.Outcome, &e.Created,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("processed event scan: %w", err)
+	}
+
+	return e, nil
+}
+
+// SaveProcessedEvent saves or replaces the processed message and removes old ones,
+// so only "keep" latest messages are stored.
+func SaveProcessedEvent(ctx context.Context, db *sql.DB, e *ProcessedEvent, keep int) error {
+	const (
+		insertQuery = "INSERT OR REPLACE INTO `processed_event` " +
+			"(`chat_id`, `msg_id`, `text`, `command`, `outcome`, `created`) VALUES (?,?,?,?,?,?);"
+		deleteQuery = "DELETE FROM `processed_event` WHERE `id`<=(SELECT MAX(`id`) FROM `processed_event`)-?;"
+	)
+
+	return InTransaction(ctx, db, func(tx *sql.Tx) error {
+		e.Created = time.Now().UTC()
+
+		result, err := tx.ExecContext(ctx, insertQuery, e.ChatID, e.MsgID, e.Text, e.Command, e.Outcome, e.Created)
+		if err != nil {
+			return fmt.Errorf("processed event insert: %w", err)
+		}
+
+		if e.ID, err = result.LastInsertId(); err != nil {
+			return fmt.Errorf("processed event id: %w", err)
+		}
+
+		if _, err = tx.ExecContext(ctx, deleteQuery, keep); err != nil {
+			return fmt.Errorf("processed event delete: %w", err)
+		}
+
+		return nil
+	})
+}
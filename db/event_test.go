@@ -0,0 +1,63 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestProcessedEvent(t *testing.T) {
+	const chatID = "TestProcessedEvent"
+
+	db, err := open()
+	if err != nil {
+		t.Fatalf("failed to open database: %s", err)
+	}
+	defer func() {
+		if e := db.Close(); e != nil {
+			t.Errorf("failed to close database: %s", e)
+		}
+	}()
+
+	ctx := context.Background()
+
+	if _, err = GetProcessedEvent(ctx, db, chatID, "unknown"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected ErrNoRows, got %v", err)
+	}
+
+	e := &ProcessedEvent{ChatID: chatID, MsgID: "1", Text: "/skip", Command: "/skip", Outcome: "on"}
+	if err = SaveProcessedEvent(ctx, db, e, 100); err != nil {
+		t.Fatalf("failed to save event: %v", err)
+	}
+
+	// edited message replaces the previous record
+	e = &ProcessedEvent{ChatID: chatID, MsgID: "1", Text: "/vacation", Command: "/vacation", Outcome: "off"}
+	if err = SaveProcessedEvent(ctx, db, e, 100); err != nil {
+		t.Fatalf("failed to save event: %v", err)
+	}
+
+	saved, err := GetProcessedEvent(ctx, db, chatID, "1")
+	if err != nil {
+		t.Fatalf("failed to get event: %v", err)
+	}
+
+	if saved.ID != e.ID || saved.Text != e.Text || saved.Command != e.Command || saved.Outcome != e.Outcome {
+		t.Errorf("failed event %+v", saved)
+	}
+
+	// only 2 latest events are kept
+	for i := 2; i < 5; i++ {
+		e = &ProcessedEvent{ChatID: chatID, MsgID: fmt.Sprint(i), Text: "/go"}
+		if err = SaveProcessedEvent(ctx, db, e, 2); err != nil {
+			t.Fatalf("failed to save event: %v", err)
+		}
+	}
+
+	for msgID, exists := range map[string]bool{"1": false, "2": false, "3": true, "4": true} {
+		if _, err = GetProcessedEvent(ctx, db, chatID, msgID); (err == nil) != exists {
+			t.Errorf("message %s: unexpected error %v", msgID, err)
+		}
+	}
+}
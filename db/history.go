@@ -0,0 +1,154 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// GoHistory is a saved result of "/go" command.
+type GoHistory struct {
+	ID      int64     `db:"id"`
+	ChatID  string    `db:"chat_id"`
+	Author  string    `db:"author"` // empty for scheduled posts
+	Users   []string  `db:"users"`
+	Created time.Time `db:"created"`
+}
+
+// UserStats is a statistics of user's positions in "/go" results.
+type UserStats struct {
+	UserID string
+	First  int // number of first positions
+	Last   int // number of last positions
+	Total  int // number of all results with the user
+}
+
+// SaveOrder saves ordered users of the chat to the history.
+func SaveOrder(ctx context.Context, db *sql.DB, chatID, author string, users []string) error {
+	const query = "INSERT INTO `go_history` (`chat_id`, `author`, `users`, `created`) VALUES (?,?,?,?);"
+
+	data, err := json.Marshal(users)
+	if err != nil {
+		return fmt.Errorf("history marshal: %w", err)
+	}
+
+	if _, err = db.ExecContext(ctx, query, chatID, author, string(data), time.Now().UTC()); err != nil {
+		return fmt.Errorf("history exec: %w", err)
+	}
+
+	return nil
+}
+
+// History returns n latest results of the chat, from the latest one.
+func History(ctx context.Context, db *sql.DB, chatID string, n int) ([]GoHistory, error) {
+	const query = "SELECT `id`, `chat_id`, `author`, `users`, `created` FROM `go_history` " +
+		"WHERE `chat_id`=? ORDER BY `id` DESC LIMIT ?;"
+
+	return queryHistory(ctx, db, query, chatID, n)
+}
+
+// HistorySince returns all results of the chat since the time, from the latest one.
+func HistorySince(ctx context.Context, db *sql.DB, chatID string, since time.Time) ([]GoHistory, error) {
+	const query = "SELECT `id`, `chat_id`, `author`, `users`, `created` FROM `go_history` " +
+		"WHERE `chat_id`=? AND `created`>=? ORDER BY `id` DESC;"
+
+	return queryHistory(ctx, db, query, chatID, since.UTC())
+}
+
+// RecentOrders returns n latest orders of the chat, from the latest one.
+func RecentOrders(ctx context.Context, db *sql.DB, chatID string, n int) ([][]string, error) {
+	items, err := History(ctx, db, chatID, n)
+	if err != nil {
+		return nil, err
+	}
+
+	orders := make([][]string, 0, len(items))
+	for _, item := range items {
+		orders = append(orders, item.Users)
+	}
+
+	return orders, nil
+}
+
+// Stats returns users' statistics of history items ordered by first positions, last positions and user IDs.
+func Stats(items []GoHistory) []UserStats {
+	stats := make(map[string]*UserStats)
+	get := func(userID string) *UserStats {
+		s, ok := stats[userID]
+		if !ok {
+			s = &UserStats{UserID: userID}
+			stats[userID] = s
+		}
+		return s
+	}
+
+	for _, item := range items {
+		n := len(item.Users)
+		if n == 0 {
+			continue
+		}
+
+		for _, userID := range item.Users {
+			get(userID).Total++
+		}
+
+		get(item.Users[0]).First++
+		get(item.Users[n-1]).Last++
+	}
+
+	result := make([]UserStats, 0, len(stats))
+	for _, s := range stats {
+		result = append(result, *s)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+		if a.First != b.First {
+			return a.First > b.First
+		}
+		if a.Last != b.Last {
+			return a.Last < b.Last
+		}
+		return a.UserID < b.UserID
+	})
+
+	return result
+}
+
+// queryHistory returns history items by the query.
+func queryHistory(ctx context.Context, db *sql.DB, query string, args ...any) ([]GoHistory, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("history query: %w", err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var items []GoHistory
+	for rows.Next() {
+		var (
+			item GoHistory
+			data string
+		)
+
+		if err = rows.Scan(&item.ID, &item.ChatID, &item.Author, &data, &item.Created); err != nil {
+			return nil, fmt.Errorf("history scan: %w", err)
+		}
+
+		if err = json.Unmarshal([]byte(data), &item.Users); err != nil {
+			return nil, fmt.Errorf("history unmarshal: %w", err)
+		}
+
+		items = append(items, item)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("history rows: %w", err)
+	}
+
+	return items, nil
+}
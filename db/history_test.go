@@ -0,0 +1,97 @@
+package db
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestRecentOrders(t *testing.T) {
+	const chatID = "TestRecentOrders"
+
+	db, err := open()
+	if err != nil {
+		t.Fatalf("failed to open database: %s", err)
+	}
+	defer func() {
+		if e := db.Close(); e != nil {
+			t.Errorf("failed to close database: %s", e)
+		}
+	}()
+
+	ctx := context.Background()
+	orders := [][]string{{"user1", "user2"}, {"user2", "user1"}, {"user3"}}
+
+	for _, users := range orders {
+		if err = SaveOrder(ctx, db, chatID, "author", users); err != nil {
+			t.Fatalf("failed to save order: %s", err)
+		}
+	}
+
+	result, err := RecentOrders(ctx, db, chatID, 2)
+	if err != nil {
+		t.Fatalf("failed to get orders: %s", err)
+	}
+
+	expected := [][]string{{"user3"}, {"user2", "user1"}}
+	if !slices.EqualFunc(result, expected, slices.Equal) {
+		t.Errorf("failed orders %v, expected %v", result, expected)
+	}
+}
+
+func TestHistorySince(t *testing.T) {
+	chatID := uniqueID("TestHistorySince")
+
+	db, err := open()
+	if err != nil {
+		t.Fatalf("failed to open database: %s", err)
+	}
+	defer func() {
+		if e := db.Close(); e != nil {
+			t.Errorf("failed to close database: %s", e)
+		}
+	}()
+
+	ctx := context.Background()
+	start := time.Now()
+
+	if err = SaveOrder(ctx, db, chatID, "", []string{"user1", "user2", "user3"}); err != nil {
+		t.Fatalf("failed to save order: %s", err)
+	}
+
+	if err = SaveOrder(ctx, db, chatID, "user2", []string{"user2", "user1"}); err != nil {
+		t.Fatalf("failed to save order: %s", err)
+	}
+
+	items, err := History(ctx, db, chatID, 10)
+	if err != nil {
+		t.Fatalf("failed to get history: %s", err)
+	}
+
+	if n := len(items); n != 2 {
+		t.Fatalf("failed history length %d", n)
+	}
+
+	if item := items[0]; item.Author != "user2" || item.ChatID != chatID || item.Created.Before(start.Truncate(time.Second)) {
+		t.Errorf("failed history item %+v", item)
+	}
+
+	if items, err = HistorySince(ctx, db, chatID, start.Add(time.Hour)); err != nil || len(items) != 0 {
+		t.Errorf("failed history since: %v, %v", items, err)
+	}
+
+	if items, err = HistorySince(ctx, db, chatID, start.Add(-time.Hour)); err != nil || len(items) != 2 {
+		t.Fatalf("failed history since: %v, %v", items, err)
+	}
+
+	expected := []UserStats{
+		{UserID: "user2", First: 1, Total: 2},
+		{UserID: "user1", First: 1, Last: 1, Total: 2},
+		{UserID: "user3", Last: 1, Total: 1},
+	}
+
+	if stats := Stats(items); !slices.Equal(stats, expected) {
+		t.Errorf("failed stats %v, expected %v", stats, expected)
+	}
+}
@@ -0,0 +1,36 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// JobLastRun returns the last successful run time of the scheduler job or zero time if it never run.
+func JobLastRun(ctx context.Context, db *sql.DB, name string) (time.Time, error) {
+	const query = "SELECT `last_run` FROM `job_run` WHERE `name`=? LIMIT 1;"
+	var lastRun time.Time
+
+	err := db.QueryRowContext(ctx, query, name).Scan(&lastRun)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return time.Time{}, nil
+		}
+		return time.Time{}, fmt.Errorf("job run scan: %w", err)
+	}
+
+	return lastRun, nil
+}
+
+// SaveJobRun saves the last successful run time of the scheduler job.
+func SaveJobRun(ctx context.Context, db *sql.DB, name string, ts time.Time) error {
+	const query = "INSERT OR REPLACE INTO `job_run` (`name`, `last_run`) VALUES (?,?);"
+
+	if _, err := db.ExecContext(ctx, query, name, ts.UTC()); err != nil {
+		return fmt.Errorf("job run exec: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,88 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// ChatMember is a known member of the chat.
+type ChatMember struct {
+	ChatID    string    `db:"chat_id"`
+	UserID    string    `db:"user_id"`
+	FirstName string    `db:"first_name"`
+	LastName  string    `db:"last_name"`
+	Username  string    `db:"username"`
+	Bot       bool      `db:"bot"`
+	Updated   time.Time `db:"updated"`
+}
+
+// ChatMembers returns known members of the chat ordered by user IDs.
+func ChatMembers(ctx context.Context, db *sql.DB, chatID string) ([]ChatMember, error) {
+	const query = "SELECT `chat_id`, `user_id`, `first_name`, `last_name`, `username`, `bot`, `updated` " +
+		"FROM `chat_member` WHERE `chat_id`=? ORDER BY `user_id`;"
+
+	rows, err := db.QueryContext(ctx, query, chatID)
+	if err != nil {
+		return nil, fmt.Errorf("chat members query: %w", err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	members := make([]ChatMember, 0)
+	for rows.Next() {
+		m := ChatMember{}
+
+		err = rows.Scan(&m.ChatID, &m.UserID, &m.FirstName, &m.LastName, &m.Username, &m.Bot, &m.Updated)
+		if err != nil {
+			return nil, fmt.Errorf("chat members scan: %w", err)
+		}
+
+		members = append(members, m)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("chat members rows: %w", err)
+	}
+
+	return members, nil
+}
+
+// SaveChatMembers inserts or updates known members of chats.
+func SaveChatMembers(ctx context.Context, db *sql.DB, members ...ChatMember) error {
+	const query = "INSERT OR REPLACE INTO `chat_member` " +
+		"(`chat_id`, `user_id`, `first_name`, `last_name`, `username`, `bot`, `updated`) VALUES (?,?,?,?,?,?,?);"
+
+	if len(members) == 0 {
+		return nil
+	}
+
+	return InTransaction(ctx, db, func(tx *sql.Tx) error {
+		updated := time.Now().UTC()
+
+		for i := range members {
+			m := &members[i]
+			m.Updated = updated
+
+			_, err := tx.ExecContext(ctx, query, m.ChatID, m.UserID, m.FirstName, m.LastName, m.Username, m.Bot, m.Updated)
+			if err != nil {
+				return fmt.Errorf("chat member insert: %w", err)
+			}
+		}
+
+		return nil
+	})
+}
+
+// DeleteChatMember removes the user from known members of the chat.
+func DeleteChatMember(ctx context.Context, db *sql.DB, chatID, userID string) error {
+	const query = "DELETE FROM `chat_member` WHERE `chat_id`=? AND `user_id`=?;"
+
+	if _, err := db.ExecContext(ctx, query, chatID, userID); err != nil {
+		return fmt.Errorf("chat member delete: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,63 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestChatMembers(t *testing.T) {
+	chatID := fmt.Sprintf("TestChatMembers%d", time.Now().UnixNano())
+
+	db, err := open()
+	if err != nil {
+		t.Fatalf("failed to open database: %s", err)
+	}
+	defer func() {
+		if e := db.Close(); e != nil {
+			t.Errorf("failed to close database: %s", e)
+		}
+	}()
+
+	ctx := context.Background()
+
+	members, err := ChatMembers(ctx, db, chatID)
+	if err != nil || len(members) != 0 {
+		t.Fatalf("failed members of unknown chat %v: %v", members, err)
+	}
+
+	err = SaveChatMembers(ctx, db,
+		ChatMember{ChatID: chatID, UserID: "2", FirstName: "Bob"},
+		ChatMember{ChatID: chatID, UserID: "1", FirstName: "Alice", Username: "alice_user"},
+		ChatMember{ChatID: chatID, UserID: "3", FirstName: "Bot", Bot: true},
+	)
+	if err != nil {
+		t.Fatalf("failed to save members: %v", err)
+	}
+
+	// updated name
+	if err = SaveChatMembers(ctx, db, ChatMember{ChatID: chatID, UserID: "2", FirstName: "Bob", LastName: "B"}); err != nil {
+		t.Fatalf("failed to save member: %v", err)
+	}
+
+	if err = DeleteChatMember(ctx, db, chatID, "3"); err != nil {
+		t.Fatalf("failed to delete member: %v", err)
+	}
+
+	if members, err = ChatMembers(ctx, db, chatID); err != nil {
+		t.Fatalf("failed to get members: %v", err)
+	}
+
+	if n := len(members); n != 2 {
+		t.Fatalf("failed number of members %d", n)
+	}
+
+	if m := members[0]; m.UserID != "1" || m.Username != "alice_user" || m.Bot || m.Updated.IsZero() {
+		t.Errorf("failed member %+v", m)
+	}
+
+	if m := members[1]; m.UserID != "2" || m.LastName != "B" {
+		t.Errorf("failed member %+v", m)
+	}
+}
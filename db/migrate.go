@@ -0,0 +1,258 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// migrationsDir is a directory of embedded migration files.
+// Every file name has format "<version>_<name>.sql", for example "0001_chat.sql".
+const migrationsDir = "migrations"
+
+//go:embed migrations/*.sql
+var migrationsFS embed.FS
+
+// Migration is a database schema migration.
+// Upgrade is an optional function which is called after the query in the same transaction,
+// it handles changes which can't be expressed by plain SQL.
+type Migration struct {
+	Version int
+	Name    string
+	Query   string
+	Upgrade func(ctx context.Context, conn *sql.Conn) error
+}
+
+// upgrades are Go parts of embedded migrations by versions.
+var upgrades = map[int]func(ctx context.Context, conn *sql.Conn) error{
+	1: upgradeChat,
+}
+
+// Migrations returns all embedded migrations ordered by version.
+func Migrations() ([]Migration, error) {
+	migrations, err := loadMigrations(migrationsFS, migrationsDir)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range migrations {
+		migrations[i].Upgrade = upgrades[migrations[i].Version]
+	}
+
+	return migrations, nil
+}
+
+// legacyChatColumns are columns of the chat table which were added by manual ALTER queries
+// before versioned migrations, their order is the same as in the initial schema.
+var legacyChatColumns = []struct {
+	name       string
+	definition string
+}{
+	{name: "gpt", definition: "SMALLINT NOT NULL DEFAULT 0"},
+	{name: "exclude", definition: "TEXT"},
+	{name: "skip", definition: "TEXT"},
+	{name: "url", definition: "TEXT"},
+	{name: "days", definition: "TEXT"},
+	{name: "url_text", definition: "VARCHAR(255) NOT NULL DEFAULT 'call'"},
+}
+
+// upgradeChat adds missing legacy columns to the chat table of an old database,
+// so the next migrations can read and drop them.
+func upgradeChat(ctx context.Context, conn *sql.Conn) error {
+	rows, err := conn.QueryContext(ctx, "SELECT `name` FROM pragma_table_info('chat');")
+	if err != nil {
+		return fmt.Errorf("chat columns: %w", err)
+	}
+
+	columns := make(map[string]struct{})
+	for rows.Next() {
+		var name string
+		if err = rows.Scan(&name); err != nil {
+			return errors.Join(fmt.Errorf("chat column scan: %w", err), rows.Close())
+		}
+		columns[name] = struct{}{}
+	}
+
+	if err = errors.Join(rows.Err(), rows.Close()); err != nil {
+		return fmt.Errorf("chat columns read: %w", err)
+	}
+
+	for _, column := range legacyChatColumns {
+		if _, ok := columns[column.name]; ok {
+			continue
+		}
+
+		query := fmt.Sprintf("ALTER TABLE `chat` ADD COLUMN `%s` %s;", column.name, column.definition)
+		if _, err = conn.ExecContext(ctx, query); err != nil {
+			return fmt.Errorf("add chat column %q: %w", column.name, err)
+		}
+	}
+
+	return nil
+}
+
+// loadMigrations reads migrations from a directory of file system fsys.
+func loadMigrations(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, fmt.Errorf("read migrations: %w", err)
+	}
+
+	migrations := make([]Migration, 0, len(entries))
+	for _, entry := range entries {
+		fileName := entry.Name()
+		if entry.IsDir() || path.Ext(fileName) != ".sql" {
+			continue
+		}
+
+		prefix, name, ok := strings.Cut(strings.TrimSuffix(fileName, ".sql"), "_")
+		if !ok {
+			return nil, fmt.Errorf("migration %q has no version prefix", fileName)
+		}
+
+		version, err := strconv.Atoi(prefix)
+		if err != nil || version < 1 {
+			return nil, fmt.Errorf("migration %q has invalid version %q", fileName, prefix)
+		}
+
+		data, err := fs.ReadFile(fsys, path.Join(dir, fileName))
+		if err != nil {
+			return nil, fmt.Errorf("read migration %q: %w", fileName, err)
+		}
+
+		migrations = append(migrations, Migration{Version: version, Name: name, Query: string(data)})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	for i := 1; i < len(migrations); i++ {
+		if migrations[i].Version == migrations[i-1].Version {
+			return nil, fmt.Errorf("duplicate migration version %d", migrations[i].Version)
+		}
+	}
+
+	return migrations, nil
+}
+
+// Version returns current applied schema version, it is 0 for an empty database.
+func Version(ctx context.Context, db *sql.DB) (int, error) {
+	return schemaVersion(ctx, db)
+}
+
+// querier is a common interface for database connections and transactions.
+type querier interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// schemaVersion returns current schema version or 0 if there is no versions table yet.
+func schemaVersion(ctx context.Context, q querier) (int, error) {
+	const query = "SELECT COUNT(*) FROM `sqlite_master` WHERE `type`='table' AND `name`='schema_version';"
+	var count int
+
+	if err := q.QueryRowContext(ctx, query).Scan(&count); err != nil {
+		return 0, fmt.Errorf("schema version table: %w", err)
+	}
+
+	if count == 0 {
+		return 0, nil
+	}
+
+	var version sql.NullInt64
+	if err := q.QueryRowContext(ctx, "SELECT MAX(`version`) FROM `schema_version`;").Scan(&version); err != nil {
+		return 0, fmt.Errorf("schema version: %w", err)
+	}
+
+	return int(version.Int64), nil
+}
+
+// Migrate applies all pending embedded migrations and returns the number of applied ones.
+func Migrate(ctx context.Context, db *sql.DB) (int, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return 0, err
+	}
+
+	return applyMigrations(ctx, db, migrations)
+}
+
+// applyMigrations applies pending migrations inside one transaction.
+// It uses "BEGIN IMMEDIATE" to take the write lock before reading the current version,
+// so several concurrently started processes don't apply the same migration twice.
+func applyMigrations(ctx context.Context, db *sql.DB, migrations []Migration) (int, error) {
+	const (
+		createQuery = "CREATE TABLE IF NOT EXISTS `schema_version` " +
+			"(`version` INTEGER PRIMARY KEY NOT NULL, `name` VARCHAR(255) NOT NULL, `applied` DATETIME NOT NULL);"
+		insertQuery = "INSERT INTO `schema_version` (`version`, `name`, `applied`) VALUES (?, ?, ?);"
+	)
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("migration connection: %w", err)
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	if _, err = conn.ExecContext(ctx, "BEGIN IMMEDIATE;"); err != nil {
+		return 0, fmt.Errorf("migration transaction begin: %w", err)
+	}
+
+	applied, err := func() (int, error) {
+		current, e := schemaVersion(ctx, conn)
+		if e != nil {
+			return 0, e
+		}
+
+		if _, e = conn.ExecContext(ctx, createQuery); e != nil {
+			return 0, fmt.Errorf("create schema version table: %w", e)
+		}
+
+		n := 0
+		for _, m := range migrations {
+			if m.Version <= current {
+				continue
+			}
+
+			if _, e = conn.ExecContext(ctx, m.Query); e != nil {
+				return 0, fmt.Errorf("migration %d %q: %w", m.Version, m.Name, e)
+			}
+
+			if m.Upgrade != nil {
+				if e = m.Upgrade(ctx, conn); e != nil {
+					return 0, fmt.Errorf("migration %d %q upgrade: %w", m.Version, m.Name, e)
+				}
+			}
+
+			if _, e = conn.ExecContext(ctx, insertQuery, m.Version, m.Name, time.Now().UTC()); e != nil {
+				return 0, fmt.Errorf("migration %d version save: %w", m.Version, e)
+			}
+			n++
+		}
+
+		return n, nil
+	}()
+
+	if err != nil {
+		// the transaction context can be already canceled, but rollback is required anyway
+		if _, e := conn.ExecContext(context.Background(), "ROLLBACK;"); e != nil {
+			err = errors.Join(err, fmt.Errorf("failed rollback: %w", e))
+		}
+		return 0, err
+	}
+
+	if _, err = conn.ExecContext(ctx, "COMMIT;"); err != nil {
+		return 0, fmt.Errorf("migration transaction commit: %w", err)
+	}
+
+	return applied, nil
+}
@@ -0,0 +1,196 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestMigrations(t *testing.T) {
+	migrations, err := Migrations()
+	if err != nil {
+		t.Fatalf("failed to load migrations: %v", err)
+	}
+
+	if len(migrations) == 0 {
+		t.Fatal("no migrations")
+	}
+
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			t.Errorf("failed migration %q version=%d, expected %d", m.Name, m.Version, i+1)
+		}
+		if strings.TrimSpace(m.Query) == "" {
+			t.Errorf("empty migration %q", m.Name)
+		}
+	}
+}
+
+func TestLoadMigrations(t *testing.T) {
+	testCases := []struct {
+		name     string
+		files    fstest.MapFS
+		expected []int
+		wantErr  bool
+	}{
+		{
+			name: "ordered",
+			files: fstest.MapFS{
+				"m/0002_second.sql": {Data: []byte("SELECT 2;")},
+				"m/0010_third.sql":  {Data: []byte("SELECT 10;")},
+				"m/0001_first.sql":  {Data: []byte("SELECT 1;")},
+				"m/README.md":       {Data: []byte("ignored")},
+			},
+			expected: []int{1, 2, 10},
+		},
+		{
+			name:    "no_version",
+			files:   fstest.MapFS{"m/first.sql": {Data: []byte("SELECT 1;")}},
+			wantErr: true,
+		},
+		{
+			name:    "bad_version",
+			files:   fstest.MapFS{"m/v1_first.sql": {Data: []byte("SELECT 1;")}},
+			wantErr: true,
+		},
+		{
+			name: "duplicate",
+			files: fstest.MapFS{
+				"m/0001_first.sql":  {Data: []byte("SELECT 1;")},
+				"m/001_another.sql": {Data: []byte("SELECT 1;")},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			migrations, err := loadMigrations(tc.files, "m")
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("failed error=%v, wantErr=%v", err, tc.wantErr)
+			}
+
+			if len(migrations) != len(tc.expected) {
+				t.Fatalf("failed migrations=%v, expected versions %v", migrations, tc.expected)
+			}
+
+			for i, m := range migrations {
+				if m.Version != tc.expected[i] {
+					t.Errorf("failed version=%d, expected %d", m.Version, tc.expected[i])
+				}
+			}
+		})
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "migrate.sqlite"))
+	if err != nil {
+		t.Fatalf("failed to open database: %s", err)
+	}
+	defer func() {
+		if e := db.Close(); e != nil {
+			t.Errorf("failed to close database: %s", e)
+		}
+	}()
+
+	ctx := context.Background()
+	migrations := []Migration{
+		{Version: 1, Name: "first", Query: "CREATE TABLE `t1` (`id` INTEGER PRIMARY KEY);"},
+		{Version: 2, Name: "second", Query: "CREATE TABLE `t2` (`id` INTEGER PRIMARY KEY); INSERT INTO `t2` VALUES (1);"},
+	}
+
+	version, err := Version(ctx, db)
+	if err != nil {
+		t.Fatalf("failed to get version: %v", err)
+	}
+	if version != 0 {
+		t.Errorf("failed version=%d for empty database", version)
+	}
+
+	n, err := applyMigrations(ctx, db, migrations[:1])
+	if err != nil {
+		t.Fatalf("failed to apply migrations: %v", err)
+	}
+	if n != 1 {
+		t.Errorf("failed applied=%d, expected 1", n)
+	}
+
+	n, err = applyMigrations(ctx, db, migrations)
+	if err != nil {
+		t.Fatalf("failed to apply migrations: %v", err)
+	}
+	if n != 1 {
+		t.Errorf("failed applied=%d, expected 1", n)
+	}
+
+	// failed migration is rolled back completely
+	failed := append(migrations, Migration{Version: 3, Name: "failed", Query: "CREATE TABLE `t3` (`id` INTEGER); BAD SQL;"})
+	if _, err = applyMigrations(ctx, db, failed); err == nil {
+		t.Error("expected migration error")
+	}
+
+	if version, err = Version(ctx, db); err != nil {
+		t.Fatalf("failed to get version: %v", err)
+	}
+	if version != 2 {
+		t.Errorf("failed version=%d, expected 2", version)
+	}
+
+	var count int
+	err = db.QueryRowContext(ctx, "SELECT COUNT(*) FROM `sqlite_master` WHERE `name`='t3';").Scan(&count)
+	if err != nil {
+		t.Fatalf("failed to check table: %v", err)
+	}
+	if count != 0 {
+		t.Error("table of failed migration exists")
+	}
+}
+
+func TestMigrateLegacy(t *testing.T) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "legacy.sqlite"))
+	if err != nil {
+		t.Fatalf("failed to open database: %s", err)
+	}
+	defer func() {
+		if e := db.Close(); e != nil {
+			t.Errorf("failed to close database: %s", e)
+		}
+	}()
+
+	// old database without columns which were added by manual ALTER queries
+	ctx := context.Background()
+	const legacy = "CREATE TABLE `chat` (`id` VARCHAR(255) PRIMARY KEY NOT NULL, " +
+		"`active` SMALLINT NOT NULL DEFAULT 0, `exclude` TEXT, `url` TEXT, " +
+		"`created` DATETIME NOT NULL, `updated` DATETIME NOT NULL); " +
+		"INSERT INTO `chat` (`id`, `active`, `exclude`, `url`, `created`, `updated`) " +
+		"VALUES ('legacy', 1, '[\"user1\"]', '', '2022-01-01 00:00:00', '2022-01-01 00:00:00');"
+
+	if _, err = db.ExecContext(ctx, legacy); err != nil {
+		t.Fatalf("failed to create legacy table: %v", err)
+	}
+
+	if _, err = Migrate(ctx, db); err != nil {
+		t.Fatalf("failed to migrate legacy database: %v", err)
+	}
+
+	var userID, urlText string
+	err = db.QueryRowContext(ctx, "SELECT `user_id` FROM `chat_user_state` WHERE `chat_id`='legacy' AND `state`=1;").
+		Scan(&userID)
+	if err != nil {
+		t.Fatalf("failed to read excluded user: %v", err)
+	}
+	if userID != "user1" {
+		t.Errorf("failed excluded user %q", userID)
+	}
+
+	if err = db.QueryRowContext(ctx, "SELECT `url_text` FROM `chat` WHERE `id`='legacy';").Scan(&urlText); err != nil {
+		t.Fatalf("failed to read chat: %v", err)
+	}
+	if urlText != "call" {
+		t.Errorf("failed url_text %q", urlText)
+	}
+}
@@ -0,0 +1,42 @@
+/*
+Users' states in chats instead of JSON sets in the chat table.
+
+chat_id - chat identifier
+user_id - user identifier
+state - type of state: 1 - excluded, 2 - skipped, 3 - absent on a week day
+weekday - week day number from 0 (Sunday) to 6 (Saturday) for state=3, otherwise -1
+until - UTC timestamp when the state expires, NULL if it is unlimited
+created - timestamp of item create
+*/
+CREATE TABLE IF NOT EXISTS `chat_user_state`
+(
+    `chat_id` VARCHAR(255) NOT NULL,
+    `user_id` VARCHAR(255) NOT NULL,
+    `state`   SMALLINT     NOT NULL,
+    `weekday` SMALLINT     NOT NULL DEFAULT -1,
+    `until`   DATETIME,
+    `created` DATETIME     NOT NULL,
+    PRIMARY KEY (`chat_id`, `user_id`, `state`, `weekday`)
+);
+CREATE INDEX IF NOT EXISTS `chat_user_state_user` ON `chat_user_state` (`user_id`, `state`);
+
+INSERT OR IGNORE INTO `chat_user_state` (`chat_id`, `user_id`, `state`, `weekday`, `until`, `created`)
+SELECT `chat`.`id`, `u`.`value`, 1, -1, NULL, strftime('%Y-%m-%d %H:%M:%S+00:00', 'now')
+FROM `chat`, json_each(`chat`.`exclude`) AS `u`
+WHERE `chat`.`exclude` IS NOT NULL AND `chat`.`exclude` != '';
+
+-- skipped users are returned at the next UTC midnight
+INSERT OR IGNORE INTO `chat_user_state` (`chat_id`, `user_id`, `state`, `weekday`, `until`, `created`)
+SELECT `chat`.`id`, `u`.`value`, 2, -1,
+       strftime('%Y-%m-%d 00:00:00+00:00', 'now', '+1 day'), strftime('%Y-%m-%d %H:%M:%S+00:00', 'now')
+FROM `chat`, json_each(`chat`.`skip`) AS `u`
+WHERE `chat`.`skip` IS NOT NULL AND `chat`.`skip` != '';
+
+INSERT OR IGNORE INTO `chat_user_state` (`chat_id`, `user_id`, `state`, `weekday`, `until`, `created`)
+SELECT `chat`.`id`, `u`.`value`, 3, CAST(`d`.`key` AS INTEGER), NULL, strftime('%Y-%m-%d %H:%M:%S+00:00', 'now')
+FROM `chat`, json_each(`chat`.`days`) AS `d`, json_each(`d`.`value`) AS `u`
+WHERE `chat`.`days` IS NOT NULL AND `chat`.`days` != '';
+
+ALTER TABLE `chat` DROP COLUMN `exclude`;
+ALTER TABLE `chat` DROP COLUMN `skip`;
+ALTER TABLE `chat` DROP COLUMN `days`;
@@ -0,0 +1,19 @@
+/*
+Schedules of automatic "/go" posts.
+
+chat_id - chat identifier
+hour - local hour of the post
+minute - local minute of the post
+weekdays - bit mask of week days of the post, bit 0 is Sunday and bit 6 is Saturday
+last_run - UTC timestamp of the last post, it prevents duplicate posts
+created - timestamp of item create
+*/
+CREATE TABLE IF NOT EXISTS `chat_schedule`
+(
+    `chat_id`  VARCHAR(255) PRIMARY KEY NOT NULL,
+    `hour`     SMALLINT                 NOT NULL,
+    `minute`   SMALLINT                 NOT NULL,
+    `weekdays` SMALLINT                 NOT NULL,
+    `last_run` DATETIME,
+    `created`  DATETIME                 NOT NULL
+);
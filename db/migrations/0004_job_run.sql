@@ -0,0 +1,11 @@
+/*
+Last successful runs of scheduler jobs, they are used for missed runs catch-up after restarts.
+
+name - unique job name
+last_run - UTC timestamp of the last successful run
+*/
+CREATE TABLE IF NOT EXISTS `job_run`
+(
+    `name`     VARCHAR(255) PRIMARY KEY NOT NULL,
+    `last_run` DATETIME                 NOT NULL
+);
@@ -0,0 +1,6 @@
+/*
+Chat's timezone.
+
+timezone - IANA timezone name, empty value means the default timezone from the configuration
+*/
+ALTER TABLE `chat` ADD COLUMN `timezone` VARCHAR(255) NOT NULL DEFAULT '';
@@ -0,0 +1,20 @@
+/*
+Ordering strategy of chat members and history of "/go" results.
+
+chat.go_order - ordering strategy name, empty value means random order
+
+go_history.id - unique identifier
+go_history.chat_id - chat identifier
+go_history.users - JSON array of ordered user identifiers
+go_history.created - UTC timestamp of the order
+*/
+ALTER TABLE `chat` ADD COLUMN `go_order` VARCHAR(32) NOT NULL DEFAULT '';
+
+CREATE TABLE IF NOT EXISTS `go_history`
+(
+    `id`      INTEGER PRIMARY KEY AUTOINCREMENT,
+    `chat_id` VARCHAR(255) NOT NULL,
+    `users`   TEXT         NOT NULL,
+    `created` DATETIME     NOT NULL
+);
+CREATE INDEX IF NOT EXISTS `go_history_chat` ON `go_history` (`chat_id`, `created`);
@@ -0,0 +1,6 @@
+/*
+Author of "/go" command in the history.
+
+author - identifier of the user who called the command, empty value for scheduled posts
+*/
+ALTER TABLE `go_history` ADD COLUMN `author` VARCHAR(255) NOT NULL DEFAULT '';
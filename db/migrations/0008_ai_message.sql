@@ -0,0 +1,20 @@
+/*
+Conversation history of AI commands.
+
+id - unique identifier, it defines messages order
+chat_id - chat identifier
+provider - AI provider name, for example "gpt"
+role - message author role: "user" or "assistant"
+content - message text
+created - UTC timestamp of the message
+*/
+CREATE TABLE IF NOT EXISTS `ai_message`
+(
+    `id`       INTEGER PRIMARY KEY AUTOINCREMENT,
+    `chat_id`  VARCHAR(255) NOT NULL,
+    `provider` VARCHAR(255) NOT NULL,
+    `role`     VARCHAR(32)  NOT NULL,
+    `content`  TEXT         NOT NULL,
+    `created`  DATETIME     NOT NULL
+);
+CREATE INDEX IF NOT EXISTS `ai_message_chat` ON `ai_message` (`chat_id`, `provider`);
@@ -0,0 +1,6 @@
+/*
+System prompt of chat's AI commands.
+
+chat.prompt - system prompt text, empty value means the default one from configuration
+*/
+ALTER TABLE `chat` ADD COLUMN `prompt` TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,7 @@
+/*
+Chat's overrides of AI providers' completion options.
+
+chat.ai_options - JSON object, keys are provider names, values are objects
+with optional "model", "temperature" and "max_tokens" fields, empty value means defaults
+*/
+ALTER TABLE `chat` ADD COLUMN `ai_options` TEXT NOT NULL DEFAULT '';
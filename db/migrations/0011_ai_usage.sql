@@ -0,0 +1,21 @@
+/*
+Daily usage of AI commands.
+
+chat_id - chat identifier
+user_id - user identifier, the author of the request
+provider - AI provider name
+day - date in the chat's timezone, format YYYY-MM-DD
+requests - number of requests
+tokens - number of used tokens
+*/
+CREATE TABLE IF NOT EXISTS `ai_usage`
+(
+    `chat_id`  VARCHAR(255) NOT NULL,
+    `user_id`  VARCHAR(255) NOT NULL,
+    `provider` VARCHAR(255) NOT NULL,
+    `day`      VARCHAR(10)  NOT NULL,
+    `requests` INTEGER      NOT NULL DEFAULT 0,
+    `tokens`   INTEGER      NOT NULL DEFAULT 0,
+    PRIMARY KEY (`chat_id`, `user_id`, `provider`, `day`)
+);
+CREATE INDEX IF NOT EXISTS `ai_usage_user` ON `ai_usage` (`user_id`, `day`);
@@ -0,0 +1,16 @@
+/*
+Cache of AI answers.
+
+key - SHA-256 hash of the request: provider, model, system prompt and question
+provider - AI provider name which answered, it can differ from the requested one
+answer - answer text
+created - UTC timestamp of the answer, it's used for expiration
+*/
+CREATE TABLE IF NOT EXISTS `ai_cache`
+(
+    `key`      VARCHAR(64)  NOT NULL PRIMARY KEY,
+    `provider` VARCHAR(255) NOT NULL,
+    `answer`   TEXT         NOT NULL,
+    `created`  DATETIME     NOT NULL
+);
+CREATE INDEX IF NOT EXISTS `ai_cache_created` ON `ai_cache` (`created`);
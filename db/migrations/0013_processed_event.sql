@@ -0,0 +1,20 @@
+/*
+Processed messages with bot commands, they are used to skip redelivered and not changed edited messages.
+
+id - unique identifier, it defines the order to remove old records
+chat_id - chat identifier
+msg_id - message identifier
+text - normalized command text
+outcome - command's result which should be repeated by re-runs of the edited message, for example "on" or "off"
+created - UTC timestamp of the processing
+*/
+CREATE TABLE IF NOT EXISTS `processed_event`
+(
+    `id`      INTEGER PRIMARY KEY AUTOINCREMENT,
+    `chat_id` VARCHAR(255) NOT NULL,
+    `msg_id`  VARCHAR(255) NOT NULL,
+    `text`    TEXT         NOT NULL,
+    `outcome` VARCHAR(255) NOT NULL DEFAULT '',
+    `created` DATETIME     NOT NULL
+);
+CREATE UNIQUE INDEX IF NOT EXISTS `processed_event_msg` ON `processed_event` (`chat_id`, `msg_id`);
@@ -0,0 +1,6 @@
+/*
+Command names of processed messages, the outcome is repeated only by re-runs of the same command.
+
+processed_event.command - main name of the handled command, for example "/skip"
+*/
+ALTER TABLE `processed_event` ADD COLUMN `command` VARCHAR(255) NOT NULL DEFAULT '';
@@ -0,0 +1,23 @@
+/*
+Known chat members for messengers which don't return lists of chat members, for example Telegram.
+They are collected from incoming messages and chat administrators.
+
+chat_id - chat identifier
+user_id - user identifier
+first_name - user's first name
+last_name - user's last name
+username - user's name for mentions, it can be empty
+bot - user is a bot
+updated - UTC timestamp of the latest update
+*/
+CREATE TABLE IF NOT EXISTS `chat_member`
+(
+    `chat_id`    VARCHAR(255) NOT NULL,
+    `user_id`    VARCHAR(255) NOT NULL,
+    `first_name` VARCHAR(255) NOT NULL DEFAULT '',
+    `last_name`  VARCHAR(255) NOT NULL DEFAULT '',
+    `username`   VARCHAR(255) NOT NULL DEFAULT '',
+    `bot`        BOOLEAN      NOT NULL DEFAULT false,
+    `updated`    DATETIME     NOT NULL,
+    PRIMARY KEY (`chat_id`, `user_id`)
+);
@@ -0,0 +1,192 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// allWeekDays is a bit mask of all week days.
+const allWeekDays = 1<<7 - 1
+
+// Schedule is a chat's schedule of automatic "/go" posts.
+// Hour and Minute are local time values, the location is defined during Due checks.
+type Schedule struct {
+	ChatID   string    `db:"chat_id"`
+	Hour     int       `db:"hour"`
+	Minute   int       `db:"minute"`
+	WeekDays int       `db:"weekdays"` // bit mask, bit 0 is Sunday
+	LastRun  time.Time `db:"last_run"` // zero value if there were no runs
+	Created  time.Time `db:"created"`
+	Timezone string    // chat's timezone, it's loaded only by ActiveSchedules
+}
+
+// NewSchedule returns a new schedule for the chat, empty days mean every day.
+func NewSchedule(chatID string, hour, minute int, days map[time.Weekday]struct{}) *Schedule {
+	s := &Schedule{ChatID: chatID, Hour: hour, Minute: minute}
+
+	for day := range days {
+		s.WeekDays |= 1 << day
+	}
+
+	if s.WeekDays == 0 {
+		s.WeekDays = allWeekDays
+	}
+
+	return s
+}
+
+// HasDay returns true if the schedule is active on the week day.
+func (s *Schedule) HasDay(day time.Weekday) bool {
+	return s.WeekDays&(1<<day) != 0
+}
+
+// String returns a human-readable schedule description.
+func (s *Schedule) String() string {
+	var days []string
+
+	if s.WeekDays&allWeekDays == allWeekDays {
+		days = []string{"every day"}
+	} else {
+		for day := time.Sunday; day <= time.Saturday; day++ {
+			if s.HasDay(day) {
+				days = append(days, day.String())
+			}
+		}
+	}
+
+	return fmt.Sprintf("%02d:%02d %s", s.Hour, s.Minute, strings.Join(days, ", "))
+}
+
+// Location returns the chat's timezone location or defaultLocation if it is not set or invalid.
+func (s *Schedule) Location(defaultLocation *time.Location) *time.Location {
+	return location(s.Timezone, defaultLocation)
+}
+
+// Due returns a time of the scheduled run for the day of now and true if it should be done now.
+// The run is due if its time is passed less than grace ago and it was not done yet.
+func (s *Schedule) Due(now time.Time, grace time.Duration) (time.Time, bool) {
+	run := time.Date(now.Year(), now.Month(), now.Day(), s.Hour, s.Minute, 0, 0, now.Location())
+
+	if !s.HasDay(now.Weekday()) || now.Before(run) || now.Sub(run) >= grace {
+		return run, false
+	}
+
+	return run, s.LastRun.Before(run)
+}
+
+// Save inserts or replaces the chat's schedule.
+// Last run time is set to now, so already passed runs of the new schedule are not done today.
+func (s *Schedule) Save(ctx context.Context, db *sql.DB) error {
+	const query = "INSERT OR REPLACE INTO `chat_schedule` " +
+		"(`chat_id`, `hour`, `minute`, `weekdays`, `last_run`, `created`) VALUES (?,?,?,?,?,?);"
+
+	now := time.Now().UTC()
+	if _, err := db.ExecContext(ctx, query, s.ChatID, s.Hour, s.Minute, s.WeekDays, now, now); err != nil {
+		return fmt.Errorf("schedule save exec: %w", err)
+	}
+
+	s.LastRun, s.Created = now, now
+	return nil
+}
+
+// SaveRun updates the last run time of the schedule.
+func (s *Schedule) SaveRun(ctx context.Context, db *sql.DB, ts time.Time) error {
+	const query = "UPDATE `chat_schedule` SET `last_run`=? WHERE `chat_id`=?;"
+
+	ts = ts.UTC()
+	if _, err := db.ExecContext(ctx, query, ts, s.ChatID); err != nil {
+		return fmt.Errorf("schedule run exec: %w", err)
+	}
+
+	s.LastRun = ts
+	return nil
+}
+
+// GetSchedule returns the chat's schedule, error wraps sql.ErrNoRows if there is no one.
+func GetSchedule(ctx context.Context, db *sql.DB, chatID string) (*Schedule, error) {
+	const query = "SELECT `chat_id`, `hour`, `minute`, `weekdays`, `last_run`, `created` " +
+		"FROM `chat_schedule` WHERE `chat_id`=? LIMIT 1;"
+
+	s, err := scanSchedule(db.QueryRowContext(ctx, query, chatID))
+	if err != nil {
+		return nil, fmt.Errorf("schedule scan: %w", err)
+	}
+
+	return s, nil
+}
+
+// DeleteSchedule removes the chat's schedule and returns true if it existed.
+func DeleteSchedule(ctx context.Context, db *sql.DB, chatID string) (bool, error) {
+	const query = "DELETE FROM `chat_schedule` WHERE `chat_id`=?;"
+
+	result, err := db.ExecContext(ctx, query, chatID)
+	if err != nil {
+		return false, fmt.Errorf("schedule delete exec: %w", err)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("schedule delete rows: %w", err)
+	}
+
+	return n > 0, nil
+}
+
+// ActiveSchedules returns schedules of all active chats.
+func ActiveSchedules(ctx context.Context, db *sql.DB) ([]*Schedule, error) {
+	const query = "SELECT `s`.`chat_id`, `s`.`hour`, `s`.`minute`, `s`.`weekdays`, `s`.`last_run`, `s`.`created`, " +
+		"`chat`.`timezone` " +
+		"FROM `chat_schedule` AS `s` INNER JOIN `chat` ON `chat`.`id`=`s`.`chat_id` " +
+		"WHERE `chat`.`active`=1 ORDER BY `s`.`chat_id`;"
+
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("schedules query: %w", err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var schedules []*Schedule
+	for rows.Next() {
+		var timezone string
+
+		s, errScan := scanSchedule(rows, &timezone)
+		if errScan != nil {
+			return nil, fmt.Errorf("schedules scan: %w", errScan)
+		}
+
+		s.Timezone = timezone
+		schedules = append(schedules, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("schedules rows: %w", err)
+	}
+
+	return schedules, nil
+}
+
+// scanner is a common interface for sql.Row and sql.Rows.
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+// scanSchedule reads a schedule from the row, extra destinations are scanned after schedule's fields.
+func scanSchedule(row scanner, extra ...any) (*Schedule, error) {
+	var (
+		s       = &Schedule{}
+		lastRun sql.NullTime
+	)
+
+	dest := append([]any{&s.ChatID, &s.Hour, &s.Minute, &s.WeekDays, &lastRun, &s.Created}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return nil, err
+	}
+
+	s.LastRun = lastRun.Time
+	return s, nil
+}
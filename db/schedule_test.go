@@ -0,0 +1,142 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSchedule_Due(t *testing.T) {
+	moscow, err := time.LoadLocation("Europe/Moscow")
+	if err != nil {
+		t.Fatalf("failed to load timezone: %v", err)
+	}
+
+	// 2026-10-19 is Monday
+	workDays := map[time.Weekday]struct{}{time.Monday: {}, time.Friday: {}}
+	lastRun := time.Date(2026, 10, 19, 10, 0, 0, 0, moscow)
+
+	testCases := []struct {
+		name     string
+		now      time.Time
+		lastRun  time.Time
+		days     map[time.Weekday]struct{}
+		expected bool
+	}{
+		{name: "exact", now: time.Date(2026, 10, 19, 10, 0, 1, 0, moscow), days: workDays, expected: true},
+		{name: "delayed", now: time.Date(2026, 10, 19, 10, 4, 0, 0, moscow), days: workDays, expected: true},
+		{name: "every_day", now: time.Date(2026, 10, 18, 10, 0, 1, 0, moscow), expected: true},
+		{name: "early", now: time.Date(2026, 10, 19, 9, 59, 59, 0, moscow), days: workDays},
+		{name: "late", now: time.Date(2026, 10, 19, 10, 5, 0, 0, moscow), days: workDays},
+		{name: "other_day", now: time.Date(2026, 10, 20, 10, 0, 1, 0, moscow), days: workDays},
+		{name: "done", now: time.Date(2026, 10, 19, 10, 1, 0, 0, moscow), lastRun: lastRun, days: workDays},
+		{name: "yesterday", now: time.Date(2026, 10, 23, 10, 1, 0, 0, moscow), lastRun: lastRun, days: workDays, expected: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := NewSchedule("TestSchedule_Due", 10, 0, tc.days)
+			s.LastRun = tc.lastRun
+
+			if _, ok := s.Due(tc.now, 5*time.Minute); ok != tc.expected {
+				t.Errorf("failed due=%v, expected=%v", ok, tc.expected)
+			}
+		})
+	}
+}
+
+func TestSchedule_String(t *testing.T) {
+	s := NewSchedule("TestSchedule_String", 9, 5, map[time.Weekday]struct{}{time.Tuesday: {}, time.Monday: {}})
+	if value, expected := s.String(), "09:05 Monday, Tuesday"; value != expected {
+		t.Errorf("failed string=%q, expected=%q", value, expected)
+	}
+
+	s = NewSchedule("TestSchedule_String", 18, 30, nil)
+	if value, expected := s.String(), "18:30 every day"; value != expected {
+		t.Errorf("failed string=%q, expected=%q", value, expected)
+	}
+}
+
+func TestActiveSchedules(t *testing.T) {
+	db, err := open()
+	if err != nil {
+		t.Fatalf("failed to open database: %s", err)
+	}
+	defer func() {
+		if e := db.Close(); e != nil {
+			t.Errorf("failed to close database: %s", e)
+		}
+	}()
+
+	ctx := context.Background()
+	chats := []*Chat{{ID: "TestActiveSchedules1", Active: true}, {ID: "TestActiveSchedules2"}}
+
+	for _, chat := range chats {
+		if err = chat.Upsert(ctx, db); err != nil {
+			t.Fatalf("failed to upsert chat: %s", err)
+		}
+
+		if err = NewSchedule(chat.ID, 10, 0, nil).Save(ctx, db); err != nil {
+			t.Fatalf("failed to save schedule: %s", err)
+		}
+	}
+
+	s := NewSchedule(chats[0].ID, 11, 30, map[time.Weekday]struct{}{time.Monday: {}})
+	if err = s.Save(ctx, db); err != nil {
+		t.Fatalf("failed to save schedule: %s", err)
+	}
+
+	ts := time.Now().Add(time.Minute)
+	if err = s.SaveRun(ctx, db, ts); err != nil {
+		t.Fatalf("failed to save run: %s", err)
+	}
+
+	schedules, err := ActiveSchedules(ctx, db)
+	if err != nil {
+		t.Fatalf("failed to get schedules: %s", err)
+	}
+
+	var found *Schedule
+	for _, item := range schedules {
+		if item.ChatID == chats[1].ID {
+			t.Errorf("schedule of stopped chat is returned")
+		}
+		if item.ChatID == chats[0].ID {
+			found = item
+		}
+	}
+
+	if found == nil {
+		t.Fatal("schedule of active chat is not found")
+	}
+
+	if found.Hour != 11 || found.Minute != 30 || found.WeekDays != s.WeekDays || !found.LastRun.Equal(ts.UTC()) {
+		t.Errorf("failed schedule %+v, expected %+v", found, s)
+	}
+
+	for _, chat := range chats {
+		ok, errDelete := DeleteSchedule(ctx, db, chat.ID)
+		if errDelete != nil {
+			t.Fatalf("failed to delete schedule: %s", errDelete)
+		}
+
+		if !ok {
+			t.Errorf("schedule of chat %q is not deleted", chat.ID)
+		}
+	}
+
+	if _, err = GetSchedule(ctx, db, chats[0].ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	ok, err := DeleteSchedule(ctx, db, chats[0].ID)
+	if err != nil {
+		t.Fatalf("failed to delete schedule: %s", err)
+	}
+
+	if ok {
+		t.Error("deleted not existing schedule")
+	}
+}
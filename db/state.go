@@ -0,0 +1,318 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// UserState is a type of user's state in a chat.
+type UserState int
+
+// Users' states in chats.
+const (
+	StateExcluded UserState = iota + 1 // user is excluded from the chat
+	StateSkipped                       // user is skipped until some time
+	StateWeekDay                       // user is absent on some week day
+)
+
+// noWeekDay is a week day value of states which are not related to week days.
+const noWeekDay = -1
+
+// ChatUserState is a user's state in a chat.
+type ChatUserState struct {
+	ChatID  string       `db:"chat_id"`
+	UserID  string       `db:"user_id"`
+	State   UserState    `db:"state"`
+	WeekDay time.Weekday `db:"weekday"` // only for StateWeekDay
+	Until   time.Time    `db:"until"`   // zero value for unlimited states
+	Created time.Time    `db:"created"`
+}
+
+// loadStates loads users' states of the chat to its in-memory sets.
+// Expired states are ignored.
+func (chat *Chat) loadStates(ctx context.Context, db *sql.DB) error {
+	const query = "SELECT `user_id`, `state`, `weekday` FROM `chat_user_state` " +
+		"WHERE `chat_id`=? AND (`until` IS NULL OR `until` > ?);"
+
+	rows, err := db.QueryContext(ctx, query, chat.ID, time.Now().UTC())
+	if err != nil {
+		return fmt.Errorf("states query: %w", err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	chat.ExcludeUsers, chat.SkipUsers, chat.WeekDays = nil, nil, nil
+
+	for rows.Next() {
+		var (
+			userID  string
+			state   UserState
+			weekDay int
+		)
+
+		if err = rows.Scan(&userID, &state, &weekDay); err != nil {
+			return fmt.Errorf("states scan: %w", err)
+		}
+
+		switch state {
+		case StateExcluded:
+			chat.AddExclude(map[string]struct{}{userID: {}})
+		case StateSkipped:
+			chat.AddSkip(userID)
+		case StateWeekDay:
+			chat.addWeekDay(time.Weekday(weekDay), userID)
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("states rows: %w", err)
+	}
+
+	return nil
+}
+
+// insertStates inserts or replaces users' states of the chat inside the transaction.
+func (chat *Chat) insertStates(ctx context.Context, tx *sql.Tx, states []ChatUserState) error {
+	const query = "INSERT OR REPLACE INTO `chat_user_state` " +
+		"(`chat_id`, `user_id`, `state`, `weekday`, `until`, `created`) VALUES (?,?,?,?,?,?);"
+
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return fmt.Errorf("insert statement: %w", err)
+	}
+
+	now := time.Now().UTC()
+	for _, s := range states {
+		var until sql.NullTime
+		if !s.Until.IsZero() {
+			until = sql.NullTime{Time: s.Until.UTC(), Valid: true}
+		}
+
+		weekDay := noWeekDay
+		if s.State == StateWeekDay {
+			weekDay = int(s.WeekDay)
+		}
+
+		if _, err = stmt.ExecContext(ctx, chat.ID, s.UserID, s.State, weekDay, until, now); err != nil {
+			return fmt.Errorf("state exec: %w", err)
+		}
+	}
+
+	if err = stmt.Close(); err != nil {
+		return fmt.Errorf("close exist statement: %w", err)
+	}
+
+	return nil
+}
+
+// removeStates removes all states with type state of users from the chat inside the transaction.
+func (chat *Chat) removeStates(ctx context.Context, tx *sql.Tx, state UserState, userIDs map[string]struct{}) error {
+	const query = "DELETE FROM `chat_user_state` WHERE `chat_id`=? AND `user_id`=? AND `state`=?;"
+
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return fmt.Errorf("delete statement: %w", err)
+	}
+
+	for userID := range userIDs {
+		if _, err = stmt.ExecContext(ctx, chat.ID, userID, state); err != nil {
+			return fmt.Errorf("state delete exec: %w", err)
+		}
+	}
+
+	if err = stmt.Close(); err != nil {
+		return fmt.Errorf("close exist statement: %w", err)
+	}
+
+	return nil
+}
+
+// saveStates inserts or replaces users' states of the chat.
+func (chat *Chat) saveStates(ctx context.Context, db *sql.DB, states []ChatUserState) error {
+	return InTransaction(ctx, db, func(tx *sql.Tx) error {
+		return chat.insertStates(ctx, tx, states)
+	})
+}
+
+// deleteStates removes all states with type state of users from the chat.
+func (chat *Chat) deleteStates(ctx context.Context, db *sql.DB, state UserState, userIDs map[string]struct{}) error {
+	return InTransaction(ctx, db, func(tx *sql.Tx) error {
+		return chat.removeStates(ctx, tx, state, userIDs)
+	})
+}
+
+// SaveExclude adds users to the chat's exclude set and saves them.
+func (chat *Chat) SaveExclude(ctx context.Context, db *sql.DB, userIDs map[string]struct{}) error {
+	states := make([]ChatUserState, 0, len(userIDs))
+	for userID := range userIDs {
+		states = append(states, ChatUserState{UserID: userID, State: StateExcluded})
+	}
+
+	if err := chat.saveStates(ctx, db, states); err != nil {
+		return err
+	}
+
+	chat.AddExclude(userIDs)
+	return nil
+}
+
+// DeleteExclude removes users from the chat's exclude set.
+func (chat *Chat) DeleteExclude(ctx context.Context, db *sql.DB, userIDs map[string]struct{}) error {
+	if err := chat.deleteStates(ctx, db, StateExcluded, userIDs); err != nil {
+		return err
+	}
+
+	chat.DelExclude(userIDs)
+	return nil
+}
+
+// SaveVacation adds the user to the chat's exclude set until the return time.
+// A permanent exclude is not replaced, otherwise the user would be returned after the vacation.
+func (chat *Chat) SaveVacation(ctx context.Context, db *sql.DB, userID string, until time.Time) error {
+	const query = "INSERT INTO `chat_user_state` (`chat_id`, `user_id`, `state`, `weekday`, `until`, `created`) " +
+		"VALUES (?,?,?,?,?,?) ON CONFLICT (`chat_id`, `user_id`, `state`, `weekday`) " +
+		"DO UPDATE SET `until`=`excluded`.`until`, `created`=`excluded`.`created` " +
+		"WHERE `chat_user_state`.`until` IS NOT NULL;"
+
+	_, err := db.ExecContext(ctx, query, chat.ID, userID, StateExcluded, noWeekDay, until.UTC(), time.Now().UTC())
+	if err != nil {
+		return fmt.Errorf("vacation exec: %w", err)
+	}
+
+	chat.AddExclude(map[string]struct{}{userID: {}})
+	return nil
+}
+
+// SaveSkip adds the user to the chat's skip set until some time.
+func (chat *Chat) SaveSkip(ctx context.Context, db *sql.DB, userID string, until time.Time) error {
+	state := ChatUserState{UserID: userID, State: StateSkipped, Until: until}
+
+	if err := chat.saveStates(ctx, db, []ChatUserState{state}); err != nil {
+		return err
+	}
+
+	chat.AddSkip(userID)
+	return nil
+}
+
+// DeleteSkip removes the user from the chat's skip set.
+func (chat *Chat) DeleteSkip(ctx context.Context, db *sql.DB, userID string) error {
+	if err := chat.deleteStates(ctx, db, StateSkipped, map[string]struct{}{userID: {}}); err != nil {
+		return err
+	}
+
+	chat.DelSkip(userID)
+	return nil
+}
+
+// SaveWeekDays replaces the user's absent week days, empty days remove all of them.
+// Old days are replaced in one transaction, so the user never has partially saved days.
+func (chat *Chat) SaveWeekDays(ctx context.Context, db *sql.DB, userID string, days map[time.Weekday]struct{}) error {
+	states := make([]ChatUserState, 0, len(days))
+	for day := range days {
+		states = append(states, ChatUserState{UserID: userID, State: StateWeekDay, WeekDay: day})
+	}
+
+	err := InTransaction(ctx, db, func(tx *sql.Tx) error {
+		if err := chat.removeStates(ctx, tx, StateWeekDay, map[string]struct{}{userID: {}}); err != nil {
+			return err
+		}
+		return chat.insertStates(ctx, tx, states)
+	})
+	if err != nil {
+		return err
+	}
+
+	for day, users := range chat.WeekDays {
+		delete(users, userID)
+
+		if len(users) == 0 {
+			delete(chat.WeekDays, day)
+		}
+	}
+
+	for day := range days {
+		chat.addWeekDay(day, userID)
+	}
+
+	return nil
+}
+
+// StateChats returns identifiers of chats where the user has a not expired state.
+func StateChats(ctx context.Context, db *sql.DB, userID string, state UserState) ([]string, error) {
+	const query = "SELECT DISTINCT `chat_id` FROM `chat_user_state` " +
+		"WHERE `user_id`=? AND `state`=? AND (`until` IS NULL OR `until` > ?) ORDER BY `chat_id`;"
+
+	rows, err := db.QueryContext(ctx, query, userID, state, time.Now().UTC())
+	if err != nil {
+		return nil, fmt.Errorf("state chats query: %w", err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var chats []string
+	for rows.Next() {
+		var chatID string
+
+		if err = rows.Scan(&chatID); err != nil {
+			return nil, fmt.Errorf("state chats scan: %w", err)
+		}
+
+		chats = append(chats, chatID)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("state chats rows: %w", err)
+	}
+
+	return chats, nil
+}
+
+// ExpiredExclude returns all expired exclude states, for example finished vacations.
+// Expired states are already ignored by chats, they are kept only to notify users.
+func ExpiredExclude(ctx context.Context, db *sql.DB) ([]ChatUserState, error) {
+	const query = "SELECT `chat_id`, `user_id`, `until`, `created` FROM `chat_user_state` " +
+		"WHERE `state`=? AND `until` IS NOT NULL AND `until` <= ? ORDER BY `chat_id`, `user_id`;"
+
+	rows, err := db.QueryContext(ctx, query, StateExcluded, time.Now().UTC())
+	if err != nil {
+		return nil, fmt.Errorf("expired exclude query: %w", err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var states []ChatUserState
+	for rows.Next() {
+		s := ChatUserState{State: StateExcluded, WeekDay: noWeekDay}
+
+		if err = rows.Scan(&s.ChatID, &s.UserID, &s.Until, &s.Created); err != nil {
+			return nil, fmt.Errorf("expired exclude scan: %w", err)
+		}
+
+		states = append(states, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("expired exclude rows: %w", err)
+	}
+
+	return states, nil
+}
+
+// DeleteExpiredExclude removes the user's expired exclude state from the chat.
+// A not expired state is kept, so a vacation which is prolonged meanwhile is not lost.
+func DeleteExpiredExclude(ctx context.Context, db *sql.DB, chatID, userID string) error {
+	const query = "DELETE FROM `chat_user_state` " +
+		"WHERE `chat_id`=? AND `user_id`=? AND `state`=? AND `until` IS NOT NULL AND `until` <= ?;"
+
+	if _, err := db.ExecContext(ctx, query, chatID, userID, StateExcluded, time.Now().UTC()); err != nil {
+		return fmt.Errorf("expired exclude delete: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,279 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"maps"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestChat_SaveWeekDays(t *testing.T) {
+	const chatID = "TestChat_SaveWeekDays"
+
+	db, err := open()
+	if err != nil {
+		t.Fatalf("failed to open database: %s", err)
+	}
+	defer func() {
+		if e := db.Close(); e != nil {
+			t.Errorf("failed to close database: %s", e)
+		}
+	}()
+
+	ctx := context.Background()
+	chat := &Chat{ID: chatID, Active: true}
+
+	if err = chat.Upsert(ctx, db); err != nil {
+		t.Fatalf("failed to upsert chat: %s", err)
+	}
+
+	days := map[time.Weekday]struct{}{time.Monday: {}, time.Friday: {}}
+	if err = chat.SaveWeekDays(ctx, db, "user1", days); err != nil {
+		t.Fatalf("failed to save week days: %s", err)
+	}
+
+	days = map[time.Weekday]struct{}{time.Friday: {}}
+	if err = chat.SaveWeekDays(ctx, db, "user2", days); err != nil {
+		t.Fatalf("failed to save week days: %s", err)
+	}
+
+	// replace user1 days
+	days = map[time.Weekday]struct{}{time.Tuesday: {}}
+	if err = chat.SaveWeekDays(ctx, db, "user1", days); err != nil {
+		t.Fatalf("failed to save week days: %s", err)
+	}
+
+	expected := map[time.Weekday]map[string]struct{}{
+		time.Tuesday: {"user1": {}},
+		time.Friday:  {"user2": {}},
+	}
+
+	if !maps.EqualFunc(chat.WeekDays, expected, maps.Equal) {
+		t.Errorf("failed compare week days, current %v expected %v", chat.WeekDays, expected)
+	}
+
+	dbChat, err := Get(ctx, db, chatID)
+	if err != nil {
+		t.Fatalf("failed to get chat: %s", err)
+	}
+
+	if !maps.EqualFunc(dbChat.WeekDays, expected, maps.Equal) {
+		t.Errorf("failed compare week days, current %v expected %v", dbChat.WeekDays, expected)
+	}
+
+	// reset
+	if err = chat.SaveWeekDays(ctx, db, "user2", nil); err != nil {
+		t.Fatalf("failed to save week days: %s", err)
+	}
+
+	expected = map[time.Weekday]map[string]struct{}{time.Tuesday: {"user1": {}}}
+	if !maps.EqualFunc(chat.WeekDays, expected, maps.Equal) {
+		t.Errorf("failed compare week days, current %v expected %v", chat.WeekDays, expected)
+	}
+}
+
+func TestStateChats(t *testing.T) {
+	const userID = "TestStateChats"
+
+	db, err := open()
+	if err != nil {
+		t.Fatalf("failed to open database: %s", err)
+	}
+	defer func() {
+		if e := db.Close(); e != nil {
+			t.Errorf("failed to close database: %s", e)
+		}
+	}()
+
+	ctx := context.Background()
+	user := map[string]struct{}{userID: {}}
+
+	for _, chatID := range []string{"TestStateChats1", "TestStateChats2", "TestStateChats3"} {
+		chat := &Chat{ID: chatID}
+
+		if err = chat.SaveExclude(ctx, db, user); err != nil {
+			t.Fatalf("failed to save exclude: %s", err)
+		}
+	}
+
+	chat := &Chat{ID: "TestStateChats2"}
+	if err = chat.DeleteExclude(ctx, db, user); err != nil {
+		t.Fatalf("failed to delete exclude: %s", err)
+	}
+
+	if err = chat.SaveSkip(ctx, db, userID, time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("failed to save skip: %s", err)
+	}
+
+	chats, err := StateChats(ctx, db, userID, StateExcluded)
+	if err != nil {
+		t.Fatalf("failed to get chats: %s", err)
+	}
+
+	expected := []string{"TestStateChats1", "TestStateChats3"}
+	if !slices.Equal(chats, expected) {
+		t.Errorf("failed compare chats, current %v expected %v", chats, expected)
+	}
+
+	chats, err = StateChats(ctx, db, userID, StateSkipped)
+	if err != nil {
+		t.Fatalf("failed to get chats: %s", err)
+	}
+
+	expected = []string{"TestStateChats2"}
+	if !slices.Equal(chats, expected) {
+		t.Errorf("failed compare chats, current %v expected %v", chats, expected)
+	}
+}
+
+func TestDeleteExpiredExclude(t *testing.T) {
+	const chatID = "TestDeleteExpiredExclude"
+
+	db, err := open()
+	if err != nil {
+		t.Fatalf("failed to open database: %s", err)
+	}
+	defer func() {
+		if e := db.Close(); e != nil {
+			t.Errorf("failed to close database: %s", e)
+		}
+	}()
+
+	ctx := context.Background()
+	now := time.Now().UTC()
+	chat := &Chat{ID: chatID, Active: true}
+
+	if err = chat.Upsert(ctx, db); err != nil {
+		t.Fatalf("failed to upsert chat: %s", err)
+	}
+	if err = chat.SaveExclude(ctx, db, map[string]struct{}{"user1": {}}); err != nil {
+		t.Fatalf("failed to save exclude: %s", err)
+	}
+	if err = chat.SaveVacation(ctx, db, "user2", now.Add(-time.Second)); err != nil {
+		t.Fatalf("failed to save vacation: %s", err)
+	}
+	if err = chat.SaveVacation(ctx, db, "user3", now.Add(time.Hour)); err != nil {
+		t.Fatalf("failed to save vacation: %s", err)
+	}
+	// a permanent exclude is not replaced by a vacation
+	if err = chat.SaveVacation(ctx, db, "user1", now.Add(-time.Second)); err != nil {
+		t.Fatalf("failed to save vacation: %s", err)
+	}
+
+	states, err := ExpiredExclude(ctx, db)
+	if err != nil {
+		t.Fatalf("failed to get expired exclude: %s", err)
+	}
+
+	var users []string
+	for _, s := range states {
+		if s.ChatID == chatID {
+			users = append(users, s.UserID)
+		}
+	}
+
+	if expected := []string{"user2"}; !slices.Equal(users, expected) {
+		t.Errorf("failed compare users, current %v expected %v", users, expected)
+	}
+
+	for _, userID := range []string{"user1", "user2", "user3"} {
+		if err = DeleteExpiredExclude(ctx, db, chatID, userID); err != nil {
+			t.Fatalf("failed to delete expired exclude: %s", err)
+		}
+	}
+
+	if states, err = ExpiredExclude(ctx, db); err != nil {
+		t.Fatalf("failed to get expired exclude: %s", err)
+	}
+
+	for _, s := range states {
+		if s.ChatID == chatID {
+			t.Errorf("expired state is not deleted %+v", s)
+		}
+	}
+
+	dbChat, err := Get(ctx, db, chatID)
+	if err != nil {
+		t.Fatalf("failed to get chat: %s", err)
+	}
+
+	expected := map[string]struct{}{"user1": {}, "user3": {}}
+	if !maps.Equal(dbChat.ExcludeUsers, expected) {
+		t.Errorf("failed compare exclude users, current %v expected %v", dbChat.ExcludeUsers, expected)
+	}
+}
+
+func TestMigrateChatUserState(t *testing.T) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "state.sqlite"))
+	if err != nil {
+		t.Fatalf("failed to open database: %s", err)
+	}
+	defer func() {
+		if e := db.Close(); e != nil {
+			t.Errorf("failed to close database: %s", e)
+		}
+	}()
+
+	ctx := context.Background()
+	migrations, err := Migrations()
+	if err != nil {
+		t.Fatalf("failed to load migrations: %v", err)
+	}
+
+	// initial schema with JSON sets
+	if _, err = applyMigrations(ctx, db, migrations[:1]); err != nil {
+		t.Fatalf("failed to apply migrations: %v", err)
+	}
+
+	const query = "INSERT INTO `chat` (`id`, `active`, `url`, `exclude`, `skip`, `days`, `created`, `updated`) " +
+		"VALUES (?, 1, '', ?, ?, ?, ?, ?);"
+	now := time.Now().UTC()
+
+	_, err = db.ExecContext(ctx, query, "chat1", `["user1","user2"]`, `["user3"]`, `{"2":["user1"],"5":["user1","user4"]}`, now, now)
+	if err != nil {
+		t.Fatalf("failed to insert chat: %v", err)
+	}
+
+	_, err = db.ExecContext(ctx, query, "chat2", "", "", "", now, now)
+	if err != nil {
+		t.Fatalf("failed to insert chat: %v", err)
+	}
+
+	if _, err = applyMigrations(ctx, db, migrations); err != nil {
+		t.Fatalf("failed to apply migrations: %v", err)
+	}
+
+	chat, err := Get(ctx, db, "chat1")
+	if err != nil {
+		t.Fatalf("failed to get chat: %v", err)
+	}
+
+	expected := &Chat{
+		ID:           "chat1",
+		Active:       true,
+		URLText:      "call",
+		Created:      now,
+		ExcludeUsers: map[string]struct{}{"user1": {}, "user2": {}},
+		SkipUsers:    map[string]struct{}{"user3": {}},
+		WeekDays: map[time.Weekday]map[string]struct{}{
+			time.Tuesday: {"user1": {}},
+			time.Friday:  {"user1": {}, "user4": {}},
+		},
+	}
+
+	if !chat.Equal(expected) {
+		t.Errorf("got chat\n%+v\n want\n%+v", chat, expected)
+	}
+
+	chat, err = Get(ctx, db, "chat2")
+	if err != nil {
+		t.Fatalf("failed to get chat: %v", err)
+	}
+
+	if len(chat.ExcludeUsers)+len(chat.SkipUsers)+len(chat.WeekDays) > 0 {
+		t.Errorf("got not empty chat states %+v", chat)
+	}
+}
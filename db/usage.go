@@ -0,0 +1,59 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// dayLayout is a format of usage days.
+const dayLayout = time.DateOnly
+
+// Usage is a summary of AI commands usage.
+type Usage struct {
+	Requests int
+	Tokens   int
+}
+
+// SaveUsage adds a request with used tokens to the daily usage of the chat's user.
+// The day is taken from ts in UTC, so the user's usage has the same days in all chats.
+func SaveUsage(ctx context.Context, db *sql.DB, chatID, userID, provider string, ts time.Time, tokens int) error {
+	const query = "INSERT INTO `ai_usage` (`chat_id`, `user_id`, `provider`, `day`, `requests`, `tokens`) " +
+		"VALUES (?,?,?,?,1,?) " +
+		"ON CONFLICT(`chat_id`, `user_id`, `provider`, `day`) " +
+		"DO UPDATE SET `requests`=`requests`+1, `tokens`=`tokens`+`excluded`.`tokens`;"
+
+	if _, err := db.ExecContext(ctx, query, chatID, userID, provider, ts.UTC().Format(dayLayout), tokens); err != nil {
+		return fmt.Errorf("usage save exec: %w", err)
+	}
+
+	return nil
+}
+
+// ChatUsage returns the chat's usage of all providers starting from the UTC day of since.
+func ChatUsage(ctx context.Context, db *sql.DB, chatID string, since time.Time) (Usage, error) {
+	const query = "SELECT COALESCE(SUM(`requests`), 0), COALESCE(SUM(`tokens`), 0) FROM `ai_usage` " +
+		"WHERE `chat_id`=? AND `day`>=?;"
+
+	return queryUsage(ctx, db, query, chatID, since.UTC().Format(dayLayout))
+}
+
+// UserUsage returns the user's usage of all providers in all chats starting from the UTC day of since.
+func UserUsage(ctx context.Context, db *sql.DB, userID string, since time.Time) (Usage, error) {
+	const query = "SELECT COALESCE(SUM(`requests`), 0), COALESCE(SUM(`tokens`), 0) FROM `ai_usage` " +
+		"WHERE `user_id`=? AND `day`>=?;"
+
+	return queryUsage(ctx, db, query, userID, since.UTC().Format(dayLayout))
+}
+
+// queryUsage returns usage summary by the query.
+func queryUsage(ctx context.Context, db *sql.DB, query string, args ...any) (Usage, error) {
+	var u Usage
+
+	if err := db.QueryRowContext(ctx, query, args...).Scan(&u.Requests, &u.Tokens); err != nil {
+		return u, fmt.Errorf("usage scan: %w", err)
+	}
+
+	return u, nil
+}
@@ -0,0 +1,88 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestUsage(t *testing.T) {
+	const (
+		chatID = "TestUsage"
+		userID = "TestUsage@my.team"
+	)
+
+	db, err := open()
+	if err != nil {
+		t.Fatalf("failed to open database: %s", err)
+	}
+	defer func() {
+		if e := db.Close(); e != nil {
+			t.Errorf("failed to close database: %s", e)
+		}
+	}()
+
+	var (
+		ctx       = context.Background()
+		today     = time.Date(2024, 3, 15, 10, 0, 0, 0, time.UTC)
+		yesterday = today.AddDate(0, 0, -1)
+	)
+
+	items := []struct {
+		chatID   string
+		provider string
+		ts       time.Time
+		tokens   int
+	}{
+		{chatID: chatID, provider: "gpt", ts: today, tokens: 100},
+		{chatID: chatID, provider: "gpt", ts: today, tokens: 50},
+		{chatID: chatID, provider: "ds", ts: today, tokens: 10},
+		{chatID: chatID, provider: "gpt", ts: yesterday, tokens: 1000},
+		{chatID: "TestUsageOther", provider: "gpt", ts: today, tokens: 1},
+		// it's the next local day, but the same UTC one
+		{chatID: chatID, provider: "ds", ts: today.Add(12 * time.Hour).In(time.FixedZone("UTC+3", 3*3600))},
+	}
+
+	// previous runs' data
+	if _, err = db.ExecContext(ctx, "DELETE FROM `ai_usage` WHERE `user_id`=?;", userID); err != nil {
+		t.Fatalf("failed to clean usage: %s", err)
+	}
+
+	for _, item := range items {
+		if err = SaveUsage(ctx, db, item.chatID, userID, item.provider, item.ts, item.tokens); err != nil {
+			t.Fatalf("failed to save usage: %s", err)
+		}
+	}
+
+	testCases := []struct {
+		name     string
+		value    string
+		since    time.Time
+		expected Usage
+	}{
+		{name: "chat_today", value: chatID, since: today, expected: Usage{Requests: 4, Tokens: 160}},
+		{name: "chat_month", value: chatID, since: today.AddDate(0, 0, -14), expected: Usage{Requests: 5, Tokens: 1160}},
+		{name: "user_today", value: userID, since: today, expected: Usage{Requests: 5, Tokens: 161}},
+		{name: "unknown_chat", value: "TestUsageUnknown", since: today},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var u Usage
+
+			if tc.value == userID {
+				u, err = UserUsage(ctx, db, tc.value, tc.since)
+			} else {
+				u, err = ChatUsage(ctx, db, tc.value, tc.since)
+			}
+
+			if err != nil {
+				t.Fatalf("failed to get usage: %s", err)
+			}
+
+			if u != tc.expected {
+				t.Errorf("failed usage %+v, expected %+v", u, tc.expected)
+			}
+		})
+	}
+}
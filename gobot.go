@@ -12,6 +12,9 @@ import (
 	_ "time/tzdata"
 
 	"github.com/z0rr0/gobot/config"
+	"github.com/z0rr0/gobot/db"
+	"github.com/z0rr0/gobot/schedule"
+	"github.com/z0rr0/gobot/scheduler"
 	"github.com/z0rr0/gobot/serve"
 	"github.com/z0rr0/gobot/skip"
 )
@@ -44,6 +47,8 @@ func main() {
 	}()
 	version := flag.Bool("version", false, "show version")
 	cfg := flag.String("config", configFile, "configuration file")
+	migrateOnly := flag.Bool("migrate-only", false, "apply database migrations and exit")
+	console := flag.Bool("console", false, "read commands of a fake chat from stdin and print bot replies to stdout")
 	flag.Parse()
 
 	versionInfo := fmt.Sprintf("%v: %v %v %v %v", Name, Version, Revision, GoVersion, BuildDate)
@@ -53,7 +58,7 @@ func main() {
 		return
 	}
 	buildInfo := &config.BuildInfo{Name: Name, Hash: Version, Revision: Revision, GoVersion: GoVersion, Date: BuildDate}
-	c, err := config.New(*cfg, buildInfo, nil)
+	c, err := newConfig(*cfg, buildInfo, *console)
 	if err != nil {
 		panic(err)
 	}
@@ -61,7 +66,19 @@ func main() {
 		// custom logging in a file
 		logInfo.SetOutput(c.L.Output)
 		logError.SetOutput(c.L.Output)
+	} else if *console {
+		// stdout is used for bot replies
+		logInfo.SetOutput(os.Stderr)
 	}
+	if *migrateOnly {
+		migrate(c)
+		return
+	}
+	if *console {
+		runConsole(c)
+		return
+	}
+
 	logInfo.Printf("start process \n%v\n\nPID file: %s\nLOG file: %s", versionInfo, c.L.PidFile, c.L.LogFile)
 
 	sigint := make(chan os.Signal, 1)
@@ -69,14 +86,56 @@ func main() {
 	defer close(sigint)
 
 	p, stop := serve.New(c.M.Workers)
-	skipHandler := skip.New(c, stop, logInfo, logError)
+	jobs := append(skip.Jobs(c, logError), schedule.Job(c, logInfo, logError))
+	sch, err := scheduler.New(c, stop, logInfo, logError, jobs...)
+	if err != nil {
+		panic(err)
+	}
 	serve.Run(c, p, sigint, logInfo, logError)
 
 	<-stop
-	<-skipHandler.Stop
+	<-sch.Stop
 
 	logInfo.Printf("stopped %s", Name)
 	if err = c.Close(); err != nil {
 		log.Fatalf("can't close config: %v", err)
 	}
 }
+
+// newConfig returns configuration with the configured messenger or the console one.
+func newConfig(fileName string, buildInfo *config.BuildInfo, console bool) (*config.Config, error) {
+	if console {
+		return config.NewConsole(fileName, buildInfo, os.Stdin, os.Stdout)
+	}
+
+	return config.New(fileName, buildInfo, nil)
+}
+
+// runConsole handles commands from stdin until its end and closes configuration.
+// Scheduler jobs are not started in this mode.
+func runConsole(c *config.Config) {
+	logInfo.Printf("console mode, chat=%q user=%q, send /start to allow bot messages", c.C.ChatID, c.C.UserID)
+	serve.Console(c, logInfo, logError)
+
+	if err := c.Close(); err != nil {
+		log.Fatalf("can't close config: %v", err)
+	}
+}
+
+// migrate logs current database schema version and closes configuration.
+// Pending migrations are already applied by config.New.
+func migrate(c *config.Config) {
+	ctx, cancel := c.Context()
+	defer cancel()
+
+	version, err := db.Version(ctx, c.DB)
+	if err != nil {
+		logError.Printf("failed to get schema version: %v", err)
+	} else {
+		logInfo.Printf("database schema version %d", version)
+	}
+
+	if err = c.Close(); err != nil {
+		log.Fatalf("can't close config: %v", err)
+	}
+}
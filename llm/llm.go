@@ -0,0 +1,280 @@
+// Package llm contains large language model providers with a common interface.
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Roles of conversation messages.
+const (
+	RoleSystem    = "system"
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+)
+
+// Types of providers' API.
+const (
+	TypeOpenAI = "openai"
+	TypeYandex = "yandex"
+)
+
+// stopMarker is added to a response if it was truncated by the tokens limit.
+const stopMarker = "...."
+
+var (
+	// ErrResponse is an error of provider's API response.
+	ErrResponse = errors.New("llm response error")
+
+	// ErrTransient is a response error which can disappear after a retry, e.g. rate limit or server error.
+	ErrTransient = fmt.Errorf("%w: transient", ErrResponse)
+
+	// nameRegexp is a regexp of valid provider names.
+	nameRegexp = regexp.MustCompile(`^[a-z0-9_-]+$`)
+)
+
+// Message is a conversation message.
+type Message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// Response is a completion result.
+type Response struct {
+	Text   string
+	Tokens int // total number of used tokens, zero value if the provider doesn't report it
+}
+
+// Options are completion parameters, zero values mean provider's defaults.
+type Options struct {
+	Model       string
+	MaxTokens   int
+	Temperature *float32
+}
+
+// Merge returns options with zero values replaced by defaults.
+func (o Options) Merge(defaults Options) Options {
+	if o.Model == "" {
+		o.Model = defaults.Model
+	}
+
+	if o.MaxTokens < 1 {
+		o.MaxTokens = defaults.MaxTokens
+	}
+
+	if o.Temperature == nil {
+		o.Temperature = defaults.Temperature
+	}
+
+	return o
+}
+
+// Provider is a common interface of LLM API.
+type Provider interface {
+	// Name returns a unique provider name.
+	Name() string
+	// Models returns available models, the first one is the default.
+	Models() []string
+	// Defaults returns default completion options.
+	Defaults() Options
+	// Limits returns maximum values of completion options, zero MaxTokens means no limit.
+	Limits() Options
+	// Complete returns a response for the conversation messages.
+	Complete(ctx context.Context, messages []Message, options Options) (*Response, error)
+}
+
+// Streamer is an optional interface of providers which can stream responses.
+type Streamer interface {
+	Provider
+	// Streaming returns true if streamed responses are enabled.
+	Streaming() bool
+	// Stream returns a response for the conversation messages,
+	// onText is called with the accumulated text after every received part.
+	Stream(ctx context.Context, messages []Message, options Options, onText func(text string) error) (*Response, error)
+}
+
+// AsStreamer returns the provider as Streamer if it supports streamed responses and they are enabled.
+func AsStreamer(p Provider) (Streamer, bool) {
+	s, ok := p.(Streamer)
+	return s, ok && s.Streaming()
+}
+
+// Config is a provider configuration settings.
+type Config struct {
+	Name           string   `toml:"name"`
+	Type           string   `toml:"type"` // API type: "openai" (default) or "yandex"
+	URL            string   `toml:"url"`
+	Token          string   `toml:"token"`
+	Organization   string   `toml:"organization"`
+	Models         []string `toml:"models"`
+	MaxTokens      int      `toml:"max_tokens"`
+	Temperature    *float32 `toml:"temperature"`
+	MaxTemperature float32  `toml:"max_temperature"` // limit of chats' temperature, zero value means API maximum
+	Proxy          string   `toml:"proxy"`
+	Stream         bool     `toml:"stream"`  // stream responses, only OpenAI compatible API supports it
+	Timeout        int      `toml:"timeout"` // timeout of one request (seconds) including the response reading, zero means no limit
+}
+
+// Check returns an error if the options are not allowed by the provider.
+// Zero values are always allowed, they mean defaults.
+func Check(p Provider, o Options) error {
+	limits := p.Limits()
+
+	if o.Model != "" && !slices.Contains(p.Models(), o.Model) {
+		return fmt.Errorf("unknown model %q, use: %s", o.Model, strings.Join(p.Models(), ", "))
+	}
+
+	if o.MaxTokens < 0 {
+		return errors.New("max tokens must be positive")
+	}
+
+	if limits.MaxTokens > 0 && o.MaxTokens > limits.MaxTokens {
+		return fmt.Errorf("max tokens must be from 1 to %d", limits.MaxTokens)
+	}
+
+	if t := o.Temperature; t != nil {
+		if limits.Temperature == nil && *t < 0 {
+			return errors.New("temperature must not be negative")
+		}
+
+		if limits.Temperature != nil && (*t < 0 || *t > *limits.Temperature) {
+			return fmt.Errorf("temperature must be from 0 to %g", *limits.Temperature)
+		}
+	}
+
+	return nil
+}
+
+// limits returns options limits of the configuration with API maximum temperature.
+func (cfg *Config) limits(maxTemperature float32) Options {
+	if cfg.MaxTemperature > 0 && cfg.MaxTemperature < maxTemperature {
+		maxTemperature = cfg.MaxTemperature
+	}
+
+	return Options{MaxTokens: cfg.MaxTokens, Temperature: &maxTemperature}
+}
+
+// statusError returns a base error of the response status,
+// too many requests and server errors are transient.
+func statusError(status int) error {
+	if status == http.StatusTooManyRequests || status >= http.StatusInternalServerError {
+		return ErrTransient
+	}
+
+	return ErrResponse
+}
+
+// IsTransient returns true if the error can disappear after a retry.
+// They are transient response errors and network timeouts.
+func IsTransient(err error) bool {
+	var netErr net.Error
+
+	if errors.Is(err, ErrTransient) {
+		return true
+	}
+
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// Retry calls f until it succeeds or returns not transient error, but not more than attempts times.
+// The delay between attempts is doubled after every retry.
+func Retry(ctx context.Context, attempts int, delay time.Duration, f func() error) error {
+	var err error
+
+	for i := 0; i < max(attempts, 1); i++ {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				return errors.Join(err, ctx.Err())
+			case <-time.After(delay):
+				delay *= 2
+			}
+		}
+
+		if err = f(); err == nil || !IsTransient(err) || ctx.Err() != nil {
+			return err
+		}
+	}
+
+	return err
+}
+
+// New returns a new provider by its configuration.
+func New(cfg Config, client *http.Client) (Provider, error) {
+	if !nameRegexp.MatchString(cfg.Name) {
+		return nil, fmt.Errorf("invalid provider name %q", cfg.Name)
+	}
+
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("provider %q has no url", cfg.Name)
+	}
+
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	switch cfg.Type {
+	case "", TypeOpenAI:
+		if len(cfg.Models) == 0 {
+			return nil, fmt.Errorf("provider %q has no models", cfg.Name)
+		}
+		if err := checkModels(cfg); err != nil {
+			return nil, err
+		}
+		return &OpenAI{cfg: cfg, client: client}, nil
+	case TypeYandex:
+		return &Yandex{cfg: cfg, client: client}, nil
+	default:
+		return nil, fmt.Errorf("provider %q has unknown type %q", cfg.Name, cfg.Type)
+	}
+}
+
+// Registry is a set of providers with unique names.
+type Registry struct {
+	names     []string
+	providers map[string]Provider
+}
+
+// NewRegistry returns a new registry of the providers.
+func NewRegistry(providers ...Provider) (*Registry, error) {
+	r := &Registry{names: make([]string, 0, len(providers)), providers: make(map[string]Provider, len(providers))}
+
+	for _, p := range providers {
+		name := p.Name()
+
+		if _, ok := r.providers[name]; ok {
+			return nil, fmt.Errorf("duplicate provider name %q", name)
+		}
+
+		r.names = append(r.names, name)
+		r.providers[name] = p
+	}
+
+	return r, nil
+}
+
+// Get returns a provider by its name.
+func (r *Registry) Get(name string) (Provider, bool) {
+	if r == nil {
+		return nil, false
+	}
+
+	p, ok := r.providers[name]
+	return p, ok
+}
+
+// Names returns providers' names in the registration order.
+func (r *Registry) Names() []string {
+	if r == nil {
+		return nil
+	}
+
+	return slices.Clone(r.names)
+}
@@ -0,0 +1,418 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/z0rr0/aoapi"
+)
+
+func TestNew(t *testing.T) {
+	testCases := []struct {
+		name string
+		cfg  Config
+		err  bool
+	}{
+		{name: "openai", cfg: Config{Name: "gpt", URL: "http://localhost", Models: []string{"gpt-4o-mini"}}},
+		{name: "yandex", cfg: Config{Name: "ygpt", Type: TypeYandex, URL: "http://localhost"}},
+		{name: "bad_name", cfg: Config{Name: "Chat GPT", URL: "http://localhost", Models: []string{"gpt-4o-mini"}}, err: true},
+		{name: "no_url", cfg: Config{Name: "gpt", Models: []string{"gpt-4o-mini"}}, err: true},
+		{name: "unknown_model", cfg: Config{Name: "local", URL: "http://localhost", Models: []string{"llama"}}, err: true},
+		{
+			name: "model_max_tokens",
+			cfg:  Config{Name: "gpt", URL: "http://localhost", Models: []string{"gpt-4o-mini"}, MaxTokens: 5000},
+			err:  true,
+		},
+		{name: "no_models", cfg: Config{Name: "local", URL: "http://localhost"}, err: true},
+		{name: "bad_type", cfg: Config{Name: "local", Type: "other", URL: "http://localhost"}, err: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			p, err := New(tc.cfg, nil)
+			if tc.err {
+				if err == nil {
+					t.Error("expected error")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if name := p.Name(); name != tc.cfg.Name {
+				t.Errorf("failed name %q", name)
+			}
+		})
+	}
+}
+
+func TestNewRegistry(t *testing.T) {
+	var providers []Provider
+
+	for _, name := range []string{"gpt", "local", "gpt"} {
+		p, err := New(Config{Name: name, URL: "http://localhost", Models: []string{"gpt-4o-mini"}}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		providers = append(providers, p)
+	}
+
+	if _, err := NewRegistry(providers...); err == nil {
+		t.Error("expected duplicate error")
+	}
+
+	r, err := NewRegistry(providers[:2]...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if names := r.Names(); !slices.Equal(names, []string{"gpt", "local"}) {
+		t.Errorf("failed names %v", names)
+	}
+
+	if _, ok := r.Get("local"); !ok {
+		t.Error("provider not found")
+	}
+
+	if _, ok := r.Get("unknown"); ok {
+		t.Error("unexpected provider")
+	}
+
+	var nilRegistry *Registry
+	if _, ok := nilRegistry.Get("gpt"); ok || nilRegistry.Names() != nil {
+		t.Error("unexpected provider of nil registry")
+	}
+}
+
+// limitsProvider is a provider without any limits of options.
+type limitsProvider struct {
+	Provider
+}
+
+// Limits returns no limits.
+func (p *limitsProvider) Limits() Options {
+	return Options{}
+}
+
+func TestCheck(t *testing.T) {
+	var (
+		low  = float32(0.5)
+		high = float32(1.5)
+		bad  = float32(-1)
+	)
+
+	cfg := Config{Name: "gpt", URL: "http://localhost", Models: []string{"gpt-4o-mini", "gpt-4o"}, MaxTokens: 100}
+	openAI, err := New(cfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	yandex, err := New(Config{Name: "ygpt", Type: TypeYandex, URL: "http://localhost"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unlimited := &limitsProvider{Provider: openAI}
+
+	testCases := []struct {
+		name     string
+		provider Provider
+		options  Options
+		err      bool
+	}{
+		{name: "defaults", provider: openAI},
+		{name: "valid", provider: openAI, options: Options{Model: "gpt-4o", MaxTokens: 100, Temperature: &high}},
+		{name: "unknown_model", provider: openAI, options: Options{Model: "gpt-4"}, err: true},
+		{name: "max_tokens", provider: openAI, options: Options{MaxTokens: 101}, err: true},
+		{name: "negative_temperature", provider: openAI, options: Options{Temperature: &bad}, err: true},
+		{name: "yandex_valid", provider: yandex, options: Options{Model: "general", MaxTokens: 2000, Temperature: &low}},
+		{name: "yandex_temperature", provider: yandex, options: Options{Temperature: &high}, err: true},
+		{name: "yandex_max_tokens", provider: yandex, options: Options{MaxTokens: 2001}, err: true},
+		{name: "no_temperature_limit", provider: unlimited, options: Options{Temperature: &high}},
+		{name: "no_temperature_limit_negative", provider: unlimited, options: Options{Temperature: &bad}, err: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err = Check(tc.provider, tc.options); (err != nil) != tc.err {
+				t.Errorf("failed check error: %v", err)
+			}
+		})
+	}
+}
+
+func TestRetry(t *testing.T) {
+	var (
+		ctx          = context.Background()
+		errPermanent = errors.New("permanent")
+		errTimeout   = &net.DNSError{Err: "timeout", IsTimeout: true}
+	)
+
+	testCases := []struct {
+		name     string
+		errs     []error
+		attempts int
+		calls    int
+		err      error
+	}{
+		{name: "success", attempts: 3, calls: 1},
+		{name: "transient", errs: []error{ErrTransient, errTimeout}, attempts: 3, calls: 3},
+		{name: "exhausted", errs: []error{ErrTransient, ErrTransient, ErrTransient}, attempts: 2, calls: 2, err: ErrTransient},
+		{name: "permanent", errs: []error{ErrTransient, errPermanent}, attempts: 3, calls: 2, err: errPermanent},
+		{name: "one_attempt", errs: []error{ErrTransient}, attempts: 0, calls: 1, err: ErrTransient},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var calls int
+
+			err := Retry(ctx, tc.attempts, time.Millisecond, func() error {
+				calls++
+				if calls <= len(tc.errs) {
+					return tc.errs[calls-1]
+				}
+				return nil
+			})
+
+			if !errors.Is(err, tc.err) || (tc.err == nil && err != nil) {
+				t.Errorf("failed error %v, want %v", err, tc.err)
+			}
+
+			if calls != tc.calls {
+				t.Errorf("failed calls %d, want %d", calls, tc.calls)
+			}
+		})
+	}
+}
+
+func TestOpenAI_Complete(t *testing.T) {
+	var request aoapi.CompletionRequest
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "Bearer limited" {
+			w.WriteHeader(http.StatusTooManyRequests)
+			_, _ = fmt.Fprint(w, `{"error":{"message":"rate limit","type":"requests"}}`)
+			return
+		}
+
+		if auth := r.Header.Get("Authorization"); auth != "Bearer test" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = fmt.Fprint(w, `{"error":{"message":"bad token","type":"auth"}}`)
+			return
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Error(err)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		response := `{"choices":[{"index":0,"message":{"role":"assistant","content":"answer"},"finish_reason":"length"}],` +
+			`"usage":{"prompt_tokens":20,"completion_tokens":10,"total_tokens":30}}`
+		if _, err := fmt.Fprint(w, response); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer server.Close()
+
+	temperature := float32(0.5)
+	cfg := Config{
+		Name:        "gpt",
+		URL:         server.URL,
+		Token:       "test",
+		Models:      []string{"gpt-4o-mini", "gpt-4o"},
+		MaxTokens:   100,
+		Temperature: &temperature,
+	}
+
+	p, err := New(cfg, server.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	messages := []Message{{Role: RoleSystem, Content: "be short"}, {Role: RoleUser, Content: "question"}}
+
+	result, err := p.Complete(ctx, messages, Options{Model: "gpt-4o"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Text != "answer"+stopMarker || result.Tokens != 30 {
+		t.Errorf("failed result %+v", result)
+	}
+
+	if request.Model != aoapi.ModelGPT4o || request.MaxTokens != 100 || *request.Temperature != temperature {
+		t.Errorf("failed request options %+v", request)
+	}
+
+	expected := []aoapi.Message{{Role: aoapi.RoleSystem, Content: "be short"}, {Role: aoapi.RoleUser, Content: "question"}}
+	if !slices.Equal(request.Messages, expected) {
+		t.Errorf("failed request messages %v", request.Messages)
+	}
+
+	cfg.Token = "bad"
+	if p, err = New(cfg, server.Client()); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = p.Complete(ctx, messages, Options{}); !errors.Is(err, ErrResponse) || IsTransient(err) {
+		t.Errorf("expected response error, got %v", err)
+	}
+
+	cfg.Token = "limited"
+	if p, err = New(cfg, server.Client()); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = p.Complete(ctx, messages, Options{}); !IsTransient(err) {
+		t.Errorf("expected transient error, got %v", err)
+	}
+}
+
+func TestOpenAI_Stream(t *testing.T) {
+	var request streamRequest
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Error(err)
+		}
+
+		if request.Model == aoapi.ModelGPT4o {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = fmt.Fprint(w, `{"error":{"message":"unknown model","type":"invalid_request_error"}}`)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		chunks := []string{
+			": keep-alive",
+			`data: {"choices":[{"index":0,"delta":{"role":"assistant","content":""}}]}`,
+			`data: {"choices":[{"index":0,"delta":{"content":"Hello"}}]}`,
+			`data: {"choices":[{"index":0,"delta":{"content":", world"},"finish_reason":"stop"}]}`,
+			`data: {"choices":[],"usage":{"prompt_tokens":5,"completion_tokens":3,"total_tokens":8}}`,
+			"data: [DONE]",
+		}
+
+		for _, chunk := range chunks {
+			if _, err := fmt.Fprintf(w, "%s\n\n", chunk); err != nil {
+				t.Error(err)
+			}
+			w.(http.Flusher).Flush()
+		}
+	}))
+	defer server.Close()
+
+	p, err := New(Config{Name: "gpt", URL: server.URL, Models: []string{"gpt-4o-mini", "gpt-4o"}, Stream: true}, server.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	streamer, ok := AsStreamer(p)
+	if !ok {
+		t.Fatal("streaming is not enabled")
+	}
+
+	var (
+		ctx      = context.Background()
+		messages = []Message{{Role: RoleUser, Content: "question"}}
+		texts    []string
+	)
+
+	result, err := streamer.Stream(ctx, messages, Options{}, func(text string) error {
+		texts = append(texts, text)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Text != "Hello, world" || result.Tokens != 8 {
+		t.Errorf("failed result %+v", result)
+	}
+
+	if expected := []string{"Hello", "Hello, world"}; !slices.Equal(texts, expected) {
+		t.Errorf("failed texts %q, want %q", texts, expected)
+	}
+
+	if request.Stream == nil || !*request.Stream || request.StreamOptions == nil || !request.StreamOptions.IncludeUsage {
+		t.Errorf("failed request options %+v", request)
+	}
+
+	errStop := errors.New("stop")
+	_, err = streamer.Stream(ctx, messages, Options{}, func(string) error { return errStop })
+	if !errors.Is(err, errStop) {
+		t.Errorf("expected callback error, got %v", err)
+	}
+
+	if _, err = streamer.Stream(ctx, messages, Options{Model: "gpt-4o"}, nil); !errors.Is(err, ErrResponse) {
+		t.Errorf("expected response error, got %v", err)
+	}
+
+	if p, err = New(Config{Name: "gpt", URL: server.URL, Models: []string{"gpt-4o-mini"}}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok = AsStreamer(p); ok {
+		t.Error("streaming is not enabled by configuration")
+	}
+}
+
+func TestYandex_Complete(t *testing.T) {
+	var request map[string]any
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Error(err)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		response := `{"result":{"message":{"role":"Ассистент","text":"Меня зовут Алиса"},"num_tokens":"20"}}`
+		if _, err := fmt.Fprint(w, response); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer server.Close()
+
+	p, err := New(Config{Name: "ygpt", Type: TypeYandex, URL: server.URL, Token: "test"}, server.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if defaults := p.Defaults(); defaults.Model != "general" || defaults.MaxTokens != yandexMaxTokens {
+		t.Errorf("failed defaults %+v", defaults)
+	}
+
+	messages := []Message{
+		{Role: RoleSystem, Content: "be short"},
+		{Role: RoleUser, Content: "question"},
+		{Role: RoleAssistant, Content: "answer"},
+		{Role: RoleUser, Content: "name"},
+	}
+
+	result, err := p.Complete(context.Background(), messages, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Text != "Меня зовут Алиса" || result.Tokens != 20 {
+		t.Errorf("failed result %+v", result)
+	}
+
+	if instruction := request["instructionText"]; instruction != "be short" {
+		t.Errorf("failed instruction %v", instruction)
+	}
+
+	if items, ok := request["messages"].([]any); !ok || len(items) != 3 {
+		t.Errorf("failed messages %v", request["messages"])
+	}
+}
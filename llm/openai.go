@@ -0,0 +1,308 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/z0rr0/aoapi"
+)
+
+// openAIMaxTemperature is a maximum temperature of OpenAI compatible API.
+const openAIMaxTemperature = 2
+
+// OpenAI is a provider of OpenAI compatible chat completions API, it can be used for ChatGPT, DeepSeek and others.
+// Completions are requested by aoapi client, so only models which are known by aoapi are allowed.
+type OpenAI struct {
+	cfg    Config
+	client *http.Client
+}
+
+// streamRequest is a request of streamed chat completions API, aoapi doesn't support streaming.
+type streamRequest struct {
+	*aoapi.CompletionRequest
+	StreamOptions *streamOptions `json:"stream_options,omitempty"`
+}
+
+// streamOptions are options of streamed completions.
+type streamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+// apiError is an error of chat completions API.
+type apiError struct {
+	Message string `json:"message"`
+	Type    string `json:"type"`
+}
+
+// completionUsage is a usage of chat completions API.
+type completionUsage struct {
+	TotalTokens int `json:"total_tokens"`
+}
+
+// streamChunk is a server-sent event of streamed chat completions API.
+type streamChunk struct {
+	Choices []struct {
+		Delta        Message `json:"delta"`
+		FinishReason string  `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *completionUsage `json:"usage"`
+	Error *apiError        `json:"error"`
+}
+
+// statusTransport remembers a response status of aoapi request, aoapi errors don't contain it,
+// but it's needed to detect transient errors.
+type statusTransport struct {
+	base   http.RoundTripper
+	status int
+}
+
+// RoundTrip implements http.RoundTripper interface.
+func (t *statusTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	resp, err := base.RoundTrip(req)
+	if err == nil {
+		t.status = resp.StatusCode
+	}
+
+	return resp, err
+}
+
+// checkModels returns an error if some model is not known by aoapi or its tokens limit is less than maximum.
+func checkModels(cfg Config) error {
+	for _, model := range cfg.Models {
+		limit, ok := aoapi.TokenLimits[aoapi.Model(model)]
+		if !ok {
+			return fmt.Errorf("provider %q has unsupported model %q", cfg.Name, model)
+		}
+
+		if cfg.MaxTokens > int(limit) {
+			return fmt.Errorf("provider %q max tokens must not exceed %d for model %q", cfg.Name, limit, model)
+		}
+	}
+
+	return nil
+}
+
+// Name returns the provider name.
+func (p *OpenAI) Name() string {
+	return p.cfg.Name
+}
+
+// Models returns the provider models.
+func (p *OpenAI) Models() []string {
+	return p.cfg.Models
+}
+
+// Defaults returns default completion options.
+func (p *OpenAI) Defaults() Options {
+	return Options{Model: p.cfg.Models[0], MaxTokens: p.cfg.MaxTokens, Temperature: p.cfg.Temperature}
+}
+
+// Limits returns maximum values of completion options.
+func (p *OpenAI) Limits() Options {
+	return p.cfg.limits(openAIMaxTemperature)
+}
+
+// Streaming returns true if streamed completions are enabled by the configuration.
+func (p *OpenAI) Streaming() bool {
+	return p.cfg.Stream
+}
+
+// Complete returns a response for the conversation messages.
+func (p *OpenAI) Complete(ctx context.Context, messages []Message, options Options) (*Response, error) {
+	transport := &statusTransport{base: p.client.Transport}
+	client := *p.client
+	client.Transport = transport
+
+	resp, err := aoapi.Completion(ctx, &client, p.request(messages, options), p.params())
+	if err != nil {
+		switch {
+		case transport.status != 0 && transport.status != http.StatusOK:
+			return nil, fmt.Errorf("%w: %s status=%d: %w", statusError(transport.status), p.cfg.Name, transport.status, err)
+		case errors.Is(err, aoapi.ErrResponse):
+			return nil, fmt.Errorf("%w: %s: %w", ErrResponse, p.cfg.Name, err)
+		default:
+			return nil, fmt.Errorf("%s completion: %w", p.cfg.Name, err)
+		}
+	}
+
+	return &Response{Text: resp.String(), Tokens: int(resp.Usage.TotalTokens)}, nil
+}
+
+// Stream returns a response for the conversation messages reading server-sent events of the API,
+// onText is called with the accumulated text after every received chunk.
+func (p *OpenAI) Stream(ctx context.Context, messages []Message, options Options, onText func(string) error) (*Response, error) {
+	stream := true
+	request := p.request(messages, options)
+	request.Stream = &stream
+
+	resp, err := p.do(ctx, &streamRequest{CompletionRequest: request, StreamOptions: &streamOptions{IncludeUsage: true}})
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		respErr := &aoapi.ResponseError{}
+
+		if err = json.Unmarshal(body, respErr); err == nil && respErr.E.Message != "" {
+			return nil, p.responseError(resp.StatusCode, &apiError{Message: respErr.E.Message, Type: respErr.E.Type})
+		}
+
+		return nil, p.bodyError(resp.StatusCode, body)
+	}
+
+	var (
+		builder  strings.Builder
+		tokens   int
+		finished bool
+		scanner  = bufio.NewScanner(resp.Body)
+	)
+
+	// a chunk can be longer than the default token size of the scanner
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data:")
+		if !ok {
+			// empty lines, comments and other fields of events
+			continue
+		}
+
+		data = strings.TrimSpace(data)
+		if data == "[DONE]" {
+			finished = true
+			break
+		}
+
+		chunk := &streamChunk{}
+		if err = json.Unmarshal([]byte(data), chunk); err != nil {
+			return nil, fmt.Errorf("%w: %s chunk: %s", ErrResponse, p.cfg.Name, truncate([]byte(data)))
+		}
+
+		if chunk.Error != nil {
+			return nil, p.responseError(resp.StatusCode, chunk.Error)
+		}
+
+		if chunk.Usage != nil {
+			tokens = chunk.Usage.TotalTokens
+		}
+
+		var changed bool
+		for _, choice := range chunk.Choices {
+			if choice.Delta.Content != "" {
+				builder.WriteString(choice.Delta.Content)
+				changed = true
+			}
+
+			if choice.FinishReason == "length" {
+				builder.WriteString(stopMarker)
+				changed = true
+			}
+		}
+
+		if changed && onText != nil {
+			if err = onText(builder.String()); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err = scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%s stream: %w", p.cfg.Name, err)
+	}
+
+	if !finished && builder.Len() == 0 {
+		return nil, fmt.Errorf("%w: %s empty stream", ErrResponse, p.cfg.Name)
+	}
+
+	return &Response{Text: builder.String(), Tokens: tokens}, nil
+}
+
+// request returns a chat completions request with the options merged to the defaults.
+func (p *OpenAI) request(messages []Message, options Options) *aoapi.CompletionRequest {
+	options = options.Merge(p.Defaults())
+	request := &aoapi.CompletionRequest{
+		Model:       aoapi.Model(options.Model),
+		Messages:    make([]aoapi.Message, len(messages)),
+		MaxTokens:   uint(max(options.MaxTokens, 0)),
+		Temperature: options.Temperature,
+	}
+
+	for i, m := range messages {
+		request.Messages[i] = aoapi.Message{Role: aoapi.Role(m.Role), Content: m.Content}
+	}
+
+	return request
+}
+
+// params returns aoapi parameters of the provider.
+func (p *OpenAI) params() aoapi.Params {
+	return aoapi.Params{Bearer: p.cfg.Token, Organization: p.cfg.Organization, URL: p.cfg.URL, StopMarker: stopMarker}
+}
+
+// do sends the streamed request to the API, a caller must close the response body.
+func (p *OpenAI) do(ctx context.Context, request *streamRequest) (*http.Response, error) {
+	data, err := json.Marshal(request)
+	if err != nil {
+		return nil, fmt.Errorf("%s marshal: %w", p.cfg.Name, err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.cfg.URL, bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s request: %w", p.cfg.Name, err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "text/event-stream")
+
+	if p.cfg.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+p.cfg.Token)
+	}
+
+	if p.cfg.Organization != "" {
+		req.Header.Set("OpenAI-Organization", p.cfg.Organization)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s completion: %w", p.cfg.Name, err)
+	}
+
+	return resp, nil
+}
+
+// responseError returns an error of the API error response.
+func (p *OpenAI) responseError(status int, e *apiError) error {
+	return fmt.Errorf("%w: %s status=%d, type=%q: %s", statusError(status), p.cfg.Name, status, e.Type, e.Message)
+}
+
+// bodyError returns an error of the response status with a short prefix of its body.
+func (p *OpenAI) bodyError(status int, body []byte) error {
+	return fmt.Errorf("%w: %s status=%d: %s", statusError(status), p.cfg.Name, status, truncate(body))
+}
+
+// truncate returns a short prefix of the response body for error messages.
+func truncate(body []byte) []byte {
+	const maxLength = 256
+
+	if len(body) > maxLength {
+		return body[:maxLength]
+	}
+
+	return body
+}
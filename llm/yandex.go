@@ -0,0 +1,125 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/z0rr0/tgtpgybot/ygpt"
+)
+
+const (
+	// yandexMaxTokens is a default maximum number of tokens of Yandex GPT generation.
+	yandexMaxTokens = 2000
+	// yandexMaxTemperature is a maximum temperature of Yandex GPT API.
+	yandexMaxTemperature = 1
+)
+
+// Yandex is a provider of Yandex GPT chat API.
+// ygpt.GenerationChat supports only one message, so the request is built here with the same format.
+type Yandex struct {
+	cfg    Config
+	client *http.Client
+}
+
+// Name returns the provider name.
+func (p *Yandex) Name() string {
+	return p.cfg.Name
+}
+
+// Models returns the provider models.
+func (p *Yandex) Models() []string {
+	if len(p.cfg.Models) == 0 {
+		return []string{string(ygpt.ModelGeneral)}
+	}
+
+	return p.cfg.Models
+}
+
+// Defaults returns default completion options.
+func (p *Yandex) Defaults() Options {
+	maxTokens := p.cfg.MaxTokens
+	if maxTokens < 1 {
+		maxTokens = yandexMaxTokens
+	}
+
+	return Options{Model: p.Models()[0], MaxTokens: maxTokens, Temperature: p.cfg.Temperature}
+}
+
+// Limits returns maximum values of completion options.
+func (p *Yandex) Limits() Options {
+	limits := p.cfg.limits(yandexMaxTemperature)
+	limits.MaxTokens = p.Defaults().MaxTokens
+	return limits
+}
+
+// Complete returns a response for the conversation messages.
+// System messages are joined to the instruction text.
+func (p *Yandex) Complete(ctx context.Context, messages []Message, options Options) (*Response, error) {
+	var instructions []string
+
+	options = options.Merge(p.Defaults())
+	chatData := &ygpt.TextGenerationChat{
+		Model:             ygpt.Model(options.Model),
+		GenerationOptions: ygpt.GenerationOptions{MaxTokens: int64(options.MaxTokens)},
+		Messages:          make([]ygpt.Message, 0, len(messages)),
+	}
+
+	if options.Temperature != nil {
+		chatData.GenerationOptions.Temperature = float64(*options.Temperature)
+	}
+
+	for _, m := range messages {
+		switch m.Role {
+		case RoleSystem:
+			instructions = append(instructions, m.Content)
+		case RoleAssistant:
+			chatData.Messages = append(chatData.Messages, ygpt.Message{Role: ygpt.RoleAssistant, Text: m.Content})
+		default:
+			chatData.Messages = append(chatData.Messages, ygpt.Message{Role: ygpt.RoleUser, Text: m.Content})
+		}
+	}
+
+	chatData.InstructionText = strings.Join(instructions, "\n")
+
+	data, err := json.Marshal(chatData)
+	if err != nil {
+		return nil, fmt.Errorf("%s marshal: %w", p.cfg.Name, err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.cfg.URL, bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s request: %w", p.cfg.Name, err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Authorization", "Api-Key "+p.cfg.Token)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s completion: %w", p.cfg.Name, err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 256))
+		return nil, fmt.Errorf("%w: %s status=%d: %s", statusError(resp.StatusCode), p.cfg.Name, resp.StatusCode, body)
+	}
+
+	response := &ygpt.ChatResponse{}
+	if err = json.NewDecoder(resp.Body).Decode(response); err != nil {
+		return nil, fmt.Errorf("%w: %s decode: %v", ErrResponse, p.cfg.Name, err)
+	}
+
+	// the number of tokens is a string value, it's ignored if it's invalid
+	tokens, _ := strconv.Atoi(response.Result.NumTokens)
+	return &Response{Text: response.String(), Tokens: tokens}, nil
+}
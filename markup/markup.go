@@ -0,0 +1,341 @@
+// Package markup prepares long texts for the messenger: it splits them into messages
+// and formats Markdown of AI answers to the messenger's parse modes.
+package markup
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// MaxLength is a maximum number of characters in a message.
+	MaxLength = 4096
+
+	// minRawLength is a minimal length of source text chunks, it stops splitting of too inflated formatted texts.
+	minRawLength = 16
+
+	// fence is a code block delimiter.
+	fence = "```"
+)
+
+// Mode is a format of messages.
+type Mode string
+
+// Available modes.
+const (
+	Plain    Mode = ""
+	Markdown Mode = "markdown"
+	HTML     Mode = "html"
+)
+
+// ParseMode is a formatting syntax of messages, messengers convert it to their own values.
+type ParseMode string
+
+// Parse modes of formatted modes, Markdown is escaped by MarkdownV2 rules.
+const (
+	ParseModeMarkdownV2 ParseMode = "MarkdownV2"
+	ParseModeHTML       ParseMode = "HTML"
+)
+
+var (
+	// inlineRegexp is a regexp of inline code and bold text.
+	inlineRegexp = regexp.MustCompile("`[^`\n]+`|\\*\\*[^*\n]+\\*\\*")
+
+	// markdownReplacer escapes special characters of MarkdownV2.
+	markdownReplacer = newEscapeReplacer("\\_*[]()~`>#+-=|{}.!")
+
+	// codeReplacer escapes special characters of MarkdownV2 code.
+	codeReplacer = newEscapeReplacer("\\`")
+
+	// htmlReplacer escapes special characters of HTML.
+	htmlReplacer = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+)
+
+// newEscapeReplacer returns a replacer which adds backslash before every of chars.
+func newEscapeReplacer(chars string) *strings.Replacer {
+	pairs := make([]string, 0, 2*len(chars))
+
+	for _, c := range chars {
+		pairs = append(pairs, string(c), "\\"+string(c))
+	}
+
+	return strings.NewReplacer(pairs...)
+}
+
+// Validate returns an error if the mode is unknown.
+func (m Mode) Validate() error {
+	switch m {
+	case Plain, Markdown, HTML:
+		return nil
+	default:
+		return fmt.Errorf("unknown markup mode %q, use: %q, %q or empty value", m, Markdown, HTML)
+	}
+}
+
+// ParseMode returns the parse mode of formatted messages, it's empty for plain text.
+func (m Mode) ParseMode() ParseMode {
+	switch m {
+	case Markdown:
+		return ParseModeMarkdownV2
+	case HTML:
+		return ParseModeHTML
+	default:
+		return ""
+	}
+}
+
+// Prepare splits the text into formatted messages, every of them is not longer than limit.
+func Prepare(text string, mode Mode, limit int) []string {
+	return prepare(text, mode, limit, limit)
+}
+
+// prepare splits the text into chunks not longer than rawLimit and formats them,
+// chunks which are too long after formatting are split again with a smaller limit.
+func prepare(text string, mode Mode, limit, rawLimit int) []string {
+	var result []string
+
+	for _, chunk := range Split(text, rawLimit) {
+		formatted := Format(chunk, mode)
+
+		if rawLimit > minRawLength && utf8.RuneCountInString(formatted) > limit {
+			result = append(result, prepare(chunk, mode, limit, rawLimit/2)...)
+			continue
+		}
+
+		result = append(result, formatted)
+	}
+
+	return result
+}
+
+// Split splits the text into chunks not longer than limit.
+// It prefers paragraph boundaries and doesn't break code blocks,
+// a too long code block is split by lines and every part gets own fences.
+func Split(text string, limit int) []string {
+	if utf8.RuneCountInString(text) <= limit {
+		return []string{text}
+	}
+
+	var items []string
+	for _, b := range parseBlocks(text) {
+		items = append(items, b.split(limit)...)
+	}
+
+	return pack(items, "\n\n", limit)
+}
+
+// Format converts Markdown of the text to the mode with escaping of special characters.
+// Code blocks, inline code and bold text are kept, other text is escaped.
+func Format(text string, mode Mode) string {
+	if mode == Plain {
+		return text
+	}
+
+	blocks := parseBlocks(text)
+	result := make([]string, len(blocks))
+
+	for i, b := range blocks {
+		if b.code {
+			result[i] = b.format(mode)
+		} else {
+			result[i] = formatInline(b.String(), mode)
+		}
+	}
+
+	return strings.Join(result, "\n\n")
+}
+
+// formatInline formats a text paragraph with inline code and bold text.
+func formatInline(text string, mode Mode) string {
+	var (
+		builder strings.Builder
+		start   int
+	)
+
+	for _, loc := range inlineRegexp.FindAllStringIndex(text, -1) {
+		builder.WriteString(escape(text[start:loc[0]], mode))
+
+		item := text[loc[0]:loc[1]]
+		if strings.HasPrefix(item, "`") {
+			builder.WriteString(formatCode(item[1:len(item)-1], mode))
+		} else {
+			builder.WriteString(formatBold(item[2:len(item)-2], mode))
+		}
+
+		start = loc[1]
+	}
+
+	builder.WriteString(escape(text[start:], mode))
+	return builder.String()
+}
+
+// escape escapes special characters of the mode.
+func escape(text string, mode Mode) string {
+	if mode == HTML {
+		return htmlReplacer.Replace(text)
+	}
+
+	return markdownReplacer.Replace(text)
+}
+
+// formatCode returns inline code of the mode.
+func formatCode(text string, mode Mode) string {
+	if mode == HTML {
+		return "<code>" + htmlReplacer.Replace(text) + "</code>"
+	}
+
+	return "`" + codeReplacer.Replace(text) + "`"
+}
+
+// formatBold returns bold text of the mode.
+func formatBold(text string, mode Mode) string {
+	if mode == HTML {
+		return "<b>" + htmlReplacer.Replace(text) + "</b>"
+	}
+
+	return "*" + markdownReplacer.Replace(text) + "*"
+}
+
+// block is a paragraph of text or a code block.
+type block struct {
+	lines []string
+	code  bool
+}
+
+// parseBlocks splits the text into paragraphs by empty lines and code blocks.
+func parseBlocks(text string) []block {
+	var (
+		blocks  []block
+		current block
+	)
+
+	flush := func() {
+		if len(current.lines) > 0 {
+			blocks = append(blocks, current)
+		}
+		current = block{}
+	}
+
+	for _, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+
+		switch {
+		case current.code:
+			current.lines = append(current.lines, line)
+			if strings.HasPrefix(trimmed, fence) {
+				flush()
+			}
+		case strings.HasPrefix(trimmed, fence):
+			flush()
+			current = block{lines: []string{line}, code: true}
+		case trimmed == "":
+			flush()
+		default:
+			current.lines = append(current.lines, line)
+		}
+	}
+
+	flush()
+	return blocks
+}
+
+// String returns the block text.
+func (b *block) String() string {
+	return strings.Join(b.lines, "\n")
+}
+
+// header returns the opening fence line and the code lines of the code block.
+func (b *block) header() (string, []string) {
+	opening, lines := strings.TrimSpace(b.lines[0]), b.lines[1:]
+
+	if n := len(lines); n > 0 && strings.HasPrefix(strings.TrimSpace(lines[n-1]), fence) {
+		lines = lines[:n-1]
+	}
+
+	return opening, lines
+}
+
+// split returns parts of the block which are not longer than limit.
+func (b *block) split(limit int) []string {
+	text := b.String()
+	if utf8.RuneCountInString(text) <= limit {
+		return []string{text}
+	}
+
+	if !b.code {
+		return pack(b.lines, "\n", limit)
+	}
+
+	opening, lines := b.header()
+	overhead := utf8.RuneCountInString(opening) + len(fence) + 2 // two new lines around the code
+	if limit-overhead < 1 {
+		return pack(b.lines, "\n", limit)
+	}
+
+	parts := pack(lines, "\n", limit-overhead)
+	for i, part := range parts {
+		parts[i] = opening + "\n" + part + "\n" + fence
+	}
+
+	return parts
+}
+
+// format returns the code block in the mode.
+func (b *block) format(mode Mode) string {
+	opening, lines := b.header()
+	code := strings.Join(lines, "\n")
+
+	if mode == HTML {
+		return "<pre>" + htmlReplacer.Replace(code) + "</pre>"
+	}
+
+	return opening + "\n" + codeReplacer.Replace(code) + "\n" + fence
+}
+
+// pack joins items by the separator into chunks not longer than limit, too long items are split by characters.
+func pack(items []string, sep string, limit int) []string {
+	var (
+		chunks    []string
+		current   string
+		started   bool
+		sepLength = utf8.RuneCountInString(sep)
+	)
+
+	for _, item := range items {
+		for _, part := range splitRunes(item, limit) {
+			switch {
+			case !started:
+				current, started = part, true
+			case utf8.RuneCountInString(current)+sepLength+utf8.RuneCountInString(part) <= limit:
+				current += sep + part
+			default:
+				chunks = append(chunks, current)
+				current = part
+			}
+		}
+	}
+
+	if started {
+		chunks = append(chunks, current)
+	}
+
+	return chunks
+}
+
+// splitRunes splits the text into parts not longer than limit characters.
+func splitRunes(text string, limit int) []string {
+	runes := []rune(text)
+	if len(runes) <= limit {
+		return []string{text}
+	}
+
+	parts := make([]string, 0, len(runes)/limit+1)
+	for len(runes) > limit {
+		parts = append(parts, string(runes[:limit]))
+		runes = runes[limit:]
+	}
+
+	return append(parts, string(runes))
+}
@@ -0,0 +1,136 @@
+package markup
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSplit(t *testing.T) {
+	testCases := []struct {
+		name     string
+		text     string
+		limit    int
+		expected []string
+	}{
+		{name: "short", text: "short\n\n\ntext", limit: 20, expected: []string{"short\n\n\ntext"}},
+		{name: "empty", text: "", limit: 20, expected: []string{""}},
+		{
+			name:     "paragraphs",
+			text:     "first paragraph\n\nsecond one\n\nthird",
+			limit:    20,
+			expected: []string{"first paragraph", "second one\n\nthird"},
+		},
+		{
+			name:     "lines",
+			text:     "first line\nsecond line\nthird line",
+			limit:    24,
+			expected: []string{"first line\nsecond line", "third line"},
+		},
+		{
+			name:     "long_word",
+			text:     "абвгдежзиклмн",
+			limit:    5,
+			expected: []string{"абвгд", "ежзик", "лмн"},
+		},
+		{
+			name:     "code",
+			text:     "text\n\n```go\na := 1\n\nb := 2\n```\n\nend",
+			limit:    25,
+			expected: []string{"text", "```go\na := 1\n\nb := 2\n```", "end"},
+		},
+		{
+			name:     "long_code",
+			text:     "```go\na := 1\nb := 2\nc := 3\n```",
+			limit:    24,
+			expected: []string{"```go\na := 1\nb := 2\n```", "```go\nc := 3\n```"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result := Split(tc.text, tc.limit)
+
+			if !slices.Equal(result, tc.expected) {
+				t.Errorf("failed result %q, want %q", result, tc.expected)
+			}
+
+			for _, chunk := range result {
+				if n := utf8.RuneCountInString(chunk); n > tc.limit {
+					t.Errorf("chunk %q is too long: %d", chunk, n)
+				}
+			}
+		})
+	}
+}
+
+func TestFormat(t *testing.T) {
+	const text = "Use **a_b** and `x*y`.\n\n```go\nif a < b && c {\n\tfmt.Println(`q`)\n}\n```\n\n1. Done!"
+
+	testCases := []struct {
+		mode     Mode
+		expected string
+	}{
+		{mode: Plain, expected: text},
+		{
+			mode: Markdown,
+			expected: "Use *a\\_b* and `x*y`\\.\n\n```go\nif a < b && c {\n\tfmt.Println(\\`q\\`)\n}\n```\n\n" +
+				"1\\. Done\\!",
+		},
+		{
+			mode: HTML,
+			expected: "Use <b>a_b</b> and <code>x*y</code>.\n\n" +
+				"<pre>if a &lt; b &amp;&amp; c {\n\tfmt.Println(`q`)\n}</pre>\n\n1. Done!",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(string(tc.mode), func(t *testing.T) {
+			if result := Format(text, tc.mode); result != tc.expected {
+				t.Errorf("failed result\n%q\nwant\n%q", result, tc.expected)
+			}
+		})
+	}
+}
+
+func TestPrepare(t *testing.T) {
+	const limit = 40
+	text := strings.Repeat("a.b.c.d.e. ", 20) + "\n\n```\ncode\n```"
+
+	for _, mode := range []Mode{Plain, Markdown, HTML} {
+		result := Prepare(text, mode, limit)
+
+		if len(result) < 2 {
+			t.Errorf("mode %q: failed split %q", mode, result)
+		}
+
+		for _, chunk := range result {
+			if n := utf8.RuneCountInString(chunk); n > limit {
+				t.Errorf("mode %q: chunk %q is too long: %d", mode, chunk, n)
+			}
+		}
+	}
+}
+
+func TestMode_Validate(t *testing.T) {
+	for _, mode := range []Mode{Plain, Markdown, HTML} {
+		if err := mode.Validate(); err != nil {
+			t.Errorf("mode %q: %v", mode, err)
+		}
+	}
+
+	if err := Mode("MarkdownV2").Validate(); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestMode_ParseMode(t *testing.T) {
+	expected := map[Mode]ParseMode{Plain: "", Markdown: ParseModeMarkdownV2, HTML: ParseModeHTML}
+
+	for mode, parseMode := range expected {
+		if p := mode.ParseMode(); p != parseMode {
+			t.Errorf("mode %q: parse mode=%q, expected %q", mode, p, parseMode)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+// Package order contains strategies of chat members ordering for "/go" command.
+package order
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Mode is a chat members ordering strategy.
+type Mode string
+
+// Ordering strategies.
+const (
+	Random       Mode = "random"       // uniform shuffle
+	Fair         Mode = "fair"         // shuffle weighted by recent positions
+	Rotate       Mode = "rotate"       // alphabetical order with cyclically shifted first user
+	Alphabetical Mode = "alphabetical" // alphabetical order
+)
+
+// HistorySize is a number of recent orders which are used by Fair mode.
+const HistorySize = 10
+
+// Modes are all available ordering strategies.
+var Modes = []Mode{Random, Fair, Rotate, Alphabetical}
+
+// Parse returns a mode by its name, empty name is Random.
+func Parse(name string) (Mode, error) {
+	if name == "" {
+		return Random, nil
+	}
+
+	mode := Mode(strings.ToLower(name))
+	if !slices.Contains(Modes, mode) {
+		return "", fmt.Errorf("unknown order %q", name)
+	}
+
+	return mode, nil
+}
+
+// History returns a number of recent orders which are required by the mode.
+func (m Mode) History() int {
+	switch m {
+	case Fair:
+		return HistorySize
+	case Rotate:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// Sort returns a new ordered slice of users.
+// History contains recent orders from the latest one, src is a random source for shuffles.
+func (m Mode) Sort(users []string, history [][]string, src rand.Source) []string {
+	result := slices.Clone(users)
+
+	switch m {
+	case Fair:
+		return fair(result, history, src)
+	case Rotate:
+		return rotate(result, history)
+	case Alphabetical:
+		sort.Strings(result)
+		return result
+	default:
+		r := rand.New(src) // #nosec G404 - it isn't security sensitive, use real or pseudo-random
+		r.Shuffle(len(result), func(i, j int) {
+			result[i], result[j] = result[j], result[i]
+		})
+		return result
+	}
+}
+
+// positions returns average relative positions of users in history orders,
+// 0 is the first position and 1 is the last one.
+func positions(history [][]string) map[string]float64 {
+	var (
+		sums   = make(map[string]float64)
+		counts = make(map[string]int)
+	)
+
+	for _, users := range history {
+		n := len(users)
+		for i, user := range users {
+			if n > 1 {
+				sums[user] += float64(i) / float64(n-1)
+			} else {
+				sums[user] += 0.5
+			}
+			counts[user]++
+		}
+	}
+
+	result := make(map[string]float64, len(sums))
+	for user, sum := range sums {
+		result[user] = sum / float64(counts[user])
+	}
+
+	return result
+}
+
+// fair shuffles users with weights, so users who were recently at the beginning
+// are more likely to be at the end and vice versa.
+// It uses weighted random sampling without replacement by Efraimidis and Spirakis,
+// where every user gets a key u^(1/w) and users are sorted by keys in descending order.
+func fair(users []string, history [][]string, src rand.Source) []string {
+	const (
+		defaultPosition = 0.5 // for users without history
+		factor          = 4.0 // the weight of the last user is 5 times more than the first one's
+	)
+
+	var (
+		r      = rand.New(src) // #nosec G404 - it isn't security sensitive, use real or pseudo-random
+		pos    = positions(history)
+		keys   = make(map[string]float64, len(users))
+		sorted = slices.Clone(users)
+	)
+
+	sort.Strings(sorted) // stable base order for the same random values
+
+	for _, user := range sorted {
+		p, ok := pos[user]
+		if !ok {
+			p = defaultPosition
+		}
+
+		weight := 1 + factor*p
+		keys[user] = math.Pow(r.Float64(), 1/weight)
+	}
+
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return keys[sorted[i]] > keys[sorted[j]]
+	})
+
+	return sorted
+}
+
+// rotate returns users in alphabetical order starting from the user
+// who is next after the first one of the latest history order.
+func rotate(users []string, history [][]string) []string {
+	sort.Strings(users)
+
+	if len(history) == 0 || len(history[0]) == 0 || len(users) == 0 {
+		return users
+	}
+
+	// the previous first user can be absent now, so search the next one by name
+	previous := history[0][0]
+	i := sort.SearchStrings(users, previous)
+
+	if i < len(users) && users[i] == previous {
+		i++
+	}
+
+	i %= len(users)
+	return slices.Concat(users[i:], users[:i])
+}
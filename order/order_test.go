@@ -0,0 +1,103 @@
+package order
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/z0rr0/gobot/random"
+)
+
+func TestParse(t *testing.T) {
+	testCases := []struct {
+		name     string
+		expected Mode
+		wantErr  bool
+	}{
+		{name: "", expected: Random},
+		{name: "random", expected: Random},
+		{name: "Fair", expected: Fair},
+		{name: "rotate", expected: Rotate},
+		{name: "alphabetical", expected: Alphabetical},
+		{name: "unknown", wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		mode, err := Parse(tc.name)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("failed error=%v for %q, wantErr=%v", err, tc.name, tc.wantErr)
+		}
+
+		if mode != tc.expected {
+			t.Errorf("failed mode %q for %q, expected %q", mode, tc.name, tc.expected)
+		}
+	}
+}
+
+func TestMode_Sort(t *testing.T) {
+	users := []string{"c", "a", "d", "b"}
+
+	testCases := []struct {
+		name     string
+		mode     Mode
+		history  [][]string
+		expected []string
+	}{
+		{name: "alphabetical", mode: Alphabetical, expected: []string{"a", "b", "c", "d"}},
+		{name: "rotate_empty", mode: Rotate, expected: []string{"a", "b", "c", "d"}},
+		{name: "rotate", mode: Rotate, history: [][]string{{"b", "a"}}, expected: []string{"c", "d", "a", "b"}},
+		{name: "rotate_last", mode: Rotate, history: [][]string{{"d", "a"}}, expected: []string{"a", "b", "c", "d"}},
+		{name: "rotate_absent", mode: Rotate, history: [][]string{{"bb", "a"}}, expected: []string{"c", "d", "a", "b"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result := tc.mode.Sort(users, tc.history, random.New(false, 1, 2))
+			if !slices.Equal(result, tc.expected) {
+				t.Errorf("failed result %v, expected %v", result, tc.expected)
+			}
+		})
+	}
+
+	if !slices.Equal(users, []string{"c", "a", "d", "b"}) {
+		t.Errorf("source users are modified: %v", users)
+	}
+
+	for _, mode := range []Mode{Random, Fair} {
+		result := mode.Sort(users, nil, random.New(false, 1, 2))
+		slices.Sort(result)
+
+		if !slices.Equal(result, []string{"a", "b", "c", "d"}) {
+			t.Errorf("failed %s result %v", mode, result)
+		}
+	}
+}
+
+func TestFair(t *testing.T) {
+	const n = 1000
+	var (
+		users   = []string{"a", "b", "c"}
+		history = [][]string{{"a", "b", "c"}, {"a", "c", "b"}, {"a", "b", "c"}}
+		src     = random.New(false, 3, 4)
+		first   = make(map[string]int)
+	)
+
+	for range n {
+		first[Fair.Sort(users, history, src)[0]]++
+	}
+
+	// "a" was always the first, so it has the minimal weight
+	if first["a"] >= first["b"] || first["a"] >= first["c"] {
+		t.Errorf("failed first positions distribution %v", first)
+	}
+
+	first = make(map[string]int)
+	for range n {
+		first[Random.Sort(users, history, src)[0]]++
+	}
+
+	for _, user := range users {
+		if count := first[user]; count < n/5 {
+			t.Errorf("failed random first positions distribution %v", first)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+// Package schedule contains a scheduler job of automatic "/go" posts.
+package schedule
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/z0rr0/gobot/cmd"
+	"github.com/z0rr0/gobot/config"
+	"github.com/z0rr0/gobot/db"
+	"github.com/z0rr0/gobot/scheduler"
+	"github.com/z0rr0/gobot/transport"
+)
+
+// grace is a maximum delay of a scheduled post, for example after the bot restart.
+const grace = 5 * time.Minute
+
+// Job returns a scheduler job which does due posts every minute.
+func Job(c *config.Config, logInfo, logError *log.Logger) *scheduler.Job {
+	return &scheduler.Job{
+		Name: "schedule",
+		Spec: scheduler.Every(time.Minute),
+		Run: func(ctx context.Context) error {
+			n, err := run(ctx, c, time.Now(), logError)
+			if n > 0 {
+				logInfo.Printf("scheduled posts: %d", n)
+			}
+			return err
+		},
+	}
+}
+
+// run does all due posts of active chats and returns their number.
+// Schedules are checked in timezones of their chats.
+func run(ctx context.Context, c *config.Config, now time.Time, logError *log.Logger) (int, error) {
+	schedules, err := db.ActiveSchedules(ctx, c.DB)
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for _, s := range schedules {
+		if _, ok := s.Due(now.In(s.Location(c.Timezone)), grace); !ok {
+			continue
+		}
+
+		if err = post(ctx, c, s, now); err != nil {
+			logError.Printf("failed scheduled post for chat %q: %v", s.ChatID, err)
+			continue
+		}
+		n++
+	}
+
+	return n, nil
+}
+
+// post sends the shuffled list of chat members like "/go" command does.
+// The run time is saved before sending, so failed posts are not repeated every minute.
+func post(ctx context.Context, c *config.Config, s *db.Schedule, now time.Time) error {
+	if err := s.SaveRun(ctx, c.DB, now); err != nil {
+		return err
+	}
+
+	chat, err := db.Get(ctx, c.DB, s.ChatID)
+	if err != nil {
+		return fmt.Errorf("failed to get chat: %w", err)
+	}
+
+	event := &transport.Event{Type: transport.NewMessage, ChatID: chat.ID, Text: "/go"}
+
+	e := &cmd.Event{Cfg: c, ChatEvent: event, Chat: chat, OnlyChat: true}
+	return cmd.Go(ctx, e)
+}
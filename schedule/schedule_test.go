@@ -0,0 +1,142 @@
+package schedule
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/z0rr0/gobot/config"
+	"github.com/z0rr0/gobot/db"
+)
+
+const (
+	// configPath is the path of temporary configuration file.
+	configPath = "/tmp/gobot_config_test.toml"
+)
+
+var (
+	buildInfo = &config.BuildInfo{
+		Name:      "cmd_test",
+		Hash:      "123",
+		Revision:  "v0.0.1",
+		GoVersion: "go1.18",
+		Date:      "2022-03-28_06:21:50 UTC",
+		URL:       "https://github.com/z0rr0/gobot",
+	}
+	testLogger = log.New(os.Stdout, "TEST  ", log.LstdFlags)
+)
+
+func TestJob(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, err := fmt.Fprint(w, "{\"ok\": true}")
+		if err != nil {
+			t.Error(err)
+		}
+	})
+	s := httptest.NewServer(handler)
+	defer s.Close()
+
+	c, err := config.New(configPath, buildInfo, s)
+	if err != nil {
+		t.Fatalf("config.New: %v", err)
+	}
+
+	defer func() {
+		if errCfg := c.Close(); errCfg != nil {
+			t.Error(errCfg)
+		}
+	}()
+
+	job := Job(c, testLogger, testLogger)
+	if err = job.Run(context.Background()); err != nil {
+		t.Errorf("failed job %q: %v", job.Name, err)
+	}
+}
+
+func TestRun(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		messages []string
+	)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var url = strings.TrimRight(r.URL.Path, " /")
+		w.Header().Set("Content-Type", "application/json")
+		response := "{\"msgId\": \"7083436385855602743\", \"ok\": true}"
+
+		switch url {
+		case "/chats/getMembers":
+			response = "{\"members\": [{\"userId\": \"1001\"}, {\"userId\": \"user1@my.team\"}], \"ok\": true}"
+		case "/messages/sendText":
+			mu.Lock()
+			messages = append(messages, r.URL.Query().Get("chatId")+":"+r.URL.Query().Get("text"))
+			mu.Unlock()
+		}
+
+		_, err := fmt.Fprint(w, response)
+		if err != nil {
+			t.Error(err)
+		}
+	})
+	s := httptest.NewServer(handler)
+	defer s.Close()
+
+	c, err := config.New(configPath, buildInfo, s)
+	if err != nil {
+		t.Fatalf("config.New: %v", err)
+	}
+
+	defer func() {
+		if errCfg := c.Close(); errCfg != nil {
+			t.Error(errCfg)
+		}
+	}()
+
+	ctx := context.Background()
+	now := time.Now().In(c.Timezone).Add(time.Minute)
+
+	chats := []*db.Chat{
+		{ID: "TestRun", Active: true},
+		{ID: "TestRunStopped"},
+		{ID: "TestRunTimezone", Active: true, Timezone: "Asia/Novosibirsk"},
+	}
+
+	for _, chat := range chats {
+		if err = chat.Upsert(ctx, c.DB); err != nil {
+			t.Fatalf("chat.Upsert: %v", err)
+		}
+
+		// schedule time is local for the chat
+		local := now.In(chat.Location(c.Timezone))
+		if err = db.NewSchedule(chat.ID, local.Hour(), local.Minute(), nil).Save(ctx, c.DB); err != nil {
+			t.Fatalf("schedule.Save: %v", err)
+		}
+	}
+
+	n, err := run(ctx, c, now, testLogger)
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+
+	if n != 2 {
+		t.Errorf("failed number of posts %d", n)
+	}
+
+	// repeated run doesn't post again
+	if n, err = run(ctx, c, now.Add(time.Minute), testLogger); err != nil || n != 0 {
+		t.Errorf("failed number of repeated posts %d: %v", n, err)
+	}
+
+	expected := []string{"TestRun:1. @[user1@my.team]", "TestRunTimezone:1. @[user1@my.team]"}
+	if !slices.Equal(messages, expected) {
+		t.Errorf("failed messages %v, expected %v", messages, expected)
+	}
+}
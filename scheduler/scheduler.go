@@ -0,0 +1,191 @@
+// Package scheduler runs registered periodic jobs.
+//
+// Every job has a run time specification, a retry policy for failures and optional catch-up of a missed run,
+// the last successful runs are saved to the database, so missed runs are detected after restarts.
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/z0rr0/gobot/config"
+	"github.com/z0rr0/gobot/db"
+)
+
+// Job is a periodic scheduler job.
+type Job struct {
+	Name     string                          // unique job name
+	Spec     Spec                            // run times specification
+	Run      func(ctx context.Context) error // job function, it's called with a configuration timeout context
+	Retry    time.Duration                   // first retry delay after a failure, zero value disables retries
+	MaxRetry time.Duration                   // maximum retry delay, retry delay is doubled after every failure
+	CatchUp  bool                            // run the job at start if its planned run was missed
+}
+
+// retryDelay returns a delay before the next run after failures number of sequential failures.
+func (j *Job) retryDelay(failures int) time.Duration {
+	delay := j.Retry
+	for i := 1; i < failures && (j.MaxRetry == 0 || delay < j.MaxRetry); i++ {
+		delay *= 2
+	}
+
+	if j.MaxRetry > 0 && delay > j.MaxRetry {
+		return j.MaxRetry
+	}
+
+	return delay
+}
+
+// task is a job with its run state.
+type task struct {
+	job      *Job
+	next     time.Time
+	failures int
+}
+
+// Scheduler is a handler of periodic jobs.
+type Scheduler struct {
+	Stop     chan struct{}
+	cfg      *config.Config
+	tasks    []*task
+	logInfo  *log.Logger
+	logError *log.Logger
+}
+
+// New creates a new scheduler with jobs and starts it.
+// Jobs are stopped after stopService closing, then Stop channel is closed.
+func New(c *config.Config, stopService <-chan struct{}, logInfo, logError *log.Logger, jobs ...*Job) (*Scheduler, error) {
+	s := &Scheduler{
+		Stop:     make(chan struct{}),
+		cfg:      c,
+		tasks:    make([]*task, 0, len(jobs)),
+		logInfo:  logInfo,
+		logError: logError,
+	}
+
+	names := make(map[string]struct{}, len(jobs))
+	for _, job := range jobs {
+		if job.Name == "" || job.Spec == nil || job.Run == nil {
+			return nil, fmt.Errorf("job %q must have a name, specification and function", job.Name)
+		}
+
+		if _, ok := names[job.Name]; ok {
+			return nil, fmt.Errorf("duplicate job name %q", job.Name)
+		}
+
+		names[job.Name] = struct{}{}
+		s.tasks = append(s.tasks, &task{job: job})
+	}
+
+	go s.start(stopService)
+	return s, nil
+}
+
+// now returns current time in the configuration timezone.
+func (s *Scheduler) now() time.Time {
+	return time.Now().In(s.cfg.Timezone)
+}
+
+// start runs scheduler daemon.
+func (s *Scheduler) start(stopService <-chan struct{}) {
+	now := s.now()
+	for _, t := range s.tasks {
+		t.next = s.first(t.job, now)
+		s.logInfo.Printf("scheduler job %q next run %v", t.job.Name, t.next.Truncate(time.Second))
+	}
+
+	timeout := s.timeout(now)
+	s.logInfo.Printf("start scheduler [%v] jobs=%d, timeout=%v", s.cfg.Timezone, len(s.tasks), timeout)
+
+	defer func() {
+		close(s.Stop)
+		s.logInfo.Println("stop scheduler")
+	}()
+
+	// since Go 1.23 a stopped timer has no stale values, so its channel is not drained
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-stopService:
+			return
+		case <-timer.C:
+			for _, t := range s.tasks {
+				if now = s.now(); !t.next.IsZero() && !t.next.After(now) {
+					s.run(t, now)
+				}
+			}
+			timer.Reset(s.timeout(s.now()))
+		}
+	}
+}
+
+// first returns the first run time of the job.
+// It's now if the job catches up missed runs and its last successful run was before the last planned one.
+func (s *Scheduler) first(job *Job, now time.Time) time.Time {
+	if job.CatchUp {
+		ctx, cancel := s.cfg.Context()
+		defer cancel()
+
+		lastRun, err := db.JobLastRun(ctx, s.cfg.DB, job.Name)
+		if err != nil {
+			s.logError.Printf("failed to get last run of job %q: %v", job.Name, err)
+		} else if !lastRun.IsZero() {
+			if planned := job.Spec.Next(lastRun.In(now.Location())); !planned.IsZero() && !planned.After(now) {
+				s.logInfo.Printf("scheduler job %q missed run %v, catch up", job.Name, planned.Truncate(time.Second))
+				return now
+			}
+		}
+	}
+
+	return job.Spec.Next(now)
+}
+
+// timeout returns a duration until the nearest run of all jobs.
+func (s *Scheduler) timeout(now time.Time) time.Duration {
+	var next time.Time
+
+	for _, t := range s.tasks {
+		if !t.next.IsZero() && (next.IsZero() || t.next.Before(next)) {
+			next = t.next
+		}
+	}
+
+	if next.IsZero() {
+		// no planned runs, but the timer is still required to wait the stop
+		return 24 * time.Hour
+	}
+
+	return max(next.Sub(now), 0)
+}
+
+// run executes the task job and plans its next run.
+// A failed job is retried with an exponential backoff, but not later than its next regular run.
+func (s *Scheduler) run(t *task, now time.Time) {
+	ctx, cancel := s.cfg.Context()
+	defer cancel()
+
+	err := t.job.Run(ctx)
+	t.next = t.job.Spec.Next(now)
+
+	if err != nil {
+		t.failures++
+
+		if t.job.Retry > 0 {
+			if retry := now.Add(t.job.retryDelay(t.failures)); t.next.IsZero() || retry.Before(t.next) {
+				t.next = retry
+			}
+		}
+
+		s.logError.Printf("failed scheduler job %q [%d]: %v, next run %v", t.job.Name, t.failures, err, t.next.Truncate(time.Second))
+		return
+	}
+
+	t.failures = 0
+	if err = db.SaveJobRun(ctx, s.cfg.DB, t.job.Name, now); err != nil {
+		s.logError.Printf("failed to save run of job %q: %v", t.job.Name, err)
+	}
+}
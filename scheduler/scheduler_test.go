@@ -0,0 +1,160 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/z0rr0/gobot/config"
+	"github.com/z0rr0/gobot/db"
+)
+
+const (
+	// configPath is the path of temporary configuration file.
+	configPath = "/tmp/gobot_config_test.toml"
+)
+
+var (
+	buildInfo = &config.BuildInfo{
+		Name:      "cmd_test",
+		Hash:      "123",
+		Revision:  "v0.0.1",
+		GoVersion: "go1.18",
+		Date:      "2022-03-28_06:21:50 UTC",
+		URL:       "https://github.com/z0rr0/gobot",
+	}
+	testLogger = log.New(os.Stdout, "TEST  ", log.LstdFlags)
+)
+
+// newConfig returns a test configuration with a stub bot server.
+func newConfig(t *testing.T) *config.Config {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if _, err := fmt.Fprint(w, "{\"ok\": true}"); err != nil {
+			t.Error(err)
+		}
+	})
+	s := httptest.NewServer(handler)
+	t.Cleanup(s.Close)
+
+	c, err := config.New(configPath, buildInfo, s)
+	if err != nil {
+		t.Fatalf("config.New: %v", err)
+	}
+
+	t.Cleanup(func() {
+		if errCfg := c.Close(); errCfg != nil {
+			t.Error(errCfg)
+		}
+	})
+
+	return c
+}
+
+func TestJob_RetryDelay(t *testing.T) {
+	job := &Job{Retry: time.Minute, MaxRetry: 5 * time.Minute}
+	expected := []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute, 5 * time.Minute, 5 * time.Minute}
+
+	for i, delay := range expected {
+		if value := job.retryDelay(i + 1); value != delay {
+			t.Errorf("failed delay for %d failures: %v, expected %v", i+1, value, delay)
+		}
+	}
+}
+
+func TestNew(t *testing.T) {
+	c := newConfig(t)
+	run := func(context.Context) error { return nil }
+
+	invalid := [][]*Job{
+		{{Name: "", Spec: Every(time.Second), Run: run}},
+		{{Name: "no_spec", Run: run}},
+		{{Name: "no_run", Spec: Every(time.Second)}},
+		{{Name: "duplicate", Spec: Every(time.Second), Run: run}, {Name: "duplicate", Spec: Daily{}, Run: run}},
+	}
+
+	for _, jobs := range invalid {
+		if _, err := New(c, nil, testLogger, testLogger, jobs...); err == nil {
+			t.Errorf("no error for jobs %v", jobs[0].Name)
+		}
+	}
+}
+
+func TestScheduler(t *testing.T) {
+	var (
+		c           = newConfig(t)
+		stopService = make(chan struct{})
+		done        = make(chan string, 10)
+		failures    = 0
+	)
+
+	jobs := []*Job{
+		{
+			Name: "TestSchedulerEvery",
+			Spec: Every(50 * time.Millisecond),
+			Run: func(context.Context) error {
+				done <- "every"
+				return nil
+			},
+		},
+		{
+			Name:  "TestSchedulerRetry",
+			Spec:  Daily{},
+			Retry: 10 * time.Millisecond,
+			Run: func(context.Context) error {
+				if failures < 2 {
+					failures++
+					return errors.New("test error")
+				}
+				done <- "retry"
+				return nil
+			},
+			CatchUp: true,
+		},
+	}
+
+	ctx := context.Background()
+	// the daily job was done two days ago, so it catches up the missed run
+	if err := db.SaveJobRun(ctx, c.DB, "TestSchedulerRetry", time.Now().AddDate(0, 0, -2)); err != nil {
+		t.Fatalf("failed to save job run: %v", err)
+	}
+
+	s, err := New(c, stopService, testLogger, testLogger, jobs...)
+	if err != nil {
+		t.Fatalf("failed to create scheduler: %v", err)
+	}
+
+	results := make(map[string]int)
+	timeout := time.After(5 * time.Second)
+
+	for results["every"] < 2 || results["retry"] < 1 {
+		select {
+		case name := <-done:
+			results[name]++
+		case <-timeout:
+			t.Fatalf("scheduler timeout, results %v", results)
+		}
+	}
+
+	close(stopService)
+	<-s.Stop
+
+	if failures != 2 {
+		t.Errorf("failed number of failures %d", failures)
+	}
+
+	lastRun, err := db.JobLastRun(ctx, c.DB, "TestSchedulerRetry")
+	if err != nil {
+		t.Fatalf("failed to get job run: %v", err)
+	}
+
+	if time.Since(lastRun) > time.Minute {
+		t.Errorf("last run is not updated: %v", lastRun)
+	}
+}
@@ -0,0 +1,188 @@
+package scheduler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Spec defines run times of a job.
+type Spec interface {
+	// Next returns the first run time after ts or zero time if there is no one.
+	Next(ts time.Time) time.Time
+}
+
+// Daily is a specification of a job which runs every day at the same local time.
+// Location is a time zone of the run time, if it is nil then the location of the checked time is used.
+type Daily struct {
+	Hour     int
+	Minute   int
+	Second   int
+	Location *time.Location
+}
+
+// Next returns the next daily run time after ts in the specification location.
+func (d Daily) Next(ts time.Time) time.Time {
+	if d.Location != nil {
+		ts = ts.In(d.Location)
+	}
+
+	next := time.Date(ts.Year(), ts.Month(), ts.Day(), d.Hour, d.Minute, d.Second, 0, ts.Location())
+	if next.After(ts) {
+		return next
+	}
+
+	return time.Date(ts.Year(), ts.Month(), ts.Day()+1, d.Hour, d.Minute, d.Second, 0, ts.Location())
+}
+
+// Every is a specification of a job which runs with a fixed interval aligned to its multiples,
+// for example, every minute at zero second.
+type Every time.Duration
+
+// Next returns the next interval beginning after ts.
+func (e Every) Next(ts time.Time) time.Time {
+	d := time.Duration(e)
+	return ts.Truncate(d).Add(d)
+}
+
+// cronField is a bit set of allowed values of one cron field.
+type cronField uint64
+
+// has returns true if the value is in the set.
+func (f cronField) has(value int) bool {
+	return f&(1<<value) != 0
+}
+
+// cronBounds are minimum and maximum values of cron fields.
+var cronBounds = [5][2]int{
+	{0, 59}, // minute
+	{0, 23}, // hour
+	{1, 31}, // day of month
+	{1, 12}, // month
+	{0, 6},  // day of week, 0 is Sunday
+}
+
+// Cron is a specification in the cron format "minute hour day-of-month month day-of-week".
+// Every field can be "*", a number, a range "1-5", a step "*/15" or "0-30/10", or a list of them "1,3,5".
+// Like in the classic cron, if both day fields are restricted, a day matches any of them.
+type Cron struct {
+	minute, hour, day, month, weekDay cronField
+	anyDay, anyWeekDay                bool
+}
+
+// ParseCron parses a cron specification.
+func ParseCron(value string) (*Cron, error) {
+	items := strings.Fields(value)
+	if len(items) != len(cronBounds) {
+		return nil, fmt.Errorf("cron spec %q must have %d fields", value, len(cronBounds))
+	}
+
+	var fields [5]cronField
+	for i, item := range items {
+		f, err := parseCronField(item, cronBounds[i][0], cronBounds[i][1])
+		if err != nil {
+			return nil, fmt.Errorf("cron spec %q: %w", value, err)
+		}
+		fields[i] = f
+	}
+
+	return &Cron{
+		minute:     fields[0],
+		hour:       fields[1],
+		day:        fields[2],
+		month:      fields[3],
+		weekDay:    fields[4],
+		anyDay:     strings.HasPrefix(items[2], "*"),
+		anyWeekDay: strings.HasPrefix(items[4], "*"),
+	}, nil
+}
+
+// MustParseCron is like ParseCron but panics if the specification is invalid.
+func MustParseCron(value string) *Cron {
+	c, err := ParseCron(value)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+// parseCronField parses one cron field with allowed values from minValue to maxValue.
+func parseCronField(value string, minValue, maxValue int) (cronField, error) {
+	var f cronField
+
+	for _, item := range strings.Split(value, ",") {
+		step := 1
+		if base, stepValue, ok := strings.Cut(item, "/"); ok {
+			n, err := strconv.Atoi(stepValue)
+			if err != nil || n < 1 {
+				return 0, fmt.Errorf("incorrect step %q", item)
+			}
+			item, step = base, n
+		}
+
+		from, to := minValue, maxValue
+		if item != "*" {
+			first, last, isRange := strings.Cut(item, "-")
+
+			var errFrom, errTo error
+			from, errFrom = strconv.Atoi(first)
+			to, errTo = from, nil
+
+			if isRange {
+				to, errTo = strconv.Atoi(last)
+			}
+
+			if errFrom != nil || errTo != nil || from < minValue || to > maxValue || from > to {
+				return 0, fmt.Errorf("incorrect value %q, allowed from %d to %d", item, minValue, maxValue)
+			}
+		}
+
+		for i := from; i <= to; i += step {
+			f |= 1 << i
+		}
+	}
+
+	return f, nil
+}
+
+// matchDay returns true if the day of ts is allowed.
+func (c *Cron) matchDay(ts time.Time) bool {
+	day, weekDay := c.day.has(ts.Day()), c.weekDay.has(int(ts.Weekday()))
+
+	switch {
+	case c.anyDay && c.anyWeekDay:
+		return true
+	case c.anyDay:
+		return weekDay
+	case c.anyWeekDay:
+		return day
+	default:
+		return day || weekDay
+	}
+}
+
+// Next returns the next matched minute after ts in its location.
+// It returns zero time if there is no match during 5 years, for example for "0 0 30 2 *".
+func (c *Cron) Next(ts time.Time) time.Time {
+	loc := ts.Location()
+	next := ts.Truncate(time.Minute).Add(time.Minute)
+	limit := next.AddDate(5, 0, 0)
+
+	for next.Before(limit) {
+		switch {
+		case !c.month.has(int(next.Month())):
+			next = time.Date(next.Year(), next.Month()+1, 1, 0, 0, 0, 0, loc)
+		case !c.matchDay(next):
+			next = time.Date(next.Year(), next.Month(), next.Day()+1, 0, 0, 0, 0, loc)
+		case !c.hour.has(next.Hour()):
+			next = time.Date(next.Year(), next.Month(), next.Day(), next.Hour()+1, 0, 0, 0, loc)
+		case !c.minute.has(next.Minute()):
+			next = next.Add(time.Minute)
+		default:
+			return next
+		}
+	}
+
+	return time.Time{}
+}
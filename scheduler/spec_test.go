@@ -0,0 +1,116 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDaily_Next(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatalf("failed to load timezone: %v", err)
+	}
+
+	testCases := []struct {
+		name     string
+		spec     Daily
+		ts       time.Time
+		expected time.Time
+	}{
+		{
+			name:     "today",
+			spec:     Daily{Hour: 10},
+			ts:       time.Date(2026, 10, 17, 9, 59, 59, 0, time.UTC),
+			expected: time.Date(2026, 10, 17, 10, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "tomorrow",
+			spec:     Daily{Hour: 10},
+			ts:       time.Date(2026, 10, 17, 10, 0, 0, 0, time.UTC),
+			expected: time.Date(2026, 10, 18, 10, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "midnight",
+			spec:     Daily{Second: 1},
+			ts:       time.Date(2026, 12, 31, 5, 4, 3, 0, time.UTC),
+			expected: time.Date(2027, 1, 1, 0, 0, 1, 0, time.UTC),
+		},
+		{
+			name:     "winter",
+			spec:     Daily{Second: 1},
+			ts:       time.Date(2023, 11, 5, 0, 0, 1, 0, newYork),
+			expected: time.Date(2023, 11, 6, 0, 0, 1, 0, newYork),
+		},
+		{
+			name:     "location",
+			spec:     Daily{Hour: 9, Location: newYork},
+			ts:       time.Date(2026, 10, 17, 14, 0, 0, 0, time.UTC),
+			expected: time.Date(2026, 10, 18, 9, 0, 0, 0, newYork),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if next := tc.spec.Next(tc.ts); !next.Equal(tc.expected) {
+				t.Errorf("failed next=%v, expected=%v", next, tc.expected)
+			}
+		})
+	}
+}
+
+func TestEvery_Next(t *testing.T) {
+	ts := time.Date(2026, 10, 17, 5, 4, 30, 0, time.UTC)
+
+	if next, expected := Every(time.Minute).Next(ts), time.Date(2026, 10, 17, 5, 5, 0, 0, time.UTC); !next.Equal(expected) {
+		t.Errorf("failed next=%v, expected=%v", next, expected)
+	}
+
+	if next, expected := Every(time.Hour).Next(ts), time.Date(2026, 10, 17, 6, 0, 0, 0, time.UTC); !next.Equal(expected) {
+		t.Errorf("failed next=%v, expected=%v", next, expected)
+	}
+}
+
+func TestParseCron(t *testing.T) {
+	invalid := []string{"", "* * * *", "* * * * * *", "60 * * * *", "* 24 * * *", "* * 0 * *",
+		"* * * 13 *", "* * * * 7", "*/0 * * * *", "5-1 * * * *", "a * * * *", "1,,2 * * * *"}
+
+	for _, value := range invalid {
+		if _, err := ParseCron(value); err == nil {
+			t.Errorf("no error for %q", value)
+		}
+	}
+}
+
+func TestCron_Next(t *testing.T) {
+	// 2026-10-17 is Saturday
+	ts := time.Date(2026, 10, 17, 10, 30, 15, 0, time.UTC)
+
+	testCases := []struct {
+		spec     string
+		expected time.Time
+	}{
+		{spec: "* * * * *", expected: time.Date(2026, 10, 17, 10, 31, 0, 0, time.UTC)},
+		{spec: "*/15 * * * *", expected: time.Date(2026, 10, 17, 10, 45, 0, 0, time.UTC)},
+		{spec: "0 10 * * *", expected: time.Date(2026, 10, 18, 10, 0, 0, 0, time.UTC)},
+		{spec: "0 10 * * 1-5", expected: time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)},
+		{spec: "30 9,18 * * *", expected: time.Date(2026, 10, 17, 18, 30, 0, 0, time.UTC)},
+		{spec: "0 0 1 * *", expected: time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC)},
+		{spec: "0 0 1 1 *", expected: time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{spec: "0 12 20 * 0", expected: time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)}, // Sunday or 20th
+		{spec: "0 0 29 2 *", expected: time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{spec: "0 0 30 2 *"}, // never
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.spec, func(t *testing.T) {
+			c, err := ParseCron(tc.spec)
+			if err != nil {
+				t.Fatalf("failed to parse: %v", err)
+			}
+
+			if next := c.Next(ts); !next.Equal(tc.expected) {
+				t.Errorf("failed next=%v, expected=%v", next, tc.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package serve
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/z0rr0/gobot/cmd"
+)
+
+// helpCommand is a name of the command which shows commands' descriptions.
+const helpCommand = "/help"
+
+// Command is a bot command description.
+type Command struct {
+	Name        string      // main command name, for example "/go"
+	Aliases     []string    // additional command names
+	Handler     HandlerType // command handler
+	Description string      // short description for help
+	Usage       string      // arguments description, empty if command has no arguments
+	OnlyChat    bool        // command is available only for chats
+	NotStopped  bool        // command is handled even for stopped chats
+	Lock        bool        // command should be executed with a chat lock
+	// LockArgs is an optional filter of arguments which require the chat lock, all arguments by default
+	LockArgs func(arguments string) bool
+}
+
+// locked returns true if the command with the arguments should be executed with a chat lock.
+func (c *Command) locked(arguments string) bool {
+	return c.Lock && (c.LockArgs == nil || c.LockArgs(arguments))
+}
+
+// Names returns command name and all its aliases.
+func (c *Command) Names() []string {
+	return append([]string{c.Name}, c.Aliases...)
+}
+
+// Help returns a detailed command description.
+func (c *Command) Help() string {
+	var b strings.Builder
+
+	b.WriteString(strings.TrimSpace(c.Name + " " + c.Usage))
+	b.WriteString("\n" + c.Description)
+
+	if len(c.Aliases) > 0 {
+		b.WriteString("\naliases: " + strings.Join(c.Aliases, ", "))
+	}
+
+	if c.OnlyChat {
+		b.WriteString("\navailable only for chats")
+	}
+
+	return b.String()
+}
+
+// Registry is an ordered set of bot commands.
+type Registry struct {
+	commands []*Command
+	names    map[string]*Command
+}
+
+// NewRegistry returns a new commands registry.
+// It always contains the "/help" command which is rendered from registered commands.
+func NewRegistry(commands ...*Command) *Registry {
+	r := &Registry{names: make(map[string]*Command, len(commands)+1)}
+
+	r.Add(&Command{
+		Name:        helpCommand,
+		Handler:     r.help,
+		Description: "show this help",
+		Usage:       "[command]",
+		NotStopped:  true,
+	})
+
+	for _, c := range commands {
+		r.Add(c)
+	}
+
+	return r
+}
+
+// Add registers a new command. It panics if the command name or any alias is already registered.
+func (r *Registry) Add(c *Command) {
+	for _, name := range c.Names() {
+		if _, ok := r.names[name]; ok {
+			panic(fmt.Sprintf("duplicate command name %q", name))
+		}
+	}
+
+	for _, name := range c.Names() {
+		r.names[name] = c
+	}
+
+	r.commands = append(r.commands, c)
+}
+
+// Get returns a command by its name or alias.
+func (r *Registry) Get(name string) (*Command, bool) {
+	c, ok := r.names[name]
+	return c, ok
+}
+
+// Locked returns all names of commands which require a chat lock.
+func (r *Registry) Locked() []string {
+	var names []string
+
+	for _, c := range r.commands {
+		if c.Lock {
+			names = append(names, c.Names()...)
+		}
+	}
+
+	return names
+}
+
+// Help returns a short description of all registered commands.
+func (r *Registry) Help() string {
+	var b strings.Builder
+
+	for _, c := range r.commands {
+		b.WriteString(c.Name + " - " + c.Description)
+
+		if len(c.Aliases) > 0 {
+			b.WriteString(fmt.Sprintf(" (alias %s)", strings.Join(c.Aliases, ", ")))
+		}
+
+		b.WriteString("\n")
+	}
+
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// help is a handler for the "/help" command.
+func (r *Registry) help(_ context.Context, e *cmd.Event) error {
+	name := strings.TrimSpace(e.Arguments)
+	if name == "" {
+		return e.SendMessage(r.Help())
+	}
+
+	if !strings.HasPrefix(name, "/") {
+		name = "/" + name
+	}
+
+	c, ok := r.Get(name)
+	if !ok {
+		return e.SendMessage(fmt.Sprintf("unknown command %q", name))
+	}
+
+	return e.SendMessage(c.Help())
+}
@@ -0,0 +1,131 @@
+package serve
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/z0rr0/gobot/cmd"
+)
+
+func emptyHandler(context.Context, *cmd.Event) error {
+	return nil
+}
+
+func TestRegistry_Get(t *testing.T) {
+	r := NewRegistry(
+		&Command{Name: "/go", Aliases: []string{"/shuffle"}, Handler: emptyHandler, Description: "go"},
+		&Command{Name: "/skip", Handler: emptyHandler, Description: "skip", Lock: true},
+	)
+
+	testCases := []struct {
+		name     string
+		command  string
+		expected string
+		ok       bool
+	}{
+		{name: "help", command: "/help", expected: "/help", ok: true},
+		{name: "name", command: "/go", expected: "/go", ok: true},
+		{name: "alias", command: "/shuffle", expected: "/go", ok: true},
+		{name: "unknown", command: "/unknown"},
+		{name: "no_slash", command: "go"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c, ok := r.Get(tc.command)
+			if ok != tc.ok {
+				t.Fatalf("failed ok=%v, expected %v", ok, tc.ok)
+			}
+			if ok && c.Name != tc.expected {
+				t.Errorf("failed name=%q, expected %q", c.Name, tc.expected)
+			}
+		})
+	}
+}
+
+func TestRegistry_Add(t *testing.T) {
+	r := NewRegistry(&Command{Name: "/go", Aliases: []string{"/shuffle"}, Handler: emptyHandler})
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expected panic for duplicate alias")
+		}
+	}()
+
+	r.Add(&Command{Name: "/random", Aliases: []string{"/shuffle"}, Handler: emptyHandler})
+}
+
+func TestRegistry_Locked(t *testing.T) {
+	r := NewRegistry(
+		&Command{Name: "/go", Aliases: []string{"/shuffle"}, Handler: emptyHandler},
+		&Command{Name: "/skip", Aliases: []string{"/pass"}, Handler: emptyHandler, Lock: true},
+		&Command{Name: "/link", Handler: emptyHandler, Lock: true},
+	)
+
+	expected := []string{"/skip", "/pass", "/link"}
+	if locked := r.Locked(); !slices.Equal(locked, expected) {
+		t.Errorf("failed locked=%v, expected %v", locked, expected)
+	}
+}
+
+func TestCommand_locked(t *testing.T) {
+	testCases := []struct {
+		name      string
+		arguments string
+		expected  bool
+	}{
+		{name: "/go", expected: false},
+		{name: "/skip", expected: true},
+		{name: "/ai", expected: true},
+		{name: "/ai", arguments: " off ", expected: true},
+		{name: "/ai", arguments: "gpt hello", expected: false},
+	}
+
+	for _, tc := range testCases {
+		c, ok := commands.Get(tc.name)
+		if !ok {
+			t.Fatalf("unknown command %s", tc.name)
+		}
+
+		if locked := c.locked(tc.arguments); locked != tc.expected {
+			t.Errorf("failed %s %q locked=%v, expected %v", tc.name, tc.arguments, locked, tc.expected)
+		}
+	}
+}
+
+func TestRegistry_Help(t *testing.T) {
+	r := NewRegistry(
+		&Command{Name: "/go", Aliases: []string{"/shuffle"}, Handler: emptyHandler, Description: "shuffle", OnlyChat: true},
+		&Command{Name: "/link", Handler: emptyHandler, Description: "set link", Usage: "[URL [text]]"},
+	)
+
+	expected := "/help - show this help\n/go - shuffle (alias /shuffle)\n/link - set link"
+	if h := r.Help(); h != expected {
+		t.Errorf("failed help=%q, expected %q", h, expected)
+	}
+
+	c, _ := r.Get("/shuffle")
+	expected = "/go\nshuffle\naliases: /shuffle\navailable only for chats"
+	if h := c.Help(); h != expected {
+		t.Errorf("failed help=%q, expected %q", h, expected)
+	}
+
+	c, _ = r.Get("/link")
+	expected = "/link [URL [text]]\nset link"
+	if h := c.Help(); h != expected {
+		t.Errorf("failed help=%q, expected %q", h, expected)
+	}
+}
+
+func TestCommands(t *testing.T) {
+	// every handled command should be described for help
+	for _, c := range commands.commands {
+		if c.Description == "" {
+			t.Errorf("command %q has no description", c.Name)
+		}
+		if c.Handler == nil {
+			t.Errorf("command %q has no handler", c.Name)
+		}
+	}
+}
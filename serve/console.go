@@ -0,0 +1,29 @@
+package serve
+
+import (
+	"context"
+	"log"
+
+	"github.com/z0rr0/gobot/config"
+)
+
+// Console handles events of the console messenger one by one until the end of input,
+// so bot replies are written before the next command is handled.
+func Console(c *config.Config, logInfo, logError *log.Logger) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	for e := range c.Messenger.Events(ctx, logError) {
+		p := Payload{Cfg: c, Event: &e, LogInfo: logInfo, LogError: logError}
+
+		handled, err := handle(p)
+		if err != nil {
+			logError.Printf("[%s] error handling event: %v", p.ID(), err)
+			continue
+		}
+
+		if !handled {
+			logInfo.Printf("[%s] not handled: unknown command or the chat is not started by /start", p.ID())
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package serve
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/z0rr0/gobot/config"
+	"github.com/z0rr0/gobot/transport"
+)
+
+func TestConsole(t *testing.T) {
+	var (
+		out   strings.Builder
+		input = "/start\n\n/unknown\n/exclude @[alice@my.team]\n/go\n/version\n"
+	)
+
+	c, err := config.NewConsole(configPath, buildInfo, strings.NewReader(input), &out)
+	if err != nil {
+		t.Fatalf("config.NewConsole: %v", err)
+	}
+	defer func() {
+		if errCfg := c.Close(); errCfg != nil {
+			t.Error(errCfg)
+		}
+	}()
+
+	if _, ok := c.Messenger.(*transport.Console); !ok {
+		t.Fatalf("failed messenger type %T", c.Messenger)
+	}
+
+	// a new chat for every run, because its state is saved to the database
+	var (
+		chatID  = "TestConsole" + time.Now().Format("150405.000000")
+		user    = transport.User{ID: "user@my.team"}
+		members = []transport.User{{ID: "alice@my.team"}, user}
+	)
+	c.Messenger = transport.NewConsole(strings.NewReader(input), &out, chatID, user, members)
+
+	Console(c, testLogger, testLogger)
+
+	expected := "--- message #1 ---\nstarted\n" +
+		"--- message #2 ---\nsuccess\n" +
+		"--- message #3 ---\n1. @[user@my.team]\n" +
+		"--- message #4 ---\ncmd_test 123\nRevision: v0.0.1\nGo version: go1.18\nBuild time: 2022-03-28_06:21:50 UTC\n" +
+		"[https://github.com/z0rr0/gobot](https://github.com/z0rr0/gobot)\n"
+	if result := out.String(); result != expected {
+		t.Errorf("failed output\n%s\nwant\n%s", result, expected)
+	}
+}
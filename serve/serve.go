@@ -2,76 +2,251 @@ package serve
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"log"
+	"net"
+	"net/http"
 	"os"
 	"strings"
 	"sync"
 	"time"
 
-	botgolang "github.com/mail-ru-im/bot-golang"
-
 	"github.com/z0rr0/gobot/cmd"
 	"github.com/z0rr0/gobot/config"
 	"github.com/z0rr0/gobot/db"
+	"github.com/z0rr0/gobot/transport"
 )
 
 var (
 	// allowedEvents are bot events for handling
-	allowedEvents = map[botgolang.EventType]bool{
-		botgolang.NEW_MESSAGE:    true,
-		botgolang.EDITED_MESSAGE: true,
-	}
-	// allowedCommands is commands for handling bots actions
-	allowedCommands = map[string]HandlerType{
-		"/start":    cmd.Start,
-		"/stop":     cmd.Stop,
-		"/version":  cmd.Version,
-		"/go":       cmd.Go,
-		"/shuffle":  cmd.Go, // alias for "/go"
-		"/exclude":  cmd.Exclude,
-		"/include":  cmd.Include,
-		"/link":     cmd.Link,
-		"/reset":    cmd.ResetLink,
-		"/vacation": cmd.Vacation,
-		"/gpt":      cmd.GPT,
-		"/ygpt":     cmd.YandexGPT,
-		"/ds":       cmd.DeepSeek,
-		"/skip":     cmd.Skip,
-		"/nodays":   cmd.NoDays,
-	}
-	// notSupportedCommands is commands which can't be stopped
-	notStoppedCommands = map[string]bool{"/start": true}
-	// onlyChatCommands is commands which can be used only for chats
-	onlyChatCommands = map[string]bool{
-		"/go":       true,
-		"/shuffle":  true,
-		"/exclude":  true,
-		"/include":  true,
-		"/link":     true,
-		"/reset":    true,
-		"/vacation": true,
-		"/gpt":      true,
-		"/ygpt":     true,
-		"/ds":       true,
-		"/skip":     true,
-		"/nodays":   true,
+	allowedEvents = map[transport.EventType]bool{
+		transport.NewMessage:    true,
+		transport.EditedMessage: true,
 	}
+	// commands is a registry of bot commands
+	commands = NewRegistry(
+		&Command{
+			Name:        "/start",
+			Handler:     cmd.Start,
+			Description: "allow bot to write messages",
+			NotStopped:  true,
+		},
+		&Command{
+			Name:        "/stop",
+			Handler:     cmd.Stop,
+			Description: "prevent bot from writing messages",
+		},
+		&Command{
+			Name:        "/version",
+			Handler:     cmd.Version,
+			Description: "show bot version",
+		},
+		&Command{
+			Name:        "/go",
+			Aliases:     []string{"/shuffle"},
+			Handler:     cmd.Go,
+			Description: "show chat members in random or the chat's /order",
+			OnlyChat:    true,
+		},
+		&Command{
+			Name:        "/order",
+			Handler:     cmd.Order,
+			Description: "set the order of /go command: random, fair, rotate or alphabetical, show it without arguments",
+			Usage:       "[random|fair|rotate|alphabetical]",
+			OnlyChat:    true,
+			Lock:        true,
+		},
+		&Command{
+			Name:        "/history",
+			Handler:     cmd.History,
+			Description: "show recent results of /go command",
+			Usage:       "[n]",
+			OnlyChat:    true,
+		},
+		&Command{
+			Name:        "/stats",
+			Handler:     cmd.Stats,
+			Description: "show first and last positions of users in /go results for a number of days (30 by default)",
+			Usage:       "[days]",
+			OnlyChat:    true,
+		},
+		&Command{
+			Name:        "/exclude",
+			Handler:     cmd.Exclude,
+			Description: "add users to the exclude list or show it without arguments",
+			Usage:       "[@user ...]",
+			OnlyChat:    true,
+			Lock:        true,
+		},
+		&Command{
+			Name:        "/include",
+			Handler:     cmd.Include,
+			Description: "remove users from the exclude list or work as /go without arguments",
+			Usage:       "[@user ...]",
+			OnlyChat:    true,
+			Lock:        true,
+		},
+		&Command{
+			Name:        "/link",
+			Handler:     cmd.Link,
+			Description: "set a call link for the chat or show it without arguments",
+			Usage:       "[URL [text]]",
+			OnlyChat:    true,
+			Lock:        true,
+		},
+		&Command{
+			Name:        "/reset",
+			Handler:     cmd.ResetLink,
+			Description: "remove the call link of the chat",
+			OnlyChat:    true,
+			Lock:        true,
+		},
+		&Command{
+			Name:        "/vacation",
+			Handler:     cmd.Vacation,
+			Description: "add the author to the exclude list until the return date or remove from it if already there",
+			Usage:       "[YYYY-MM-DD|Nd|Nw]",
+			OnlyChat:    true,
+			Lock:        true,
+		},
+		&Command{
+			Name:        "/skip",
+			Handler:     cmd.Skip,
+			Description: "skip the author until tomorrow, repeated call cancels it",
+			OnlyChat:    true,
+			Lock:        true,
+		},
+		&Command{
+			Name:        "/nodays",
+			Handler:     cmd.NoDays,
+			Description: "set week days (0-6, from Sunday to Saturday) when the author is absent, reset without arguments",
+			Usage:       "[day ...]",
+			OnlyChat:    true,
+			Lock:        true,
+		},
+		&Command{
+			Name:        "/schedule",
+			Handler:     cmd.Schedule,
+			Description: "set a schedule of automatic /go posts, remove it with \"off\" or show it without arguments",
+			Usage:       "[HH:MM [days]|off]",
+			OnlyChat:    true,
+			Lock:        true,
+		},
+		&Command{
+			Name:        "/tz",
+			Handler:     cmd.Timezone,
+			Description: "set the chat timezone by IANA name, reset it to default or show it without arguments",
+			Usage:       "[timezone|reset]",
+			OnlyChat:    true,
+			Lock:        true,
+		},
+		&Command{
+			Name:        "/prompt",
+			Handler:     cmd.Prompt,
+			Description: "set, show or reset the chat's system prompt of AI commands",
+			Usage:       "[set <text>|show|reset]",
+			OnlyChat:    true,
+			Lock:        true,
+		},
+		&Command{
+			Name:        "/model",
+			Handler:     cmd.Model,
+			Description: "set the chat's model, temperature and max tokens of AI provider or show them",
+			Usage:       "[<provider> [model|reset] [temperature=N] [max_tokens=N]]",
+			OnlyChat:    true,
+			Lock:        true,
+		},
+		&Command{
+			Name:        "/gpt",
+			Handler:     cmd.GPT,
+			Description: "ask ChatGPT, the conversation context is kept until reset",
+			Usage:       "[--fresh] <text>|reset",
+			OnlyChat:    true,
+		},
+		&Command{
+			Name:        "/ygpt",
+			Handler:     cmd.YandexGPT,
+			Description: "ask Yandex GPT, the conversation context is kept until reset",
+			Usage:       "[--fresh] <text>|reset",
+			OnlyChat:    true,
+		},
+		&Command{
+			Name:        "/ds",
+			Handler:     cmd.DeepSeek,
+			Description: "ask DeepSeek, the conversation context is kept until reset",
+			Usage:       "[--fresh] <text>|reset",
+			OnlyChat:    true,
+		},
+		&Command{
+			Name:        "/usage",
+			Handler:     cmd.Usage,
+			Description: "show daily and monthly AI usage of the chat and the author with quotas",
+			OnlyChat:    true,
+		},
+		&Command{
+			Name:        "/ai",
+			Handler:     cmd.AI,
+			Description: "enable or disable AI commands for the chat (only for admins), show the status or ask AI provider",
+			Usage:       "[on|off|status] or <provider> [--fresh] <text>|reset",
+			OnlyChat:    true,
+			Lock:        true,
+			LockArgs:    cmd.AIToggle, // questions to providers can take minutes, they don't block the chat
+		},
+	)
 
 	// syncCmd is a global map of chats which should be locked during command execution.
-	syncCmd = NewSyncCommands([]string{"/exclude", "/include", "/link", "/reset", "/vacation", "/skip", "/nodays"})
+	syncCmd = NewSyncCommands(commands.Locked())
+
+	// syncMsg is a global map of messages which are being handled.
+	syncMsg = NewSyncMessages()
 )
 
 // Payload is a struct for events payload.
 type Payload struct {
 	Cfg      *config.Config
-	Event    *botgolang.Event
+	Event    *transport.Event
 	LogInfo  *log.Logger
 	LogError *log.Logger
 }
 
 // ID returns message ID.
 func (p *Payload) ID() string {
-	return p.Event.Payload.MsgID
+	return p.Event.MsgID
+}
+
+// text returns the message text with normalized spaces.
+func (p *Payload) text() string {
+	return strings.Join(strings.Fields(p.Event.Text), " ")
+}
+
+// previous returns the previous processing of the message or nil if it's a new one.
+// The second boolean value is true if the message should be skipped:
+// it's redelivered or edited without changes of the command text.
+func (p *Payload) previous(ctx context.Context, chatID string) (*db.ProcessedEvent, bool, error) {
+	if p.ID() == "" {
+		return nil, false, nil
+	}
+
+	previous, err := db.GetProcessedEvent(ctx, p.Cfg.DB, chatID, p.ID())
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+
+	return previous, p.Event.Type != transport.EditedMessage || previous.Text == p.text(), nil
+}
+
+// saveProcessed saves the handled message with the command's name and outcome.
+func (p *Payload) saveProcessed(ctx context.Context, chatID, command, outcome string) error {
+	if p.ID() == "" {
+		return nil
+	}
+
+	e := &db.ProcessedEvent{ChatID: chatID, MsgID: p.ID(), Text: p.text(), Command: command, Outcome: outcome}
+	return db.SaveProcessedEvent(ctx, p.Cfg.DB, e, p.Cfg.M.Events)
 }
 
 // handle is common handler for bot events.
@@ -81,32 +256,52 @@ func handle(p Payload) (bool, error) {
 		return false, nil
 	}
 
-	argsStr := strings.SplitN(p.Event.Payload.Text, " ", 2)
+	argsStr := strings.SplitN(p.Event.Text, " ", 2)
 	cmdName := strings.Trim(argsStr[0], " ")
 
-	handler, ok := allowedCommands[cmdName]
+	command, ok := commands.Get(cmdName)
 	if !ok {
 		return false, nil
 	}
 
+	args := ""
+	if len(argsStr) > 1 {
+		args = argsStr[1] // argsStr length is 1 on 2
+	}
+
 	// we can wait for a lock here before any db requests
 	// if some not thread-safe commands are executed for same chats
-	handler = syncCmd.Decorate(cmdName, p.Event.Payload.Chat.ID, handler)
+	handler := command.Handler
+	if command.locked(args) {
+		handler = syncCmd.Decorate(cmdName, p.Event.ChatID, command.Handler)
+	}
+
+	if p.ID() != "" {
+		// the processed check, the handling and the saving of the message are not concurrent
+		// for its redelivered copies, otherwise all of them can pass the check and be handled
+		unlock := syncMsg.Lock(p.Event.ChatID, p.ID())
+		defer unlock()
+	}
 
 	ctx, cancel := p.Cfg.Context()
 	defer cancel()
 
-	chat, err := db.GetOrCreate(ctx, p.Cfg.DB, p.Event.Payload.Chat.ID)
+	chat, err := db.GetOrCreate(ctx, p.Cfg.DB, p.Event.ChatID)
 	if err != nil {
 		return false, err
 	}
-	if !chat.Active && !notStoppedCommands[cmdName] {
+	if !chat.Active && !command.NotStopped {
 		return false, nil
 	}
 
-	args := ""
-	if len(argsStr) > 1 {
-		args = argsStr[1] // argsStr length is 1 on 2
+	previous, skip, err := p.previous(ctx, chat.ID)
+	if err != nil {
+		return false, err
+	}
+
+	if skip {
+		p.LogInfo.Printf("[%s] %q skip already handled command --> %v", p.ID(), chat.ID, cmdName)
+		return false, nil
 	}
 
 	e := &cmd.Event{
@@ -114,7 +309,12 @@ func handle(p Payload) (bool, error) {
 		ChatEvent: p.Event,
 		Chat:      chat,
 		Arguments: args,
-		OnlyChat:  onlyChatCommands[cmdName],
+		OnlyChat:  command.OnlyChat,
+	}
+
+	if previous != nil && previous.Command == command.Name {
+		// the edited message repeats the previous outcome of the same command
+		e.Outcome = previous.Outcome
 	}
 	p.LogInfo.Printf("[%s] %q handling command --> %v", p.ID(), chat.ID, cmdName)
 
@@ -127,6 +327,10 @@ func handle(p Payload) (bool, error) {
 		return false, e.SendMessage("sorry, some error occurred")
 	}
 
+	if err = p.saveProcessed(ctx, chat.ID, command.Name, e.Outcome); err != nil {
+		return true, err
+	}
+
 	return true, nil
 }
 
@@ -172,10 +376,11 @@ func New(n int) (chan<- Payload, <-chan struct{}) {
 }
 
 // Run starts main service process.
+// Events are received by bot API long polling or by webhook HTTP server depending on the configuration.
 func Run(c *config.Config, p chan<- Payload, sigint <-chan os.Signal, logInfo, logError *log.Logger) {
 	var (
 		ctx, cancel = context.WithCancel(context.Background())
-		events      = c.Bt.GetUpdatesChannel(ctx)
+		events      <-chan transport.Event
 	)
 
 	defer func() {
@@ -183,14 +388,70 @@ func Run(c *config.Config, p chan<- Payload, sigint <-chan os.Signal, logInfo, l
 		cancel()
 	}()
 
+	if c.B.Mode == config.ModeWebhook {
+		ch := make(chan transport.Event)
+		shutdown, err := startWebhook(c, ch, ctx.Done(), logInfo, logError)
+		if err != nil {
+			logError.Printf("failed to start webhook: %v", err)
+			return
+		}
+
+		defer func() {
+			// stop waiting handlers before the server shutdown
+			cancel()
+			shutdown()
+		}()
+		events = ch
+	} else {
+		events = c.Messenger.Events(ctx, logError)
+	}
+
 	for {
 		select {
 		case s := <-sigint:
 			logInfo.Printf("taken signal %v", s)
 			return
-		case e := <-events:
-			logInfo.Printf("[%s] got event type=%v for chat=%v", e.Payload.MsgID, e.Type, e.Payload.Chat.ID)
+		case e, ok := <-events:
+			if !ok {
+				logError.Printf("events channel is closed")
+				return
+			}
+
+			logInfo.Printf("[%s] got event type=%v for chat=%v", e.MsgID, e.Type, e.ChatID)
 			p <- Payload{Cfg: c, Event: &e, LogInfo: logInfo, LogError: logError}
 		}
 	}
 }
+
+// startWebhook starts HTTP server of webhook events and returns its shutdown function.
+func startWebhook(
+	c *config.Config, events chan<- transport.Event, stop <-chan struct{}, logInfo, logError *log.Logger,
+) (func(), error) {
+	listener, err := net.Listen("tcp", c.W.Address)
+	if err != nil {
+		return nil, err
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(c.W.Path, NewWebhook(c.W.Secret, events, stop, logError))
+
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second, ErrorLog: logError}
+	go func() {
+		logInfo.Printf("webhook is listening on %s%s", listener.Addr(), c.W.Path)
+
+		if errServe := server.Serve(listener); !errors.Is(errServe, http.ErrServerClosed) {
+			logError.Printf("webhook server error: %v", errServe)
+		}
+	}()
+
+	shutdown := func() {
+		ctx, cancel := c.Context()
+		defer cancel()
+
+		if errShutdown := server.Shutdown(ctx); errShutdown != nil {
+			logError.Printf("webhook shutdown error: %v", errShutdown)
+		}
+	}
+
+	return shutdown, nil
+}
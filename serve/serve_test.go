@@ -4,20 +4,21 @@ import (
 	"context"
 	"fmt"
 	"log"
-	"net/http"
-	"net/http/httptest"
 	"os"
 	"os/signal"
+	"slices"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
-	botgolang "github.com/mail-ru-im/bot-golang"
-
+	"github.com/z0rr0/gobot/botapitest"
 	"github.com/z0rr0/gobot/cmd"
 	"github.com/z0rr0/gobot/config"
+	"github.com/z0rr0/gobot/transport"
 )
 
 const (
@@ -38,7 +39,43 @@ var (
 	cmdMutex   sync.Mutex
 )
 
-func patchHandlers(name string) *[]string {
+// newTestConfig returns a configuration with the fake bot API server, they are closed after the test.
+func newTestConfig(t *testing.T) (*config.Config, *botapitest.Server) {
+	s := botapitest.NewServer()
+	c, err := config.New(configPath, buildInfo, s.Server)
+	if err != nil {
+		s.Close()
+		t.Fatalf("config.New: %v", err)
+	}
+
+	t.Cleanup(func() {
+		if errCfg := c.Close(); errCfg != nil {
+			t.Error(errCfg)
+		}
+		s.Close()
+	})
+
+	return c, s
+}
+
+// addCommand registers the command for the test, it is removed after the test.
+func addCommand(t *testing.T, c *Command) {
+	cmdMutex.Lock()
+	commands.Add(c)
+	cmdMutex.Unlock()
+
+	t.Cleanup(func() {
+		cmdMutex.Lock()
+		defer cmdMutex.Unlock()
+
+		for _, name := range c.Names() {
+			delete(commands.names, name)
+		}
+		commands.commands = slices.DeleteFunc(commands.commands, func(item *Command) bool { return item == c })
+	})
+}
+
+func patchHandlers(t *testing.T, name string) *[]string {
 	var (
 		mu sync.Mutex
 		b  = make([]string, 0)
@@ -50,65 +87,37 @@ func patchHandlers(name string) *[]string {
 		mu.Unlock()
 		return nil
 	}
-	cmdMutex.Lock()
-	allowedCommands[name] = f
-	notStoppedCommands[name] = true
-	cmdMutex.Unlock()
+	addCommand(t, &Command{Name: name, Handler: f, Description: "test", NotStopped: true})
 	return &b
 }
 
 func TestNew(t *testing.T) {
-	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		response := "{\"msgId\": \"7083436385855602743\", \"ok\": true}"
-		_, err := fmt.Fprint(w, response)
-		if err != nil {
-			t.Error(err)
-		}
-	})
-	s := httptest.NewServer(handler)
-	defer s.Close()
-	c, err := config.New(configPath, buildInfo, s)
-	if err != nil {
-		t.Fatalf("config.New: %v", err)
-	}
-	defer func() {
-		if errCfg := c.Close(); errCfg != nil {
-			t.Error(errCfg)
-		}
-	}()
-	b := patchHandlers("TestNew")
+	c, _ := newTestConfig(t)
+	b := patchHandlers(t, "TestNew")
 	p, stop := New(2)
 	// failed event type
 	p <- Payload{
 		Cfg: c,
-		Event: &botgolang.Event{
-			Type: botgolang.DELETED_MESSAGE,
-			Payload: botgolang.EventPayload{
-				BaseEventPayload: botgolang.BaseEventPayload{
-					Text:  "TestNew x",
-					MsgID: "delete",
-					Chat:  botgolang.Chat{ID: "delete"},
-				},
-			},
+		Event: &transport.Event{
+			Type:   "deletedMessage",
+			Text:   "TestNew x",
+			MsgID:  "delete",
+			ChatID: "delete",
 		},
 		LogInfo:  testLogger,
 		LogError: testLogger,
 	}
-	// valid commands
+	// valid commands, message IDs are unique for every run because processed messages are skipped
 	arguments := []string{"a", "b", "c", "d"}
+	runID := strconv.FormatInt(time.Now().UnixNano(), 10)
 	for _, a := range arguments {
 		event := Payload{
 			Cfg: c,
-			Event: &botgolang.Event{
-				Type: botgolang.NEW_MESSAGE,
-				Payload: botgolang.EventPayload{
-					BaseEventPayload: botgolang.BaseEventPayload{
-						Text:  "TestNew " + a,
-						MsgID: a,
-						Chat:  botgolang.Chat{ID: a},
-					},
-				},
+			Event: &transport.Event{
+				Type:   transport.NewMessage,
+				Text:   "TestNew " + a,
+				MsgID:  a + runID,
+				ChatID: a,
 			},
 			LogInfo:  testLogger,
 			LogError: testLogger,
@@ -118,15 +127,11 @@ func TestNew(t *testing.T) {
 	// unknown command
 	p <- Payload{
 		Cfg: c,
-		Event: &botgolang.Event{
-			Type: botgolang.NEW_MESSAGE,
-			Payload: botgolang.EventPayload{
-				BaseEventPayload: botgolang.BaseEventPayload{
-					Text:  "BadCmd y",
-					MsgID: "BadCmd",
-					Chat:  botgolang.Chat{ID: "BadCmd"},
-				},
-			},
+		Event: &transport.Event{
+			Type:   transport.NewMessage,
+			Text:   "BadCmd y",
+			MsgID:  "BadCmd",
+			ChatID: "BadCmd",
 		},
 		LogInfo:  testLogger,
 		LogError: testLogger,
@@ -143,46 +148,22 @@ func TestNew(t *testing.T) {
 }
 
 func TestRun(t *testing.T) {
-	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		var url = strings.TrimRight(r.URL.Path, " /")
-		w.Header().Set("Content-Type", "application/json")
-		response := "{\"msgId\": \"7083436385855602743\", \"ok\": true}"
-		if url == "/events/get" {
-			response = "{\"events\": [{\"eventId\": 534, \"payload\": " +
-				"{\"chat\": {\"chatId\": \"123@chat.agent\", \"title\": \"goBotTest\", \"type\": \"group\"}, " +
-				"\"from\": {\"firstName\": \"firstName\", \"lastName\": \"lastName\", " +
-				"\"userId\": \"user1@my.team\"}, " +
-				"\"msgId\": \"7083840679717109811\", " +
-				"\"text\": \"TestRun user-test-msg\", \"timestamp\": 1649335185}, \"type\": \"newMessage\"}], " +
-				"\"ok\": true}"
-		}
-		_, err := fmt.Fprint(w, response)
-		if err != nil {
-			t.Error(err)
-		}
-	})
-	s := httptest.NewServer(handler)
-	defer s.Close()
-	c, err := config.New(configPath, buildInfo, s)
-	if err != nil {
-		t.Fatalf("config.New: %v", err)
-	}
-	defer func() {
-		if errCfg := c.Close(); errCfg != nil {
-			t.Error(errCfg)
-		}
-	}()
-	b := patchHandlers("TestRun")
+	c, s := newTestConfig(t)
+	b := patchHandlers(t, "TestRun")
 	p, stop := New(2)
 
 	sigint := make(chan os.Signal, 1)
 	signal.Notify(sigint, os.Interrupt)
-	go func() {
-		time.Sleep(200 * time.Millisecond) // take time to work
-		close(sigint)
-	}()
-
 	go Run(c, p, sigint, testLogger, testLogger)
+
+	if err := s.WaitPolling(time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	chatID := fmt.Sprintf("TestRun%d@chat.agent", time.Now().UnixNano())
+	s.NewMessage(chatID, "user1@my.team", "TestRun user-test-msg")
+	time.Sleep(200 * time.Millisecond) // take time to work
+	close(sigint)
 	// all done, stop
 	<-stop
 
@@ -191,3 +172,153 @@ func TestRun(t *testing.T) {
 		t.Errorf("no expected value in the result: %s", result)
 	}
 }
+
+func TestRunBotAPI(t *testing.T) {
+	c, s := newTestConfig(t)
+
+	chatID := fmt.Sprintf("TestRunBotAPI%d@chat.agent", time.Now().UnixNano())
+	s.SetMembers(chatID, "user1@my.team", "user2@my.team", botapitest.BotID)
+
+	p, stop := New(2)
+	sigint := make(chan os.Signal)
+	go Run(c, p, sigint, testLogger, testLogger)
+
+	defer func() {
+		close(sigint)
+		<-stop
+	}()
+
+	if err := s.WaitPolling(time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	steps := []struct {
+		command  string
+		expected []string
+	}{
+		{command: "/start", expected: []string{"started"}},
+		{
+			command: "/go",
+			expected: []string{
+				"1. @[user1@my.team]\n2. @[user2@my.team]",
+				"1. @[user2@my.team]\n2. @[user1@my.team]",
+			},
+		},
+		{command: "/stop", expected: []string{"stopped"}},
+	}
+
+	for i, step := range steps {
+		s.NewMessage(chatID, "user1@my.team", step.command)
+
+		messages, errWait := s.WaitMessages(chatID, i+1, time.Second)
+		if errWait != nil {
+			t.Fatalf("failed %s: %v", step.command, errWait)
+		}
+
+		if m := messages[i]; !slices.Contains(step.expected, m.Text) {
+			t.Errorf("failed %s response=%q, want one of %q", step.command, m.Text, step.expected)
+		}
+	}
+}
+
+func TestHandleProcessed(t *testing.T) {
+	c, _ := newTestConfig(t)
+
+	var outcomes []string
+	f := func(_ context.Context, event *cmd.Event) error {
+		outcomes = append(outcomes, event.Outcome)
+		event.Outcome = event.Arguments
+		return nil
+	}
+	addCommand(t, &Command{Name: "TestHandleProcessed", Handler: f, Description: "test", NotStopped: true})
+	addCommand(t, &Command{Name: "TestHandleProcessedOther", Handler: f, Description: "test", NotStopped: true})
+
+	msgID := strconv.FormatInt(time.Now().UnixNano(), 10)
+	testCases := []struct {
+		name      string
+		eventType transport.EventType
+		text      string
+		handled   bool
+	}{
+		{name: "new", eventType: transport.NewMessage, text: "TestHandleProcessed a", handled: true},
+		{name: "redelivered", eventType: transport.NewMessage, text: "TestHandleProcessed a"},
+		{name: "edited_same", eventType: transport.EditedMessage, text: " TestHandleProcessed  a "},
+		{name: "edited", eventType: transport.EditedMessage, text: "TestHandleProcessed b", handled: true},
+		{name: "edited_again", eventType: transport.EditedMessage, text: "TestHandleProcessed c", handled: true},
+		{name: "other_command", eventType: transport.EditedMessage, text: "TestHandleProcessedOther d", handled: true},
+		{name: "command_back", eventType: transport.EditedMessage, text: "TestHandleProcessed e", handled: true},
+	}
+
+	for _, tc := range testCases {
+		p := Payload{
+			Cfg: c,
+			Event: &transport.Event{
+				Type:   tc.eventType,
+				Text:   tc.text,
+				MsgID:  msgID,
+				ChatID: "TestHandleProcessed",
+			},
+			LogInfo:  testLogger,
+			LogError: testLogger,
+		}
+
+		handled, errHandle := handle(p)
+		if errHandle != nil {
+			t.Fatalf("%s: handle: %v", tc.name, errHandle)
+		}
+
+		if handled != tc.handled {
+			t.Errorf("%s: failed handled=%v", tc.name, handled)
+		}
+	}
+
+	// re-runs of the edited message get the previous outcome only for the same command
+	expected := []string{"", "a", "b", "", ""}
+	if result := strings.Join(outcomes, ";"); result != strings.Join(expected, ";") {
+		t.Errorf("failed outcomes=%q, expected=%q", outcomes, expected)
+	}
+}
+
+func TestHandleRedelivered(t *testing.T) {
+	c, _ := newTestConfig(t)
+
+	var calls atomic.Int32
+	f := func(_ context.Context, _ *cmd.Event) error {
+		calls.Add(1)
+		time.Sleep(10 * time.Millisecond) // simulate command handling
+		return nil
+	}
+	addCommand(t, &Command{Name: "TestHandleRedelivered", Handler: f, Description: "test", NotStopped: true})
+
+	var (
+		wg      sync.WaitGroup
+		handled atomic.Int32
+		event   = &transport.Event{
+			Type:   transport.NewMessage,
+			Text:   "TestHandleRedelivered",
+			MsgID:  strconv.FormatInt(time.Now().UnixNano(), 10),
+			ChatID: "TestHandleRedelivered",
+		}
+	)
+
+	// copies of the same event arrive together
+	for range 3 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			ok, errHandle := handle(Payload{Cfg: c, Event: event, LogInfo: testLogger, LogError: testLogger})
+			if errHandle != nil {
+				t.Errorf("handle: %v", errHandle)
+			}
+			if ok {
+				handled.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n, h := calls.Load(), handled.Load(); n != 1 || h != 1 {
+		t.Errorf("failed handler calls=%d, handled=%d", n, h)
+	}
+}
@@ -75,3 +75,49 @@ func (s *SyncCommands) Decorate(command, chat string, f HandlerType) HandlerType
 		return f(ctx, e)
 	}
 }
+
+// messageLock is a mutex of the message with a number of its holders and waiters.
+type messageLock struct {
+	sync.Mutex
+	refs int
+}
+
+// SyncMessages is a map of messages which are being handled,
+// it serializes processing of redelivered copies of the same message.
+type SyncMessages struct {
+	sync.Mutex
+	messages map[string]*messageLock
+}
+
+// NewSyncMessages returns a new messages locks map.
+func NewSyncMessages() *SyncMessages {
+	return &SyncMessages{messages: make(map[string]*messageLock)}
+}
+
+// Lock locks the message of the chat and returns the unlock function.
+// The message lock is removed from the map when it is released by all holders.
+func (s *SyncMessages) Lock(chat, msgID string) func() {
+	key := chat + "/" + msgID
+
+	s.Mutex.Lock()
+	ml, ok := s.messages[key]
+	if !ok {
+		ml = &messageLock{}
+		s.messages[key] = ml
+	}
+	ml.refs++
+	s.Mutex.Unlock()
+
+	ml.Lock()
+
+	return func() {
+		ml.Unlock()
+
+		s.Mutex.Lock()
+		defer s.Mutex.Unlock()
+
+		if ml.refs--; ml.refs == 0 {
+			delete(s.messages, key)
+		}
+	}
+}
@@ -111,3 +111,38 @@ func TestNewSyncCommands(t *testing.T) {
 		})
 	}
 }
+
+func TestSyncMessages_Lock(t *testing.T) {
+	var (
+		active, maxActive atomic.Int32
+		wg                sync.WaitGroup
+		sm                = NewSyncMessages()
+	)
+
+	for _, msgID := range []string{"1", "1", "1", "2"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			unlock := sm.Lock("chat", msgID)
+			defer unlock()
+
+			if msgID == "1" {
+				if n := active.Add(1); n > maxActive.Load() {
+					maxActive.Store(n)
+				}
+				time.Sleep(10 * time.Millisecond)
+				active.Add(-1)
+			}
+		}()
+	}
+
+	wg.Wait()
+	if n := maxActive.Load(); n != 1 {
+		t.Errorf("failed concurrent handlers of the same message %d", n)
+	}
+
+	if n := len(sm.messages); n != 0 {
+		t.Errorf("failed released locks %d", n)
+	}
+}
@@ -0,0 +1,85 @@
+package serve
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	botgolang "github.com/mail-ru-im/bot-golang"
+
+	"github.com/z0rr0/gobot/transport"
+)
+
+// maxWebhookBody is a maximum size of webhook request body.
+const maxWebhookBody = 1 << 20
+
+// webhookRequest is a body of webhook request, it's the same as bot API "events/get" response.
+type webhookRequest struct {
+	Events []botgolang.Event `json:"events"`
+}
+
+// Webhook is HTTP handler of bot events which are POSTed by a gateway instead of long polling.
+type Webhook struct {
+	secret   []byte
+	events   chan<- transport.Event
+	stop     <-chan struct{}
+	logError *log.Logger
+}
+
+// NewWebhook returns a new webhook handler which sends received VK Teams events to the channel until stop is closed.
+// Requests are authenticated by the shared secret in "Authorization: Bearer <secret>" header.
+func NewWebhook(secret string, events chan<- transport.Event, stop <-chan struct{}, logError *log.Logger) *Webhook {
+	return &Webhook{secret: []byte(secret), events: events, stop: stop, logError: logError}
+}
+
+// ServeHTTP handles webhook request.
+func (h *Webhook) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeWebhookResponse(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(token), h.secret) != 1 {
+		writeWebhookResponse(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	request := &webhookRequest{}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxWebhookBody)).Decode(request); err != nil {
+		writeWebhookResponse(w, http.StatusBadRequest, "invalid events: "+err.Error())
+		return
+	}
+
+	for i := range request.Events {
+		select {
+		case h.events <- transport.VKTeamsEvent(&request.Events[i]):
+		case <-h.stop:
+			writeWebhookResponse(w, http.StatusServiceUnavailable, "service is stopping")
+			return
+		case <-r.Context().Done():
+			h.logError.Printf("webhook request is canceled, skipped %d events", len(request.Events)-i)
+			return
+		}
+	}
+
+	writeWebhookResponse(w, http.StatusOK, "")
+}
+
+// writeWebhookResponse writes a response in the format of bot API.
+func writeWebhookResponse(w http.ResponseWriter, status int, description string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	if description == "" {
+		_, _ = fmt.Fprint(w, `{"ok": true}`)
+		return
+	}
+
+	data, _ := json.Marshal(map[string]any{"ok": false, "description": description})
+	_, _ = w.Write(data)
+}
@@ -0,0 +1,188 @@
+package serve
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/z0rr0/gobot/config"
+	"github.com/z0rr0/gobot/transport"
+)
+
+// webhookEvents returns a webhook request body with new message events.
+func webhookEvents(msgID string, texts ...string) string {
+	events := make([]string, len(texts))
+
+	for i, text := range texts {
+		events[i] = fmt.Sprintf(`{"eventId": %d, "type": "newMessage", "payload": {`+
+			`"chat": {"chatId": "webhook@chat.agent", "type": "group"}, `+
+			`"from": {"firstName": "A", "userId": "user1@my.team"}, `+
+			`"msgId": "%s-%d", "text": %q, "timestamp": 1649335185}}`, i+1, msgID, i, text)
+	}
+
+	return `{"events": [` + strings.Join(events, ", ") + `]}`
+}
+
+// postWebhook sends webhook request and returns its status code.
+func postWebhook(client *http.Client, url, secret, body string) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, url, strings.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+
+	if secret != "" {
+		req.Header.Set("Authorization", "Bearer "+secret)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+
+	return resp.StatusCode, resp.Body.Close()
+}
+
+func TestWebhook(t *testing.T) {
+	var (
+		events = make(chan transport.Event, 10)
+		stop   = make(chan struct{})
+		server = httptest.NewServer(NewWebhook("secret", events, stop, testLogger))
+	)
+	defer server.Close()
+
+	testCases := []struct {
+		name   string
+		secret string
+		body   string
+		status int
+		events int
+	}{
+		{name: "no_secret", body: webhookEvents("a", "/go"), status: http.StatusUnauthorized},
+		{name: "bad_secret", secret: "other", body: webhookEvents("a", "/go"), status: http.StatusUnauthorized},
+		{name: "bad_body", secret: "secret", body: `{"events": [`, status: http.StatusBadRequest},
+		{name: "valid", secret: "secret", body: webhookEvents("a", "/go", "/skip"), status: http.StatusOK, events: 2},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			status, err := postWebhook(server.Client(), server.URL, tc.secret, tc.body)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if status != tc.status {
+				t.Errorf("failed status %d, want %d", status, tc.status)
+			}
+
+			if n := len(events); n != tc.events {
+				t.Errorf("failed events number %d, want %d", n, tc.events)
+			}
+
+			for range tc.events {
+				if e := <-events; e.Type != transport.NewMessage || e.ChatID != "webhook@chat.agent" {
+					t.Errorf("failed event %+v", e)
+				}
+			}
+		})
+	}
+
+	resp, err := server.Client().Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = resp.Body.Close(); err != nil {
+		t.Error(err)
+	}
+
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("failed GET status %d", resp.StatusCode)
+	}
+
+	// no events are accepted after stop
+	close(stop)
+	stopped := httptest.NewServer(NewWebhook("secret", make(chan transport.Event), stop, testLogger))
+	defer stopped.Close()
+
+	status, err := postWebhook(stopped.Client(), stopped.URL, "secret", webhookEvents("b", "/go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if status != http.StatusServiceUnavailable {
+		t.Errorf("failed status after stop %d", status)
+	}
+}
+
+func TestRunWebhook(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		response := "{\"msgId\": \"7083436385855602743\", \"ok\": true}"
+		_, err := fmt.Fprint(w, response)
+		if err != nil {
+			t.Error(err)
+		}
+	})
+	s := httptest.NewServer(handler)
+	defer s.Close()
+	c, err := config.New(configPath, buildInfo, s)
+	if err != nil {
+		t.Fatalf("config.New: %v", err)
+	}
+	defer func() {
+		if errCfg := c.Close(); errCfg != nil {
+			t.Error(errCfg)
+		}
+	}()
+
+	// take a free port for the webhook server
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	address := listener.Addr().String()
+	if err = listener.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	c.B.Mode = config.ModeWebhook
+	c.W = config.Webhook{Address: address, Path: "/events", Secret: "secret"}
+
+	b := patchHandlers(t, "TestRunWebhook")
+	p, stop := New(2)
+	sigint := make(chan os.Signal)
+	go Run(c, p, sigint, testLogger, testLogger)
+
+	var (
+		msgID  = strconv.FormatInt(time.Now().UnixNano(), 10)
+		body   = webhookEvents(msgID, "TestRunWebhook first", "TestRunWebhook second")
+		url    = "http://" + address + "/events"
+		status int
+	)
+
+	// wait for the server start
+	for range 50 {
+		if status, err = postWebhook(http.DefaultClient, url, "secret", body); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if status != http.StatusOK {
+		t.Errorf("failed status %d: %v", status, err)
+	}
+
+	close(sigint)
+	<-stop
+
+	if result := strings.Join(*b, ";"); result != "first;second" && result != "second;first" {
+		t.Errorf("failed result=%s", result)
+	}
+}
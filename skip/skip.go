@@ -1,92 +1,76 @@
+// Package skip contains scheduler jobs of temporary users' states.
 package skip
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log"
 	"time"
 
 	"github.com/z0rr0/gobot/config"
 	"github.com/z0rr0/gobot/db"
+	"github.com/z0rr0/gobot/scheduler"
+	"github.com/z0rr0/gobot/transport"
 )
 
-// Handler is a skip handler.
-type Handler struct {
-	Stop  chan struct{}
-	clean chan struct{}
-}
-
-// New creates a new skip handler and starts it.
-func New(c *config.Config, stopService <-chan struct{}, logInfo, logError *log.Logger) *Handler {
-	handler := &Handler{
-		Stop:  make(chan struct{}),
-		clean: make(chan struct{}),
+// retry is a first retry delay of failed jobs.
+const retry = 5 * time.Minute
+
+// Jobs returns scheduler jobs which remove expired skip states and return users from finished vacations.
+// States expire at local midnight of their chats, so jobs run every 15 minutes to cover all timezones offsets.
+func Jobs(c *config.Config, logError *log.Logger) []*scheduler.Job {
+	spec := scheduler.Every(15 * time.Minute)
+
+	return []*scheduler.Job{
+		{
+			Name:     "skip",
+			Spec:     spec,
+			Run:      func(ctx context.Context) error { return db.CleanSkip(ctx, c.DB) },
+			Retry:    retry,
+			MaxRetry: time.Hour,
+			CatchUp:  true,
+		},
+		{
+			Name:     "vacation",
+			Spec:     spec,
+			Run:      func(ctx context.Context) error { return returnVacations(ctx, c, logError) },
+			Retry:    retry,
+			MaxRetry: time.Hour,
+			CatchUp:  true,
+		},
 	}
-
-	go handler.start(c, stopService, logInfo, logError)
-	return handler
-}
-
-// stop stops skip daemon. It closes flag channels as a signal for stop for external services.
-func (h *Handler) stop() {
-	close(h.clean)
-	close(h.Stop)
 }
 
-// start runs skip daemon.
-func (h *Handler) start(c *config.Config, stopService <-chan struct{}, logInfo, logError *log.Logger) {
-	var (
-		now     = time.Now().In(c.Timezone)
-		timeout = nextTimeout(now)
-	)
-	logInfo.Printf("start skip-daemon [%v] now=%v, timeout=%v", c.Timezone, now.Truncate(time.Second), timeout)
-
-	defer func() {
-		h.stop()
-		logInfo.Println("stop skip-daemon")
-	}()
+// returnVacations removes users from exclude sets if their vacations are finished
+// and sends "welcome back" messages to active chats.
+// A state is deleted only after the message is sent, so failed notifications are repeated by the next run.
+func returnVacations(ctx context.Context, c *config.Config, logError *log.Logger) error {
+	states, err := db.ExpiredExclude(ctx, c.DB)
+	if err != nil {
+		return err
+	}
 
-	timer := time.NewTimer(timeout)
-	defer func() {
-		if !timer.Stop() {
-			// drain timer channel, if it has already expired or been stopped
-			<-timer.C
+	var errs []error
+	for _, s := range states {
+		chat, errChat := db.Get(ctx, c.DB, s.ChatID)
+		if errChat != nil {
+			logError.Printf("failed to get chat %q: %v", s.ChatID, errChat)
+			continue
 		}
-	}()
 
-	for {
-		select {
-		case <-stopService:
-			return
-		case <-timer.C:
-			logInfo.Printf("tick after %v", timeout)
-			timer.Reset(clean(c, logError))
-		case <-h.clean:
-			if !timer.Stop() {
-				<-timer.C
+		if chat.Active {
+			msg := &transport.Message{ChatID: chat.ID, Text: fmt.Sprintf("@[%s] welcome back from vacation", s.UserID)}
+			if errSend := c.Messenger.Send(msg); errSend != nil {
+				logError.Printf("failed to send message to chat %q: %v", chat.ID, errSend)
+				continue
 			}
-
-			timeout = clean(c, logError)
-			timer.Reset(timeout)
-
-			logInfo.Printf("force clean skip, new timeout=%v", timeout)
 		}
-	}
-}
-
-// nextTimeout returns next timeout for clean.
-func nextTimeout(ts time.Time) time.Duration {
-	return time.Date(ts.Year(), ts.Month(), ts.Day()+1, 0, 0, 1, 0, ts.Location()).Sub(ts)
-}
-
-// clean removes all skip users from chats.
-func clean(c *config.Config, logError *log.Logger) time.Duration {
-	ctx, cancel := c.Context()
-	defer cancel()
 
-	err := db.CleanSkip(ctx, c.DB)
-	if err != nil {
-		logError.Printf("failed clean skip: %v", err)
-		return 5 * time.Minute // retry again in 5 minutes
+		if errDelete := db.DeleteExpiredExclude(ctx, c.DB, s.ChatID, s.UserID); errDelete != nil {
+			errs = append(errs, errDelete)
+		}
 	}
 
-	return nextTimeout(time.Now().In(c.Timezone))
+	return errors.Join(errs...)
 }
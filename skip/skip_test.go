@@ -1,15 +1,20 @@
 package skip
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"slices"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/z0rr0/gobot/config"
+	"github.com/z0rr0/gobot/db"
 )
 
 const (
@@ -30,7 +35,7 @@ var (
 	testLogger = log.New(os.Stdout, "TEST  ", log.LstdFlags)
 )
 
-func TestNew(t *testing.T) {
+func TestJobs(t *testing.T) {
 	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 		response := "{\"msgId\": \"7083436385855602743\", \"ok\": true}"
@@ -53,50 +58,100 @@ func TestNew(t *testing.T) {
 		}
 	}()
 
-	stopService := make(chan struct{})
-	h := New(c, stopService, testLogger, testLogger)
+	ctx := context.Background()
+	jobs := Jobs(c, testLogger)
 
-	h.clean <- struct{}{}
+	names := make([]string, 0, len(jobs))
+	for _, job := range jobs {
+		if err = job.Run(ctx); err != nil {
+			t.Errorf("failed job %q: %v", job.Name, err)
+		}
+		names = append(names, job.Name)
+	}
 
-	close(stopService)
-	<-h.Stop
+	if expected := []string{"skip", "vacation"}; !slices.Equal(names, expected) {
+		t.Errorf("failed jobs %v, expected %v", names, expected)
+	}
 }
 
-func TestNextTimeout(t *testing.T) {
-	newYork, err := time.LoadLocation("America/New_York")
+func TestReturnVacations(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		failed   bool
+		messages []string
+	)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		response := "{\"msgId\": \"7083436385855602743\", \"ok\": true}"
+		if strings.TrimRight(r.URL.Path, " /") == "/messages/sendText" {
+			mu.Lock()
+			if failed {
+				response = "{\"ok\": false, \"description\": \"send error\"}"
+			} else {
+				messages = append(messages, r.URL.Query().Get("chatId")+":"+r.URL.Query().Get("text"))
+			}
+			mu.Unlock()
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, err := fmt.Fprint(w, response)
+		if err != nil {
+			t.Error(err)
+		}
+	})
+	s := httptest.NewServer(handler)
+	defer s.Close()
+
+	c, err := config.New(configPath, buildInfo, s)
 	if err != nil {
-		t.Fatalf("failed to load timezone: %v", err)
+		t.Fatalf("config.New: %v", err)
+	}
+
+	defer func() {
+		if errCfg := c.Close(); errCfg != nil {
+			t.Error(errCfg)
+		}
+	}()
+
+	ctx := context.Background()
+	now := time.Now()
+
+	for _, chat := range []*db.Chat{{ID: "TestReturnVacations", Active: true}, {ID: "TestReturnVacationsStopped"}} {
+		if err = chat.Upsert(ctx, c.DB); err != nil {
+			t.Fatalf("chat.Upsert: %v", err)
+		}
+
+		if err = chat.SaveVacation(ctx, c.DB, "user@my.team", now.Add(-time.Minute)); err != nil {
+			t.Fatalf("chat.SaveVacation: %v", err)
+		}
 	}
 
-	testCases := []struct {
-		name string
-		ts   time.Time
-		want time.Duration
-	}{
-		{
-			name: "UTC",
-			ts:   time.Date(2023, 11, 23, 5, 4, 3, 0, time.UTC),
-			want: time.Hour*18 + time.Minute*55 + time.Second*58,
-		},
-		{
-			name: "day",
-			ts:   time.Date(2023, 11, 23, 0, 0, 0, 0, time.FixedZone("UTC+1", 3600)),
-			want: time.Hour*24 + time.Second,
-		},
-		{
-			name: "winter",
-			ts:   time.Date(2023, 11, 5, 0, 0, 1, 0, newYork),
-			want: time.Hour * 25,
-		},
+	// failed notification keeps the state for the next run
+	mu.Lock()
+	failed = true
+	mu.Unlock()
+
+	if err = returnVacations(ctx, c, testLogger); err != nil {
+		t.Fatalf("returnVacations: %v", err)
 	}
 
-	for i := range testCases {
-		tc := testCases[i]
+	mu.Lock()
+	failed = false
+	mu.Unlock()
 
-		t.Run(tc.name, func(t *testing.T) {
-			if got := nextTimeout(tc.ts); got != tc.want {
-				t.Errorf("failed compare durations, got %v want %v", got, tc.want)
-			}
-		})
+	if err = returnVacations(ctx, c, testLogger); err != nil {
+		t.Fatalf("returnVacations: %v", err)
+	}
+
+	expected := []string{"TestReturnVacations:@[user@my.team] welcome back from vacation"}
+	if !slices.Equal(messages, expected) {
+		t.Errorf("failed messages %v, expected %v", messages, expected)
+	}
+
+	// all states are deleted after the successful notification
+	if err = returnVacations(ctx, c, testLogger); err != nil {
+		t.Fatalf("returnVacations: %v", err)
+	}
+
+	if !slices.Equal(messages, expected) {
+		t.Errorf("failed messages %v, expected %v", messages, expected)
 	}
 }
@@ -0,0 +1,138 @@
+package transport
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/z0rr0/gobot/markup"
+)
+
+// Console is a fake messenger for local development, it reads messages of one user from the input
+// and writes sent messages to the output.
+type Console struct {
+	sync.Mutex
+	in      io.Reader
+	out     io.Writer
+	chatID  string
+	user    User
+	members []User
+	lastID  int // number of the last sent message
+}
+
+// NewConsole returns a new console messenger, the user is the chat administrator.
+func NewConsole(in io.Reader, out io.Writer, chatID string, user User, members []User) *Console {
+	return &Console{in: in, out: out, chatID: chatID, user: user, members: members}
+}
+
+// Events returns a channel of messages which are read from the input line by line,
+// it's closed at the end of input or after the context cancellation.
+// Message IDs are unique between runs, because processed messages are saved to the database.
+func (c *Console) Events(ctx context.Context, logError *log.Logger) <-chan Event {
+	events := make(chan Event)
+
+	go func() {
+		defer close(events)
+
+		var (
+			prefix  = strconv.FormatInt(time.Now().UnixNano(), 36)
+			scanner = bufio.NewScanner(c.in)
+		)
+
+		for i := 1; scanner.Scan(); i++ {
+			text := strings.TrimSpace(scanner.Text())
+			if text == "" {
+				continue
+			}
+
+			event := Event{
+				Type:   NewMessage,
+				MsgID:  fmt.Sprintf("console-%s-%d", prefix, i),
+				ChatID: c.chatID,
+				From:   c.user,
+				Text:   text,
+			}
+
+			select {
+			case events <- event:
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		if err := scanner.Err(); err != nil {
+			logError.Printf("failed to read console input: %v", err)
+		}
+	}()
+
+	return events
+}
+
+// write prints the message with a header.
+func (c *Console) write(message *Message, action string) error {
+	var b strings.Builder
+
+	b.WriteString("--- message #" + message.ID)
+	if action != "" {
+		b.WriteString(" " + action)
+	}
+
+	if message.Markup != markup.Plain {
+		b.WriteString(" (" + string(message.Markup) + ")")
+	}
+
+	b.WriteString(" ---\n")
+	if message.Text != "" {
+		b.WriteString(message.Text + "\n")
+	}
+
+	for _, btn := range message.Buttons {
+		fmt.Fprintf(&b, "[%s](%s)\n", btn.Text, btn.URL)
+	}
+
+	_, err := io.WriteString(c.out, b.String())
+	return err
+}
+
+// Send writes a new message to the output and sets its ID.
+func (c *Console) Send(message *Message) error {
+	c.Lock()
+	defer c.Unlock()
+
+	c.lastID++
+	message.ID = strconv.Itoa(c.lastID)
+
+	return c.write(message, "")
+}
+
+// Edit writes the new text of sent message to the output.
+func (c *Console) Edit(message *Message) error {
+	c.Lock()
+	defer c.Unlock()
+
+	return c.write(message, "edited")
+}
+
+// Delete writes a note about deleted message to the output.
+func (c *Console) Delete(message *Message) error {
+	c.Lock()
+	defer c.Unlock()
+
+	return c.write(&Message{ID: message.ID}, "deleted")
+}
+
+// Members returns the fake chat members.
+func (c *Console) Members(string) ([]User, error) {
+	return c.members, nil
+}
+
+// Admins returns the console user as the only administrator.
+func (c *Console) Admins(string) ([]User, error) {
+	return []User{c.user}, nil
+}
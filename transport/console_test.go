@@ -0,0 +1,64 @@
+package transport
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/z0rr0/gobot/markup"
+)
+
+func TestConsole(t *testing.T) {
+	var (
+		out     strings.Builder
+		user    = User{ID: "user@my.team"}
+		members = []User{{ID: "alice@my.team"}, user}
+		console = NewConsole(strings.NewReader("/go\n\n  /skip  \n"), &out, "chat", user, members)
+	)
+
+	var events []Event
+	for e := range console.Events(context.Background(), testLogger) {
+		events = append(events, e)
+	}
+
+	if n := len(events); n != 2 {
+		t.Fatalf("failed events number %d", n)
+	}
+
+	for i, text := range []string{"/go", "/skip"} {
+		e := events[i]
+
+		if e.Type != NewMessage || e.ChatID != "chat" || e.From != user || e.Text != text || e.MsgID == "" {
+			t.Errorf("failed event %+v", e)
+		}
+	}
+
+	if events[0].MsgID == events[1].MsgID {
+		t.Errorf("not unique message IDs %q", events[0].MsgID)
+	}
+
+	message := &Message{ChatID: "chat", Text: "1. @[user@my.team]", Buttons: []Button{{Text: "call", URL: "https://example.com"}}}
+	if err := console.Send(message); err != nil {
+		t.Fatal(err)
+	}
+
+	message.Text, message.Markup, message.Buttons = "*done*", markup.Markdown, nil
+	if err := console.Edit(message); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := console.Delete(message); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "--- message #1 ---\n1. @[user@my.team]\n[call](https://example.com)\n" +
+		"--- message #1 edited (markdown) ---\n*done*\n" +
+		"--- message #1 deleted ---\n"
+	if s := out.String(); s != expected {
+		t.Errorf("failed output\n%s\nwant\n%s", s, expected)
+	}
+
+	if admins, err := console.Admins("chat"); err != nil || len(admins) != 1 || admins[0] != user {
+		t.Errorf("failed admins %v: %v", admins, err)
+	}
+}
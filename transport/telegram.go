@@ -0,0 +1,599 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/z0rr0/gobot/db"
+	"github.com/z0rr0/gobot/markup"
+)
+
+const (
+	// DefaultTelegramURL is Telegram Bot API URL.
+	DefaultTelegramURL = "https://api.telegram.org"
+
+	// defaultTelegramPoll is a default timeout of long polling (seconds).
+	defaultTelegramPoll = 30
+
+	// telegramTimeout is a timeout of Telegram Bot API requests except long polling.
+	telegramTimeout = 30 * time.Second
+)
+
+var (
+	// telegramRetryDelay is a delay before the next long polling request after an error.
+	telegramRetryDelay = 3 * time.Second
+
+	// tgMentionRegexp is a regexp of Telegram username mentions.
+	tgMentionRegexp = regexp.MustCompile(`@([A-Za-z0-9_]{5,32})\b`)
+
+	// userMentionRegexp is a regexp of common user mentions "@[userID]".
+	userMentionRegexp = regexp.MustCompile(`@\[([^\]]+)]`)
+
+	// tgParseModes are Telegram Bot API values of markup parse modes.
+	tgParseModes = map[markup.ParseMode]string{
+		markup.ParseModeMarkdownV2: "MarkdownV2",
+		markup.ParseModeHTML:       "HTML",
+	}
+)
+
+// tgResponse is a common response of Telegram Bot API.
+type tgResponse struct {
+	OK          bool            `json:"ok"`
+	Result      json.RawMessage `json:"result"`
+	ErrorCode   int             `json:"error_code"`
+	Description string          `json:"description"`
+}
+
+// tgUser is a Telegram user.
+type tgUser struct {
+	ID        int64  `json:"id"`
+	IsBot     bool   `json:"is_bot"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Username  string `json:"username"`
+}
+
+// user returns the common user.
+func (u *tgUser) user() User {
+	return User{ID: formatID(u.ID), FirstName: u.FirstName, LastName: u.LastName, Bot: u.IsBot}
+}
+
+// tgChat is a Telegram chat.
+type tgChat struct {
+	ID int64 `json:"id"`
+}
+
+// tgMessage is a Telegram message.
+type tgMessage struct {
+	MessageID      int64      `json:"message_id"`
+	From           *tgUser    `json:"from"`
+	Chat           tgChat     `json:"chat"`
+	Text           string     `json:"text"`
+	ReplyToMessage *tgMessage `json:"reply_to_message"`
+	NewChatMembers []tgUser   `json:"new_chat_members"`
+	LeftChatMember *tgUser    `json:"left_chat_member"`
+}
+
+// tgUpdate is an incoming update of Telegram Bot API.
+type tgUpdate struct {
+	UpdateID      int64      `json:"update_id"`
+	Message       *tgMessage `json:"message"`
+	EditedMessage *tgMessage `json:"edited_message"`
+}
+
+// tgChatMember is a member of Telegram chat.
+type tgChatMember struct {
+	User tgUser `json:"user"`
+}
+
+// tgButton is an inline keyboard button.
+type tgButton struct {
+	Text string `json:"text"`
+	URL  string `json:"url"`
+}
+
+// tgReplyMarkup is an inline keyboard of a message.
+type tgReplyMarkup struct {
+	InlineKeyboard [][]tgButton `json:"inline_keyboard"`
+}
+
+// tgMessageRequest is a request of sendMessage and editMessageText methods.
+type tgMessageRequest struct {
+	ChatID      string         `json:"chat_id"`
+	MessageID   int64          `json:"message_id,omitempty"`
+	Text        string         `json:"text,omitempty"`
+	ParseMode   string         `json:"parse_mode,omitempty"`
+	ReplyMarkup *tgReplyMarkup `json:"reply_markup,omitempty"`
+}
+
+// Telegram is a client of Telegram Bot API.
+// The API doesn't return a list of chat members, so they are collected from chat administrators
+// and received messages and saved to the database, users who haven't written anything are unknown.
+type Telegram struct {
+	sync.Mutex
+	url      string // API URL with the bot token
+	timeout  int    // long polling timeout (seconds)
+	client   *http.Client
+	db       *sql.DB                      // storage of known chat members
+	username string                       // bot username, it's requested before long polling
+	members  map[string]map[string]tgUser // cache of known members by chat and user IDs
+}
+
+// NewTelegram returns a new Telegram client, poll is a timeout of long polling (seconds),
+// known chat members are stored in the database.
+func NewTelegram(apiURL, token string, poll int, client *http.Client, database *sql.DB) *Telegram {
+	if apiURL == "" {
+		apiURL = DefaultTelegramURL
+	}
+
+	if poll < 1 {
+		poll = defaultTelegramPoll
+	}
+
+	return &Telegram{
+		url:     strings.TrimSuffix(apiURL, "/") + "/bot" + token,
+		timeout: poll,
+		client:  client,
+		db:      database,
+		members: make(map[string]map[string]tgUser),
+	}
+}
+
+// formatID returns Telegram identifier as a string.
+func formatID(id int64) string {
+	return strconv.FormatInt(id, 10)
+}
+
+// call sends a request of the API method and decodes its result.
+func (t *Telegram) call(ctx context.Context, method string, params, result any) error {
+	data, err := json.Marshal(params)
+	if err != nil {
+		return fmt.Errorf("telegram %s marshal: %w", method, err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.url+"/"+method, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("telegram %s request: %w", method, err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			// the URL contains the bot token
+			err = urlErr.Err
+		}
+		return fmt.Errorf("telegram %s: %w", method, err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	response := &tgResponse{}
+	if err = json.NewDecoder(resp.Body).Decode(response); err != nil {
+		return fmt.Errorf("%w: telegram %s status=%d: %v", ErrResponse, method, resp.StatusCode, err)
+	}
+
+	if !response.OK {
+		return fmt.Errorf("%w: telegram %s error=%d: %s", ErrResponse, method, response.ErrorCode, response.Description)
+	}
+
+	if result == nil {
+		return nil
+	}
+
+	if err = json.Unmarshal(response.Result, result); err != nil {
+		return fmt.Errorf("%w: telegram %s result: %v", ErrResponse, method, err)
+	}
+
+	return nil
+}
+
+// callTimeout calls the API method with the requests timeout.
+func (t *Telegram) callTimeout(method string, params, result any) error {
+	ctx, cancel := context.WithTimeout(context.Background(), telegramTimeout)
+	defer cancel()
+
+	return t.call(ctx, method, params, result)
+}
+
+// dbContext returns a context of database requests.
+func dbContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), telegramTimeout)
+}
+
+// Events returns a channel of received events by long polling.
+func (t *Telegram) Events(ctx context.Context, logError *log.Logger) <-chan Event {
+	events := make(chan Event)
+
+	go func() {
+		defer close(events)
+
+		me := &tgUser{}
+		if err := t.call(ctx, "getMe", struct{}{}, me); err != nil {
+			logError.Printf("failed to get bot info: %v", err)
+		} else {
+			t.Lock()
+			t.username = me.Username
+			t.Unlock()
+		}
+
+		t.poll(ctx, events, logError)
+	}()
+
+	return events
+}
+
+// poll requests updates and sends their events to the channel until the context cancellation.
+func (t *Telegram) poll(ctx context.Context, events chan<- Event, logError *log.Logger) {
+	var offset int64
+
+	params := struct {
+		Offset         int64    `json:"offset"`
+		Timeout        int      `json:"timeout"`
+		AllowedUpdates []string `json:"allowed_updates"`
+	}{Timeout: t.timeout, AllowedUpdates: []string{"message", "edited_message"}}
+
+	for ctx.Err() == nil {
+		var updates []tgUpdate
+
+		params.Offset = offset
+		if err := t.call(ctx, "getUpdates", params, &updates); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+
+			logError.Printf("failed to get updates, retrying in %v: %v", telegramRetryDelay, err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(telegramRetryDelay):
+			}
+
+			continue
+		}
+
+		for _, u := range updates {
+			offset = u.UpdateID + 1
+
+			event, ok := t.event(&u, logError)
+			if !ok {
+				continue
+			}
+
+			select {
+			case events <- event:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// event returns the common event of the update, it's false if the update has no text message.
+func (t *Telegram) event(u *tgUpdate, logError *log.Logger) (Event, bool) {
+	msg, eventType := u.Message, NewMessage
+	if msg == nil {
+		msg, eventType = u.EditedMessage, EditedMessage
+	}
+
+	if msg == nil {
+		return Event{}, false
+	}
+
+	chatID := formatID(msg.Chat.ID)
+	if err := t.remember(chatID, msg); err != nil {
+		logError.Printf("failed to remember members of chat %s: %v", chatID, err)
+	}
+
+	if msg.From == nil || msg.Text == "" {
+		return Event{}, false
+	}
+
+	event := Event{
+		Type:   eventType,
+		MsgID:  formatID(msg.MessageID),
+		ChatID: chatID,
+		From:   msg.From.user(),
+		Text:   t.incomingText(chatID, msg.Text),
+	}
+
+	if r := msg.ReplyToMessage; r != nil && r.Text != "" {
+		quote := Quote{Text: r.Text}
+
+		if r.From != nil {
+			quote.From = r.From.user()
+		}
+
+		event.Quotes = append(event.Quotes, quote)
+	}
+
+	return event, true
+}
+
+// remember updates known chat members by the message.
+func (t *Telegram) remember(chatID string, msg *tgMessage) error {
+	t.Lock()
+	defer t.Unlock()
+
+	ctx, cancel := dbContext()
+	defer cancel()
+
+	users := msg.NewChatMembers
+	if msg.From != nil {
+		users = append(users, *msg.From)
+	}
+
+	if err := t.addMembers(ctx, chatID, users...); err != nil {
+		return err
+	}
+
+	if msg.LeftChatMember == nil {
+		return nil
+	}
+
+	userID := formatID(msg.LeftChatMember.ID)
+	if err := db.DeleteChatMember(ctx, t.db, chatID, userID); err != nil {
+		return err
+	}
+
+	delete(t.members[chatID], userID)
+	return nil
+}
+
+// known returns known members of the chat, they are loaded from the database only once,
+// a caller must hold the lock.
+func (t *Telegram) known(ctx context.Context, chatID string) (map[string]tgUser, error) {
+	if members, ok := t.members[chatID]; ok {
+		return members, nil
+	}
+
+	items, err := db.ChatMembers(ctx, t.db, chatID)
+	if err != nil {
+		return nil, err
+	}
+
+	members := make(map[string]tgUser, len(items))
+	for _, m := range items {
+		id, err := strconv.ParseInt(m.UserID, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid telegram user ID %q: %w", m.UserID, err)
+		}
+
+		members[m.UserID] = tgUser{ID: id, IsBot: m.Bot, FirstName: m.FirstName, LastName: m.LastName, Username: m.Username}
+	}
+
+	t.members[chatID] = members
+	return members, nil
+}
+
+// addMembers saves users as known members of the chat, a caller must hold the lock.
+// Only new users and users with changed names are saved, most messages are from already known members.
+func (t *Telegram) addMembers(ctx context.Context, chatID string, users ...tgUser) error {
+	members, err := t.known(ctx, chatID)
+	if err != nil {
+		return err
+	}
+
+	items := make([]db.ChatMember, 0, len(users))
+	for _, u := range users {
+		if known, ok := members[formatID(u.ID)]; ok && known == u {
+			continue
+		}
+
+		items = append(items, db.ChatMember{
+			ChatID:    chatID,
+			UserID:    formatID(u.ID),
+			FirstName: u.FirstName,
+			LastName:  u.LastName,
+			Username:  u.Username,
+			Bot:       u.IsBot,
+		})
+	}
+
+	if len(items) == 0 {
+		return nil
+	}
+
+	if err = db.SaveChatMembers(ctx, t.db, items...); err != nil {
+		return err
+	}
+
+	for _, u := range users {
+		members[formatID(u.ID)] = u
+	}
+
+	return nil
+}
+
+// incomingText removes the bot username from the command and replaces mentions of known members
+// "@username" by common mentions "@[userID]".
+func (t *Telegram) incomingText(chatID, text string) string {
+	t.Lock()
+	defer t.Unlock()
+
+	// "/command@bot_username arguments"
+	first, arguments, _ := strings.Cut(text, " ")
+	if command, name, ok := strings.Cut(first, "@"); ok && strings.HasPrefix(command, "/") {
+		if t.username == "" || strings.EqualFold(name, t.username) {
+			text = strings.TrimSpace(command + " " + arguments)
+		}
+	}
+
+	members := t.members[chatID]
+	return tgMentionRegexp.ReplaceAllStringFunc(text, func(mention string) string {
+		for id, u := range members {
+			if u.Username != "" && strings.EqualFold(u.Username, mention[1:]) {
+				return "@[" + id + "]"
+			}
+		}
+		return mention
+	})
+}
+
+// outgoingText replaces common mentions "@[userID]" of known members by their usernames or names.
+func (t *Telegram) outgoingText(chatID, text string) (string, error) {
+	t.Lock()
+	defer t.Unlock()
+
+	ctx, cancel := dbContext()
+	defer cancel()
+
+	members, err := t.known(ctx, chatID)
+	if err != nil {
+		return "", err
+	}
+
+	return userMentionRegexp.ReplaceAllStringFunc(text, func(mention string) string {
+		u, ok := members[mention[2:len(mention)-1]]
+		switch {
+		case !ok:
+			return mention
+		case u.Username != "":
+			return "@" + u.Username
+		default:
+			return u.user().Name()
+		}
+	}), nil
+}
+
+// request returns a request of the message, mentions are replaced only in plain texts
+// because usernames can contain special characters of the parse modes.
+func (t *Telegram) request(message *Message) (*tgMessageRequest, error) {
+	request := &tgMessageRequest{ChatID: message.ChatID, Text: message.Text}
+
+	if message.ID != "" {
+		id, err := strconv.ParseInt(message.ID, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid telegram message ID %q: %w", message.ID, err)
+		}
+
+		request.MessageID = id
+	}
+
+	if parseMode, ok := tgParseModes[message.Markup.ParseMode()]; ok {
+		request.ParseMode = parseMode
+	} else {
+		text, err := t.outgoingText(message.ChatID, message.Text)
+		if err != nil {
+			return nil, err
+		}
+
+		request.Text = text
+	}
+
+	if len(message.Buttons) > 0 {
+		buttons := make([]tgButton, len(message.Buttons))
+
+		for i, btn := range message.Buttons {
+			buttons[i] = tgButton{Text: btn.Text, URL: btn.URL}
+		}
+
+		request.ReplyMarkup = &tgReplyMarkup{InlineKeyboard: [][]tgButton{buttons}}
+	}
+
+	return request, nil
+}
+
+// Send sends a new message and sets its ID.
+func (t *Telegram) Send(message *Message) error {
+	request, err := t.request(message)
+	if err != nil {
+		return err
+	}
+
+	request.MessageID = 0
+	result := &tgMessage{}
+
+	if err = t.callTimeout("sendMessage", request, result); err != nil {
+		return err
+	}
+
+	message.ID = formatID(result.MessageID)
+	return nil
+}
+
+// Edit replaces the text of sent message.
+func (t *Telegram) Edit(message *Message) error {
+	request, err := t.request(message)
+	if err != nil {
+		return err
+	}
+
+	return t.callTimeout("editMessageText", request, nil)
+}
+
+// Delete deletes sent message.
+func (t *Telegram) Delete(message *Message) error {
+	request, err := t.request(&Message{ID: message.ID, ChatID: message.ChatID})
+	if err != nil {
+		return err
+	}
+
+	return t.callTimeout("deleteMessage", request, nil)
+}
+
+// Members returns chat administrators and other known members from the database sorted by ID.
+func (t *Telegram) Members(chatID string) ([]User, error) {
+	if _, err := t.Admins(chatID); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := dbContext()
+	defer cancel()
+
+	members, err := db.ChatMembers(ctx, t.db, chatID)
+	if err != nil {
+		return nil, err
+	}
+
+	users := make([]User, len(members))
+	for i, m := range members {
+		users[i] = User{ID: m.UserID, FirstName: m.FirstName, LastName: m.LastName, Bot: m.Bot}
+	}
+
+	return users, nil
+}
+
+// Admins returns chat administrators, they are added to known members.
+func (t *Telegram) Admins(chatID string) ([]User, error) {
+	var members []tgChatMember
+
+	if err := t.callTimeout("getChatAdministrators", map[string]string{"chat_id": chatID}, &members); err != nil {
+		return nil, err
+	}
+
+	admins := make([]tgUser, len(members))
+	users := make([]User, len(members))
+
+	for i, m := range members {
+		admins[i] = m.User
+		users[i] = m.User.user()
+	}
+
+	t.Lock()
+	defer t.Unlock()
+
+	ctx, cancel := dbContext()
+	defer cancel()
+
+	if err := t.addMembers(ctx, chatID, admins...); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
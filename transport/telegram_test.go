@@ -0,0 +1,367 @@
+package transport
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/z0rr0/gobot/db"
+	"github.com/z0rr0/gobot/markup"
+)
+
+const testToken = "123:token"
+
+var testLogger = log.New(io.Discard, "TEST", log.LstdFlags)
+
+// fakeTelegram is a fake Telegram Bot API server which returns the updates once
+// and records requests of other methods.
+type fakeTelegram struct {
+	sync.Mutex
+	t        *testing.T
+	updates  string
+	results  map[string]string
+	requests map[string][]map[string]any
+}
+
+func (f *fakeTelegram) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	method, ok := strings.CutPrefix(r.URL.Path, "/bot"+testToken+"/")
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	params := make(map[string]any)
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		f.t.Errorf("failed request %s: %v", method, err)
+	}
+
+	f.Lock()
+	f.requests[method] = append(f.requests[method], params)
+	result, ok := f.results[method]
+
+	if method == "getUpdates" {
+		result, f.updates = f.updates, "[]"
+	}
+	f.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if !ok && method != "getUpdates" {
+		_, _ = fmt.Fprintf(w, `{"ok": false, "error_code": 400, "description": "unknown method %s"}`, method)
+		return
+	}
+
+	if result == "[]" {
+		// long polling without updates
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	_, _ = fmt.Fprintf(w, `{"ok": true, "result": %s}`, result)
+}
+
+// requested returns parameters of the method requests.
+func (f *fakeTelegram) requested(method string) []map[string]any {
+	f.Lock()
+	defer f.Unlock()
+	return f.requests[method]
+}
+
+// openDB returns a new database for known chat members, it's closed after the test.
+func openDB(t *testing.T) *sql.DB {
+	database, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "telegram.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		if e := database.Close(); e != nil {
+			t.Error(e)
+		}
+	})
+
+	if _, err = db.Migrate(context.Background(), database); err != nil {
+		t.Fatal(err)
+	}
+
+	return database
+}
+
+func newFakeTelegram(t *testing.T, updates string) (*fakeTelegram, *Telegram, func()) {
+	f := &fakeTelegram{
+		t:       t,
+		updates: updates,
+		results: map[string]string{
+			"getMe":           `{"id": 100, "is_bot": true, "first_name": "Bot", "username": "test_bot"}`,
+			"sendMessage":     `{"message_id": 42, "chat": {"id": -1}}`,
+			"editMessageText": `{"message_id": 42, "chat": {"id": -1}}`,
+			"deleteMessage":   `true`,
+			"getChatAdministrators": `[{"status": "creator", "user": {"id": 1, "first_name": "Admin"}}, ` +
+				`{"status": "administrator", "user": {"id": 100, "is_bot": true, "first_name": "Bot"}}]`,
+		},
+		requests: make(map[string][]map[string]any),
+	}
+
+	s := httptest.NewServer(f)
+	return f, NewTelegram(s.URL, testToken, 1, s.Client(), openDB(t)), s.Close
+}
+
+const testUpdates = `[
+	{"update_id": 1, "message": {"message_id": 10, "chat": {"id": -1},
+		"from": {"id": 2, "first_name": "Alice", "username": "alice_user"}, "text": "hello"}},
+	{"update_id": 2, "message": {"message_id": 11, "chat": {"id": -1},
+		"from": {"id": 1, "first_name": "Admin"}, "new_chat_members": [{"id": 3, "first_name": "Bob", "last_name": "B"}]}},
+	{"update_id": 3, "message": {"message_id": 12, "chat": {"id": -1},
+		"from": {"id": 1, "first_name": "Admin"}, "text": "/exclude@test_bot @alice_user @other_user",
+		"reply_to_message": {"message_id": 10, "from": {"id": 2, "first_name": "Alice"}, "text": "hello"}}},
+	{"update_id": 4, "edited_message": {"message_id": 12, "chat": {"id": -1},
+		"from": {"id": 1, "first_name": "Admin"}, "text": "/go@other_bot"}}
+]`
+
+func TestTelegram_Events(t *testing.T) {
+	f, tg, stop := newFakeTelegram(t, testUpdates)
+	defer stop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	events := tg.Events(ctx, testLogger)
+
+	expected := []Event{
+		{Type: NewMessage, MsgID: "10", ChatID: "-1", From: User{ID: "2", FirstName: "Alice"}, Text: "hello"},
+		{
+			Type: NewMessage, MsgID: "12", ChatID: "-1", From: User{ID: "1", FirstName: "Admin"},
+			Text:   "/exclude @[2] @other_user",
+			Quotes: []Quote{{From: User{ID: "2", FirstName: "Alice"}, Text: "hello"}},
+		},
+		{Type: EditedMessage, MsgID: "12", ChatID: "-1", From: User{ID: "1", FirstName: "Admin"}, Text: "/go@other_bot"},
+	}
+
+	for i, e := range expected {
+		event := <-events
+
+		if a, b := fmt.Sprintf("%+v", event), fmt.Sprintf("%+v", e); a != b {
+			t.Errorf("failed event [%d]\n%s\nwant\n%s", i, a, b)
+		}
+	}
+
+	// wait for the next long polling request
+	requests := f.requested("getUpdates")
+	for i := 0; i < 100 && len(requests) < 2; i++ {
+		time.Sleep(5 * time.Millisecond)
+		requests = f.requested("getUpdates")
+	}
+
+	cancel()
+	for range events {
+		// wait for the channel closing
+	}
+
+	if n := len(requests); n < 2 {
+		t.Fatalf("failed number of getUpdates requests %d", n)
+	}
+
+	if offset := requests[1]["offset"]; offset != float64(5) {
+		t.Errorf("failed offset %v", offset)
+	}
+
+	tg.Lock()
+	members := len(tg.members["-1"])
+	tg.Unlock()
+
+	if members != 3 {
+		t.Errorf("failed number of known members %d", members)
+	}
+
+	saved, err := db.ChatMembers(context.Background(), tg.db, "-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(saved) != 3 || saved[1].UserID != "2" || saved[1].Username != "alice_user" {
+		t.Errorf("failed saved members %+v", saved)
+	}
+}
+
+func TestTelegram_remember(t *testing.T) {
+	_, tg, stop := newFakeTelegram(t, "[]")
+	defer stop()
+
+	ctx := context.Background()
+	alice := tgUser{ID: 2, FirstName: "Alice"}
+
+	if err := tg.remember("-1", &tgMessage{From: &alice}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the row is removed directly, so a repeated save would restore it
+	if err := db.DeleteChatMember(ctx, tg.db, "-1", "2"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tg.remember("-1", &tgMessage{From: &alice}); err != nil {
+		t.Fatal(err)
+	}
+
+	saved, err := db.ChatMembers(ctx, tg.db, "-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(saved) != 0 {
+		t.Errorf("known member is saved again %+v", saved)
+	}
+
+	alice.Username = "alice_user"
+	if err = tg.remember("-1", &tgMessage{From: &alice}); err != nil {
+		t.Fatal(err)
+	}
+
+	if saved, err = db.ChatMembers(ctx, tg.db, "-1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(saved) != 1 || saved[0].Username != "alice_user" {
+		t.Errorf("changed member is not saved %+v", saved)
+	}
+}
+
+func TestTelegram_Send(t *testing.T) {
+	f, tg, stop := newFakeTelegram(t, "[]")
+	defer stop()
+
+	tg.members["-1"] = map[string]tgUser{
+		"2": {ID: 2, FirstName: "Alice", Username: "alice_user"},
+		"3": {ID: 3, FirstName: "Bob", LastName: "B"},
+	}
+
+	message := &Message{
+		ChatID:  "-1",
+		Text:    "1. @[2]\n2. @[3]\n3. @[4]",
+		Buttons: []Button{{Text: "call", URL: "https://example.com"}},
+	}
+
+	if err := tg.Send(message); err != nil {
+		t.Fatal(err)
+	}
+
+	if message.ID != "42" {
+		t.Errorf("failed message ID %q", message.ID)
+	}
+
+	requests := f.requested("sendMessage")
+	if len(requests) != 1 {
+		t.Fatalf("failed number of sendMessage requests %d", len(requests))
+	}
+
+	data, err := json.Marshal(requests[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `{"chat_id":"-1","reply_markup":{"inline_keyboard":[[{"text":"call","url":"https://example.com"}]]},` +
+		`"text":"1. @alice_user\n2. Bob B\n3. @[4]"}`
+	if s := string(data); s != expected {
+		t.Errorf("failed request\n%s\nwant\n%s", s, expected)
+	}
+
+	message = &Message{ID: "42", ChatID: "-1", Text: "*bold* @[2]", Markup: markup.Markdown}
+	if err = tg.Edit(message); err != nil {
+		t.Fatal(err)
+	}
+
+	params := f.requested("editMessageText")[0]
+	if params["message_id"] != float64(42) || params["parse_mode"] != "MarkdownV2" || params["text"] != "*bold* @[2]" {
+		t.Errorf("failed edit request %v", params)
+	}
+
+	if err = tg.Delete(message); err != nil {
+		t.Fatal(err)
+	}
+
+	params = f.requested("deleteMessage")[0]
+	if params["message_id"] != float64(42) || params["chat_id"] != "-1" || len(params) != 2 {
+		t.Errorf("failed delete request %v", params)
+	}
+
+	if err = tg.Edit(&Message{ID: "bad", ChatID: "-1", Text: "text"}); err == nil {
+		t.Error("expected error of invalid message ID")
+	}
+
+	f.Lock()
+	delete(f.results, "sendMessage")
+	f.Unlock()
+
+	if err = tg.Send(&Message{ChatID: "-1", Text: "text"}); !errors.Is(err, ErrResponse) {
+		t.Errorf("failed error: %v", err)
+	}
+}
+
+func TestTelegram_request(t *testing.T) {
+	tg := NewTelegram("", testToken, 1, http.DefaultClient, openDB(t))
+	tg.members["-1"] = map[string]tgUser{"2": {ID: 2, Username: "bob_user"}}
+
+	testCases := []struct {
+		mode      markup.Mode
+		text      string
+		parseMode string
+	}{
+		{mode: markup.Plain, text: "@bob_user"},
+		{mode: markup.Markdown, text: "@[2]", parseMode: "MarkdownV2"},
+		{mode: markup.HTML, text: "@[2]", parseMode: "HTML"},
+	}
+
+	for _, tc := range testCases {
+		request, err := tg.request(&Message{ChatID: "-1", Text: "@[2]", Markup: tc.mode})
+		if err != nil {
+			t.Fatalf("mode %q: %v", tc.mode, err)
+		}
+
+		if request.Text != tc.text || request.ParseMode != tc.parseMode {
+			t.Errorf("mode %q: failed request %+v", tc.mode, request)
+		}
+	}
+}
+
+func TestTelegram_Members(t *testing.T) {
+	_, tg, stop := newFakeTelegram(t, "[]")
+	defer stop()
+
+	// the member was seen before the restart, so it's known only by the database
+	err := db.SaveChatMembers(context.Background(), tg.db, db.ChatMember{ChatID: "-1", UserID: "2", FirstName: "Alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	admins, err := tg.Admins("-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(admins) != 2 || admins[0].ID != "1" || admins[0].Bot || !admins[1].Bot {
+		t.Errorf("failed admins %+v", admins)
+	}
+
+	members, err := tg.Members("-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ids := make([]string, len(members))
+	for i, m := range members {
+		ids[i] = m.ID
+	}
+
+	if s := strings.Join(ids, ","); s != "1,100,2" {
+		t.Errorf("failed members %s", s)
+	}
+}
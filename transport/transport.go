@@ -0,0 +1,88 @@
+// Package transport contains messenger clients with a common interface,
+// so bot commands don't depend on the messenger API.
+package transport
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+
+	"github.com/z0rr0/gobot/markup"
+)
+
+// EventType is a type of messenger event.
+type EventType string
+
+// Types of handled events, other events keep the messenger's type.
+const (
+	NewMessage    EventType = "newMessage"
+	EditedMessage EventType = "editedMessage"
+)
+
+// ErrResponse is an error of messenger's API response.
+var ErrResponse = errors.New("messenger response error")
+
+// User is a messenger user.
+type User struct {
+	ID        string
+	FirstName string
+	LastName  string
+	Bot       bool
+}
+
+// Name returns user's full name or its ID if the name is empty.
+func (u User) Name() string {
+	if name := strings.TrimSpace(u.FirstName + " " + u.LastName); name != "" {
+		return name
+	}
+
+	return u.ID
+}
+
+// Quote is a replied or forwarded message.
+type Quote struct {
+	From User
+	Text string
+}
+
+// Event is a received message.
+type Event struct {
+	Type   EventType
+	MsgID  string
+	ChatID string
+	From   User
+	Text   string
+	Quotes []Quote
+}
+
+// Button is an inline button with URL.
+type Button struct {
+	Text string
+	URL  string
+}
+
+// Message is an outgoing message.
+type Message struct {
+	ID      string // it's set after sending
+	ChatID  string
+	Text    string
+	Markup  markup.Mode
+	Buttons []Button // one row of inline buttons
+}
+
+// Messenger is a common interface of messenger API.
+type Messenger interface {
+	// Events returns a channel of received events, it's closed after the context cancellation.
+	Events(ctx context.Context, logError *log.Logger) <-chan Event
+	// Send sends a new message and sets its ID.
+	Send(message *Message) error
+	// Edit replaces the text of sent message.
+	Edit(message *Message) error
+	// Delete deletes sent message.
+	Delete(message *Message) error
+	// Members returns chat members.
+	Members(chatID string) ([]User, error)
+	// Admins returns chat administrators.
+	Admins(chatID string) ([]User, error)
+}
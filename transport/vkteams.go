@@ -0,0 +1,164 @@
+package transport
+
+import (
+	"context"
+	"log"
+	"regexp"
+
+	botgolang "github.com/mail-ru-im/bot-golang"
+
+	"github.com/z0rr0/gobot/markup"
+)
+
+var (
+	// vkBotIDRegexp is a regexp to detect VK Teams UserID as a bot identifier.
+	vkBotIDRegexp = regexp.MustCompile(`^\d+$`)
+
+	// vkParseModes are bot library values of markup parse modes.
+	vkParseModes = map[markup.ParseMode]botgolang.ParseMode{
+		markup.ParseModeMarkdownV2: botgolang.ParseModeMarkdownV2,
+		markup.ParseModeHTML:       botgolang.ParseModeHTML,
+	}
+)
+
+// VKTeams is a client of VK Teams Bot API.
+type VKTeams struct {
+	bot *botgolang.Bot
+}
+
+// NewVKTeams returns a new VK Teams client.
+func NewVKTeams(bot *botgolang.Bot) *VKTeams {
+	return &VKTeams{bot: bot}
+}
+
+// Info returns the bot information.
+func (b *VKTeams) Info() *botgolang.BotInfo {
+	return b.bot.Info
+}
+
+// VKTeamsEvent converts VK Teams event to the common one.
+func VKTeamsEvent(e *botgolang.Event) Event {
+	event := Event{
+		Type:   EventType(e.Type),
+		MsgID:  e.Payload.MsgID,
+		ChatID: e.Payload.Chat.ID,
+		From:   vkContact(e.Payload.From),
+		Text:   e.Payload.Text,
+	}
+
+	for _, part := range e.Payload.Parts {
+		if part.Type != botgolang.REPLY && part.Type != botgolang.FORWARD {
+			continue
+		}
+
+		msg := part.Payload.PartMessage
+		event.Quotes = append(event.Quotes, Quote{From: vkContact(msg.From), Text: msg.Text})
+	}
+
+	return event
+}
+
+// vkContact converts VK Teams contact to the user.
+func vkContact(c botgolang.Contact) User {
+	return User{ID: c.User.ID, FirstName: c.FirstName, LastName: c.LastName, Bot: vkBotIDRegexp.MatchString(c.User.ID)}
+}
+
+// vkMembers converts VK Teams chat members to users.
+func vkMembers(members []botgolang.ChatMember) []User {
+	users := make([]User, len(members))
+
+	for i, m := range members {
+		users[i] = User{ID: m.User.ID, Bot: vkBotIDRegexp.MatchString(m.User.ID)}
+	}
+
+	return users
+}
+
+// Events returns a channel of received events by long polling.
+// Errors are logged by the bot library, so logError is not used.
+func (b *VKTeams) Events(ctx context.Context, _ *log.Logger) <-chan Event {
+	var (
+		updates = b.bot.GetUpdatesChannel(ctx)
+		events  = make(chan Event)
+	)
+
+	go func() {
+		defer close(events)
+
+		for e := range updates {
+			select {
+			case events <- VKTeamsEvent(&e):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return events
+}
+
+// newMessage returns a new bot library message with the parse mode and buttons.
+func (b *VKTeams) newMessage(message *Message) *botgolang.Message {
+	msg := b.bot.NewTextMessage(message.ChatID, message.Text)
+	msg.ID = message.ID
+
+	if parseMode, ok := vkParseModes[message.Markup.ParseMode()]; ok {
+		msg.AppendParseMode(parseMode)
+	}
+
+	if len(message.Buttons) > 0 {
+		keyboard := botgolang.NewKeyboard()
+		buttons := make([]botgolang.Button, len(message.Buttons))
+
+		for i, btn := range message.Buttons {
+			buttons[i] = botgolang.NewURLButton(btn.Text, btn.URL)
+		}
+
+		keyboard.AddRow(buttons...)
+		msg.AttachInlineKeyboard(keyboard)
+	}
+
+	return msg
+}
+
+// Send sends a new message and sets its ID.
+func (b *VKTeams) Send(message *Message) error {
+	msg := b.newMessage(message)
+
+	if err := b.bot.SendMessage(msg); err != nil {
+		return err
+	}
+
+	message.ID = msg.ID
+	return nil
+}
+
+// Edit replaces the text of sent message.
+func (b *VKTeams) Edit(message *Message) error {
+	return b.bot.EditMessage(b.newMessage(message))
+}
+
+// Delete deletes sent message.
+func (b *VKTeams) Delete(message *Message) error {
+	return b.newMessage(message).Delete()
+}
+
+// Members returns chat members.
+func (b *VKTeams) Members(chatID string) ([]User, error) {
+	members, err := b.bot.GetChatMembers(chatID)
+	if err != nil {
+		return nil, err
+	}
+
+	return vkMembers(members), nil
+}
+
+// Admins returns chat administrators.
+func (b *VKTeams) Admins(chatID string) ([]User, error) {
+	admins, err := b.bot.GetChatAdmins(chatID)
+	if err != nil {
+		return nil, err
+	}
+
+	return vkMembers(admins), nil
+}